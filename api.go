@@ -0,0 +1,576 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/pg.v4"
+	"gopkg.in/pg.v4/orm"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// APIPrefix is the prefix of every route of the JSON API.
+const APIPrefix = "/api/v1"
+
+const (
+	// apiPageSize is the number of monitors or logs returned
+	// per page.
+	apiPageSize = 100
+
+	// maxAPIBodySize is the largest request body that is read.
+	maxAPIBodySize = 1 << 20
+)
+
+var (
+	errAPINotJSON = NewAPIError(http.StatusBadRequest,
+		"The request body needs to be a JSON object.")
+	errAPIServer = NewAPIError(http.StatusInternalServerError,
+		"An internal server error occurred.")
+)
+
+// JSONPage is returned by the handlers of the API. Data is sent
+// as JSON (if it is nil, the response has no body).
+type JSONPage struct {
+	Status int
+	Data   interface{}
+}
+
+// Execute writes the status and the data.
+func (p JSONPage) Execute(w http.ResponseWriter) bool {
+	if p.Data == nil {
+		w.WriteHeader(p.Status)
+		return true
+	}
+
+	w.Header().Set("Content-Type", jsonContent)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p.Data); err != nil {
+		log.Println("Error while encoding JSON:", err)
+		return false
+	}
+
+	return true
+}
+
+// apiError is the body of every error returned by the API.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// NewAPIError returns a page containing the error message.
+func NewAPIError(status int, msg string) JSONPage {
+	return JSONPage{status, apiError{msg}}
+}
+
+// apiErrorPage converts an error meant for the HTML pages. Server
+// errors are logged since their details are not sent to the client.
+func apiErrorPage(err HTTPError) JSONPage {
+	if e, ok := err.(StatusError); ok {
+		return NewAPIError(e.Status, e.Message)
+	}
+
+	log.Println("An unexpected error occurred in the API:", err)
+	return errAPIServer
+}
+
+// apiEventName returns the name of the event used by the
+// API (such as "up" or "paused").
+func apiEventName(e EventType) string {
+	return strings.ToLower(e.ShortName())
+}
+
+// apiMonitor is a monitor as returned by the API.
+type apiMonitor struct {
+	Id       int             `json:"id"`
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Status   string          `json:"status"`
+	Paused   bool            `json:"paused"`
+	Settings MonitorSettings `json:"settings"`
+}
+
+// newAPIMonitor converts the monitor. The options are left out
+// unless showOptions is true since they may contain credentials
+// (such as the headers of HTTP monitors).
+func newAPIMonitor(s MonitorStatus, showOptions bool) apiMonitor {
+	m := apiMonitor{
+		Id:       s.Id,
+		Name:     s.Name,
+		Type:     s.Type,
+		Status:   apiEventName(s.Event),
+		Paused:   s.Event == MonitorPausedEvent,
+		Settings: s.Settings,
+	}
+
+	if !showOptions {
+		m.Settings.Options = nil
+	}
+
+	return m
+}
+
+// apiShowsOptions is true if the options of monitors may be sent
+// in response to r. Read-only tokens do not get them, just like
+// viewers do not see them in the web interface.
+func apiShowsOptions(r *http.Request) bool {
+	token := TokenFromRequest(r)
+	return token != nil && token.Scope == ReadWriteScope
+}
+
+// apiMonitorInput is the body of requests creating or updating a
+// monitor. The options of checkboxes are either "on" or "off" (or
+// a boolean); omitted checkboxes get their default value.
+type apiMonitorInput struct {
+	Name     string           `json:"name"`
+	Type     string           `json:"type"`
+	Settings apiSettingsInput `json:"settings"`
+
+	// Paused is only used when a monitor is created.
+	Paused bool `json:"paused"`
+}
+
+// apiSettingsInput are the settings of an apiMonitorInput. Options
+// shadows the options of MonitorSettings.
+type apiSettingsInput struct {
+	MonitorSettings
+	Options apiOptions `json:"options"`
+}
+
+// apiOptions are the options of a monitor. Booleans and numbers
+// are accepted as well as strings.
+type apiOptions map[string]string
+
+func (o *apiOptions) UnmarshalJSON(data []byte) error {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*o = apiOptions{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			(*o)[key] = v
+		case bool:
+			(*o)[key] = strconv.FormatBool(v)
+		case float64:
+			(*o)[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+		default:
+			return fmt.Errorf("invalid value of option %q", key)
+		}
+	}
+
+	return nil
+}
+
+// checkboxValue converts the value of a checkbox given to the API
+// to the value submitted by the form.
+func checkboxValue(value string) string {
+	switch value {
+	case "true":
+		return "on"
+	case "false":
+		return "off"
+	}
+
+	return value
+}
+
+// values returns the input as if it had been submitted by the
+// form so that it can be validated by parseMonitorValues.
+func (in apiMonitorInput) values() url.Values {
+	values := url.Values{}
+	values.Set("name", in.Name)
+	values.Set("type", in.Type)
+	values.Set("target", in.Settings.Target)
+	values.Set("interval", strconv.Itoa(in.Settings.Interval))
+	values.Set("timeout", strconv.Itoa(in.Settings.Timeout))
+	values.Set("retries", strconv.Itoa(in.Settings.Retries))
+	if in.Paused {
+		values.Set("paused", "on")
+	}
+
+	for key, value := range in.Settings.Options {
+		values.Set(in.Type+"."+key, value)
+	}
+
+	if t, ok := LookupCheckerType(in.Type); ok {
+		for _, field := range t.Fields {
+			if field.Kind != FieldCheckbox {
+				continue
+			}
+
+			key := in.Type + "." + field.Name
+			if value, ok := in.Settings.Options[field.Name]; ok {
+				values.Set(key, checkboxValue(value))
+			} else {
+				values.Set(key, field.Default)
+			}
+		}
+	}
+
+	for _, id := range in.Settings.ChannelIds {
+		values.Add("channels", strconv.Itoa(id))
+	}
+
+	if p := in.Settings.Escalation; p != nil {
+		for _, id := range p.ChannelIds {
+			values.Add("escalation_channels", strconv.Itoa(id))
+		}
+		values.Set("escalation_after", strconv.Itoa(p.After))
+		values.Set("escalation_repeat", strconv.Itoa(p.Repeat))
+	}
+
+	return values
+}
+
+// parseAPIMonitor reads the monitor from the request's body and
+// validates it just like the form does. If it is invalid, the
+// returned page contains the error.
+func parseAPIMonitor(r *http.Request) (Monitor, bool, Page) {
+	input := apiMonitorInput{}
+	body := io.LimitReader(r.Body, maxAPIBodySize)
+	if err := json.NewDecoder(body).Decode(&input); err != nil {
+		return Monitor{}, false, errAPINotJSON
+	}
+
+	m, paused, err := parseMonitorValues(input.values())
+	if err != nil {
+		return m, paused, NewAPIError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	return m, paused, nil
+}
+
+// apiPagination describes the page returned by the API.
+type apiPagination struct {
+	Page     int `json:"page"`
+	Pages    int `json:"pages"`
+	PageSize int `json:"page_size"`
+	Total    int `json:"total"`
+}
+
+func newAPIPagination(p Pagination) apiPagination {
+	return apiPagination{p.Page, p.Pages(), p.PageSize, p.Total}
+}
+
+// apiUptime is an UptimeReport as returned by the API. All
+// durations are in seconds.
+type apiUptime struct {
+	Percent  float64 `json:"uptime_percent"`
+	Uptime   int64   `json:"uptime_seconds"`
+	Downtime int64   `json:"downtime_seconds"`
+	Outages  int     `json:"outages"`
+	MTTR     int64   `json:"mttr_seconds"`
+	MTBF     int64   `json:"mtbf_seconds"`
+}
+
+func newAPIUptime(r UptimeReport) apiUptime {
+	seconds := func(d time.Duration) int64 {
+		return int64(d / time.Second)
+	}
+
+	return apiUptime{
+		Percent:  r.Percentage(),
+		Uptime:   seconds(r.Uptime),
+		Downtime: seconds(r.Downtime),
+		Outages:  r.Outages,
+		MTTR:     seconds(r.MTTR),
+		MTBF:     seconds(r.MTBF),
+	}
+}
+
+// selectMonitorStatuses selects the monitors (aliased as "m") along
+// with their latest event.
+func selectMonitorStatuses() *orm.Query {
+	return joinLatestLog(db.Model(&Monitor{}).Alias("m").
+		Column("m.id", "m.name", "m.type", "m.settings", "l1.event"))
+}
+
+// loadMonitorStatus loads a single monitor along with its
+// latest event.
+func loadMonitorStatus(id int) (MonitorStatus, HTTPError) {
+	statuses := []MonitorStatus{}
+	err := selectMonitorStatuses().Where("m.id = ?", id).Select(&statuses)
+	if err != nil {
+		return MonitorStatus{}, NewDatabaseError(err)
+	} else if len(statuses) == 0 {
+		return MonitorStatus{}, errMonitorNotFound
+	}
+
+	return statuses[0], nil
+}
+
+// apiMonitorPage returns the page showing the monitor in
+// response to r.
+func apiMonitorPage(r *http.Request, id, status int) Page {
+	monitor, err := loadMonitorStatus(id)
+	if err != nil {
+		return apiErrorPage(err)
+	}
+
+	return JSONPage{status, newAPIMonitor(monitor, apiShowsOptions(r))}
+}
+
+func apiListMonitorsHandler(r *http.Request, _ httprouter.Params) Page {
+	total, err := db.Model(&Monitor{}).Count()
+	if err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	page := NewPagination(r.URL.Query(), apiPageSize, total)
+	statuses := []MonitorStatus{}
+	err = selectMonitorStatuses().Order("m.id ASC").
+		Offset(page.Offset()).Limit(page.PageSize).
+		Select(&statuses)
+	if err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	showOptions := apiShowsOptions(r)
+	monitors := make([]apiMonitor, 0, len(statuses))
+	for _, s := range statuses {
+		monitors = append(monitors, newAPIMonitor(s, showOptions))
+	}
+
+	return JSONPage{http.StatusOK, struct {
+		Monitors   []apiMonitor  `json:"monitors"`
+		Pagination apiPagination `json:"pagination"`
+	}{monitors, newAPIPagination(page)}}
+}
+
+func apiCreateMonitorHandler(r *http.Request, _ httprouter.Params) Page {
+	monitor, paused, errPage := parseAPIMonitor(r)
+	if errPage != nil {
+		return errPage
+	}
+
+	if err := createMonitor(&monitor, paused); err != nil {
+		return apiErrorPage(err)
+	}
+
+	refreshScheduler()
+	return apiMonitorPage(r, monitor.Id, http.StatusCreated)
+}
+
+func apiGetMonitorHandler(r *http.Request, params httprouter.Params) Page {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return apiErrorPage(errMonitorNotFound)
+	}
+
+	return apiMonitorPage(r, id, http.StatusOK)
+}
+
+// apiUpdateMonitorHandler replaces all settings of the monitor
+// (whether it is paused cannot be changed).
+func apiUpdateMonitorHandler(r *http.Request, params httprouter.Params) Page {
+	existing, httpErr := loadMonitor(params)
+	if httpErr != nil {
+		return apiErrorPage(httpErr)
+	}
+
+	monitor, _, errPage := parseAPIMonitor(r)
+	if errPage != nil {
+		return errPage
+	}
+
+	monitor.Id = existing.Id
+	if err := db.Update(&monitor); err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	refreshScheduler()
+	return apiMonitorPage(r, monitor.Id, http.StatusOK)
+}
+
+func apiDeleteMonitorHandler(_ *http.Request, params httprouter.Params) Page {
+	monitor, httpErr := loadMonitor(params)
+	if httpErr != nil {
+		return apiErrorPage(httpErr)
+	}
+
+	if err := db.Delete(&monitor); err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	refreshScheduler()
+	return JSONPage{Status: http.StatusNoContent}
+}
+
+// apiPauseMonitorHandler returns the handler pausing (or resuming)
+// a monitor. Pausing a paused monitor is not an error.
+func apiPauseMonitorHandler(paused bool) UptimeCheckerHandler {
+	return func(r *http.Request, params httprouter.Params) Page {
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil {
+			return apiErrorPage(errMonitorNotFound)
+		}
+
+		if _, err := setMonitorPaused(id, paused); err == pg.ErrNoRows {
+			return apiErrorPage(errMonitorNotFound)
+		} else if err != nil {
+			return apiErrorPage(NewDatabaseError(err))
+		}
+
+		refreshScheduler()
+		return apiMonitorPage(r, id, http.StatusOK)
+	}
+}
+
+// apiLog is a log entry as returned by the API.
+type apiLog struct {
+	Id     int       `json:"id"`
+	Event  string    `json:"event"`
+	Date   time.Time `json:"date"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// apiLogFilter restricts the logs to those within the dates
+// given by the query parameters "from" and "to" (both RFC 3339
+// and optional).
+type apiLogFilter struct {
+	From, To time.Time
+}
+
+func parseAPILogFilter(query url.Values) (f apiLogFilter, err error) {
+	parse := func(key string) (time.Time, error) {
+		if query.Get(key) == "" {
+			return time.Time{}, nil
+		}
+
+		return time.Parse(time.RFC3339, query.Get(key))
+	}
+
+	if f.From, err = parse("from"); err != nil {
+		return f, errors.New("The parameter 'from' needs to be an RFC 3339 date.")
+	}
+
+	if f.To, err = parse("to"); err != nil {
+		return f, errors.New("The parameter 'to' needs to be an RFC 3339 date.")
+	}
+
+	return f, nil
+}
+
+// apply adds the conditions of the filter to q.
+func (f apiLogFilter) apply(q *orm.Query) *orm.Query {
+	if !f.From.IsZero() {
+		q = q.Where("date >= ?", f.From)
+	}
+
+	if !f.To.IsZero() {
+		q = q.Where("date <= ?", f.To)
+	}
+
+	return q
+}
+
+// apiLogsHandler returns the logs of the monitor (newest first).
+func apiLogsHandler(r *http.Request, params httprouter.Params) Page {
+	monitor, httpErr := loadMonitor(params)
+	if httpErr != nil {
+		return apiErrorPage(httpErr)
+	}
+
+	filter, err := parseAPILogFilter(r.URL.Query())
+	if err != nil {
+		return NewAPIError(http.StatusBadRequest, err.Error())
+	}
+
+	total, err := filter.apply(db.Model(&MonitorLog{}).
+		Where("monitor_id = ?", monitor.Id)).Count()
+	if err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	page := NewPagination(r.URL.Query(), apiPageSize, total)
+	logs := []MonitorLog{}
+	err = filter.apply(db.Model(&logs).Where("monitor_id = ?", monitor.Id)).
+		Order("date DESC, id DESC").
+		Offset(page.Offset()).Limit(page.PageSize).
+		Select()
+	if err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	entries := make([]apiLog, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, apiLog{l.Id, apiEventName(l.Event), l.Date, l.Reason})
+	}
+
+	return JSONPage{http.StatusOK, struct {
+		Logs       []apiLog      `json:"logs"`
+		Pagination apiPagination `json:"pagination"`
+	}{entries, newAPIPagination(page)}}
+}
+
+// apiMonitorStatusHandler returns the current state of the monitor
+// along with its uptime within the range selected like on the
+// monitor's page ("range", "from" and "to").
+func apiMonitorStatusHandler(r *http.Request, params httprouter.Params) Page {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return apiErrorPage(errMonitorNotFound)
+	}
+
+	timeRange, err := ParseTimeRange(r.URL.Query(), time.Now())
+	if err != nil {
+		return NewAPIError(http.StatusBadRequest, err.Error())
+	}
+
+	monitor, httpErr := loadMonitorStatus(id)
+	if httpErr != nil {
+		return apiErrorPage(httpErr)
+	}
+
+	latest := MonitorLog{}
+	err = db.Model(&latest).Where("monitor_id = ?", id).
+		Order("date DESC, id DESC").Limit(1).Select()
+	if err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	reports, err := loadUptimeReports(db, []int{id}, timeRange)
+	if err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	type apiRange struct {
+		Name string    `json:"name"`
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	}
+
+	return JSONPage{http.StatusOK, struct {
+		Monitor apiMonitor `json:"monitor"`
+		Since   time.Time  `json:"since"`
+		Reason  string     `json:"reason,omitempty"`
+		Range   apiRange   `json:"range"`
+		Uptime  apiUptime  `json:"uptime"`
+	}{
+		newAPIMonitor(monitor, apiShowsOptions(r)), latest.Date, latest.Reason,
+		apiRange{timeRange.Name, timeRange.From, timeRange.To},
+		newAPIUptime(reports[id]),
+	}}
+}
+
+// apiStatusHandler returns the number of monitors by their state.
+func apiStatusHandler(_ *http.Request, _ httprouter.Params) Page {
+	stats, err := loadDashboardStats()
+	if err != nil {
+		return apiErrorPage(NewDatabaseError(err))
+	}
+
+	return JSONPage{http.StatusOK, stats}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// assertJSONPage checks the status of page and decodes its data
+// into v (by encoding it first, just like it is sent).
+func assertJSONPage(t *testing.T, page Page, status int, v interface{}) {
+	p, ok := page.(JSONPage)
+	if !ok {
+		t.Fatalf("Wanted a JSONPage; got: %#v", page)
+	}
+
+	if p.Status != status {
+		t.Fatalf("Wanted status %v; got: %v (%#v)", status, p.Status, p.Data)
+	}
+
+	if v == nil {
+		return
+	}
+
+	recorder := httptest.NewRecorder()
+	p.Execute(recorder)
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatalf("Could not decode %q: %v", recorder.Body.String(), err)
+	}
+}
+
+func assertAPIError(t *testing.T, page Page, status int, msg string) {
+	body := apiError{}
+	assertJSONPage(t, page, status, &body)
+	if body.Error != msg {
+		t.Errorf("Wanted error %q; got: %q", msg, body.Error)
+	}
+}
+
+// tokenRequest returns a request authenticated with a token
+// of the scope.
+func tokenRequest(t *testing.T, method string, scope TokenScope) *http.Request {
+	return withToken(MustRequest(t, method, "", nil), &APIToken{Scope: scope})
+}
+
+func jsonRequest(t *testing.T, method, body string) *http.Request {
+	r := MustRequest(t, method, "", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return withToken(r, &APIToken{Scope: ReadWriteScope})
+}
+
+func TestJSONPageExecute(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	JSONPage{http.StatusCreated, map[string]int{"id": 1}}.Execute(recorder)
+	exportLogsAssertRecorder(t, recorder, http.StatusCreated, jsonContent, "{\"id\":1}\n")
+
+	recorder = httptest.NewRecorder()
+	JSONPage{Status: http.StatusNoContent}.Execute(recorder)
+	if recorder.Code != http.StatusNoContent || recorder.Body.Len() != 0 {
+		t.Errorf("Wanted an empty 204 response; got: %v %q", recorder.Code, recorder.Body)
+	}
+}
+
+func TestAPIErrorPage(t *testing.T) {
+	assertAPIError(t, apiErrorPage(errMonitorNotFound),
+		http.StatusNotFound, errMonitorNotFound.Message)
+
+	defer shutupLog()()
+	page := apiErrorPage(NewDatabaseError(errors.New("connection refused")))
+	assertAPIError(t, page, http.StatusInternalServerError, "An internal server error occurred.")
+}
+
+func TestNewAPIMonitor(t *testing.T) {
+	settings := MonitorSettings{Version: 1, Target: "example.com",
+		Options: map[string]string{"count": "5"}}
+	status := MonitorStatus{3, "Main Server", "ping", MonitorPausedEvent, settings}
+	m := newAPIMonitor(status, true)
+	if m.Id != 3 || m.Name != "Main Server" || m.Type != "ping" ||
+		m.Status != "paused" || !m.Paused || m.Settings.Target != "example.com" ||
+		m.Settings.Options["count"] != "5" {
+		t.Errorf("Unexpected monitor: %#v", m)
+	}
+
+	m = newAPIMonitor(status, false)
+	if m.Settings.Target != "example.com" || m.Settings.Options != nil {
+		t.Errorf("The options have not been left out: %#v", m)
+	}
+
+	if status.Settings.Options["count"] != "5" {
+		t.Errorf("The options of the monitor have been changed: %#v", status.Settings)
+	}
+
+	m = newAPIMonitor(MonitorStatus{Event: MonitorDownEvent}, true)
+	if m.Status != "down" || m.Paused {
+		t.Errorf("Unexpected monitor: %#v", m)
+	}
+}
+
+func TestAPIShowsOptions(t *testing.T) {
+	testcase := []struct {
+		r        *http.Request
+		expected bool
+	}{
+		{MustRequest(t, "GET", "", nil), false},
+		{tokenRequest(t, "GET", ReadOnlyScope), false},
+		{tokenRequest(t, "GET", ReadWriteScope), true},
+	}
+
+	for _, row := range testcase {
+		if shows := apiShowsOptions(row.r); shows != row.expected {
+			t.Errorf("apiShowsOptions(%v) => %v, wanted: %v",
+				TokenFromRequest(row.r), shows, row.expected)
+		}
+	}
+}
+
+func TestNewAPIUptime(t *testing.T) {
+	report := UptimeReport{
+		Uptime:   3 * time.Hour,
+		Downtime: time.Hour,
+		Outages:  2,
+		MTTR:     30 * time.Minute,
+		MTBF:     90 * time.Minute,
+	}
+
+	data, err := json.Marshal(newAPIUptime(report))
+	if err != nil {
+		t.Fatalf("Could not encode the report: %v", err)
+	}
+
+	expected := `{"uptime_percent":75,"uptime_seconds":10800,"downtime_seconds":3600,` +
+		`"outages":2,"mttr_seconds":1800,"mtbf_seconds":5400}`
+	if string(data) != expected {
+		t.Errorf("Wanted %s; got: %s", expected, data)
+	}
+}
+
+func TestParseAPIMonitor(t *testing.T) {
+	body := `{"name": " Website ", "type": "http-keyword", "paused": true,
+		"settings": {"target": "http://example.com", "interval": 60, "retries": 2,
+			"options": {"keyword": "Welcome", "keyword_absent": true, "keyword_regexp": "false"}}}`
+
+	m, paused, page := parseAPIMonitor(jsonRequest(t, "POST", body))
+	if page != nil {
+		t.Fatalf("parseAPIMonitor returned an error: %#v", page)
+	}
+
+	if m.Name != "Website" || m.Type != "http-keyword" || !paused {
+		t.Errorf("Unexpected monitor: %#v (paused: %v)", m, paused)
+	}
+
+	s := m.Settings
+	if s.Target != "http://example.com" || s.Interval != 60 || s.Retries != 2 {
+		t.Errorf("Unexpected settings: %#v", s)
+	}
+
+	// follow_redirects has been omitted, so it is on by default.
+	if s.Options["keyword"] != "Welcome" || s.Options["keyword_absent"] != "on" ||
+		s.Options["keyword_regexp"] != "off" || s.Options["follow_redirects"] != "on" {
+		t.Errorf("Unexpected options: %#v", s.Options)
+	}
+}
+
+func TestParseAPIMonitorInvalid(t *testing.T) {
+	testcase := []struct {
+		body   string
+		status int
+		err    string
+	}{
+		{`not json`, http.StatusBadRequest, "The request body needs to be a JSON object."},
+		{`{"name": 1}`, http.StatusBadRequest, "The request body needs to be a JSON object."},
+		{`{"name": "a", "settings": {"options": {"a": []}}}`, http.StatusBadRequest,
+			"The request body needs to be a JSON object."},
+		{`{"type": "ping"}`, http.StatusUnprocessableEntity, "A name for the monitor is required."},
+		{`{"name": "a", "type": "foo"}`, http.StatusUnprocessableEntity, "Please select a valid type."},
+		{`{"name": "a", "type": "ping", "settings": {"target": "example.com", "interval": 5}}`,
+			http.StatusUnprocessableEntity, "The interval needs to be at least 10s."},
+		{`{"name": "a", "type": "ping", "settings": {"target": "example.com", "retries": -1}}`,
+			http.StatusUnprocessableEntity, "Please enter a valid number of retries."},
+	}
+
+	for _, row := range testcase {
+		_, _, page := parseAPIMonitor(jsonRequest(t, "POST", row.body))
+		assertAPIError(t, page, row.status, row.err)
+	}
+}
+
+func TestParseAPILogFilter(t *testing.T) {
+	query := url.Values{"from": {"2016-01-02T15:04:05Z"}}
+	f, err := parseAPILogFilter(query)
+	if err != nil {
+		t.Fatalf("parseAPILogFilter returned an error: %v", err)
+	}
+
+	from := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	if !f.From.Equal(from) || !f.To.IsZero() {
+		t.Errorf("Unexpected filter: %#v", f)
+	}
+
+	query = url.Values{"to": {"yesterday"}}
+	if _, err := parseAPILogFilter(query); err == nil ||
+		err.Error() != "The parameter 'to' needs to be an RFC 3339 date." {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestAPIListMonitorsHandler(t *testing.T) {
+	defer InitTestConnection(t)()
+	body := struct {
+		Monitors   []apiMonitor
+		Pagination apiPagination
+	}{}
+
+	page := apiListMonitorsHandler(MustRequest(t, "GET", "/", nil), nil)
+	assertJSONPage(t, page, http.StatusOK, &body)
+	if len(body.Monitors) != 4 || body.Pagination.Total != 4 {
+		t.Fatalf("Wanted 4 monitors; got: %#v", body)
+	}
+
+	if m := body.Monitors[3]; m.Id != 4 || m.Name != "Down server" || m.Status != "down" {
+		t.Errorf("Unexpected monitor: %#v", m)
+	}
+}
+
+func TestAPIMonitorHandlers(t *testing.T) {
+	defer InitTestConnection(t)()
+	body := `{"name": "API", "type": "ping", "paused": true,
+		"settings": {"target": "example.com"}}`
+
+	created := apiMonitor{}
+	page := apiCreateMonitorHandler(jsonRequest(t, "POST", body), nil)
+	assertJSONPage(t, page, http.StatusCreated, &created)
+	if created.Id == 0 || created.Name != "API" || created.Status != "paused" {
+		t.Fatalf("Unexpected monitor: %#v", created)
+	}
+
+	params := httprouter.Params{{Key: "id", Value: strconv.Itoa(created.Id)}}
+	body = `{"name": "Renamed", "type": "ping", "settings": {"target": "example.org"}}`
+	updated := apiMonitor{}
+	page = apiUpdateMonitorHandler(jsonRequest(t, "PUT", body), params)
+	assertJSONPage(t, page, http.StatusOK, &updated)
+	if updated.Name != "Renamed" || updated.Settings.Target != "example.org" || !updated.Paused {
+		t.Errorf("Unexpected monitor: %#v", updated)
+	}
+
+	resumed := apiMonitor{}
+	page = apiPauseMonitorHandler(false)(tokenRequest(t, "POST", ReadWriteScope), params)
+	assertJSONPage(t, page, http.StatusOK, &resumed)
+	if resumed.Status != "started" {
+		t.Errorf("The monitor has not been resumed: %#v", resumed)
+	}
+
+	assertJSONPage(t, apiDeleteMonitorHandler(nil, params), http.StatusNoContent, nil)
+	page = apiGetMonitorHandler(tokenRequest(t, "GET", ReadOnlyScope), params)
+	assertAPIError(t, page, http.StatusNotFound, errMonitorNotFound.Message)
+}
+
+func TestAPICreateMonitorDefaults(t *testing.T) {
+	defer InitTestConnection(t)()
+	body := `{"name": "Defaults", "type": "http", "settings": {"target": "http://example.com"}}`
+
+	created := apiMonitor{}
+	page := apiCreateMonitorHandler(jsonRequest(t, "POST", body), nil)
+	assertJSONPage(t, page, http.StatusCreated, &created)
+
+	params := httprouter.Params{{Key: "id", Value: strconv.Itoa(created.Id)}}
+	loaded := apiMonitor{}
+	page = apiGetMonitorHandler(tokenRequest(t, "GET", ReadWriteScope), params)
+	assertJSONPage(t, page, http.StatusOK, &loaded)
+	if loaded.Settings.Options["follow_redirects"] != "on" {
+		t.Errorf("Unexpected options: %#v", loaded.Settings.Options)
+	}
+}
+
+func TestAPIReadOnlyTokenOptions(t *testing.T) {
+	defer InitTestConnection(t)()
+	body := `{"name": "Secret", "type": "http", "settings": {"target": "http://example.com",
+		"options": {"headers": "Authorization: Bearer s3cr3t"}}}`
+
+	created := apiMonitor{}
+	page := apiCreateMonitorHandler(jsonRequest(t, "POST", body), nil)
+	assertJSONPage(t, page, http.StatusCreated, &created)
+	if created.Settings.Options["headers"] != "Authorization: Bearer s3cr3t" {
+		t.Fatalf("Unexpected options: %#v", created.Settings.Options)
+	}
+
+	params := httprouter.Params{{Key: "id", Value: strconv.Itoa(created.Id)}}
+	readOnly := tokenRequest(t, "GET", ReadOnlyScope)
+	pages := map[string]Page{
+		"get":    apiGetMonitorHandler(readOnly, params),
+		"list":   apiListMonitorsHandler(readOnly, nil),
+		"status": apiMonitorStatusHandler(readOnly, params),
+	}
+
+	for name, page := range pages {
+		recorder := httptest.NewRecorder()
+		page.(JSONPage).Execute(recorder)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%v returned %v: %v", name, recorder.Code, recorder.Body)
+		} else if strings.Contains(recorder.Body.String(), "s3cr3t") {
+			t.Errorf("%v has sent the headers to a read-only token: %v",
+				name, recorder.Body)
+		}
+	}
+}
+
+func TestAPILogsHandler(t *testing.T) {
+	defer InitTestConnection(t)()
+	params := httprouter.Params{{Key: "id", Value: "4"}}
+	body := struct {
+		Logs       []apiLog
+		Pagination apiPagination
+	}{}
+
+	r := MustRequest(t, "GET", "/?from=2000-01-01T00:00:00Z", nil)
+	assertJSONPage(t, apiLogsHandler(r, params), http.StatusOK, &body)
+	if len(body.Logs) == 0 || body.Pagination.Total != len(body.Logs) {
+		t.Fatalf("Unexpected logs: %#v", body)
+	}
+
+	for i := 1; i < len(body.Logs); i++ {
+		if body.Logs[i].Date.After(body.Logs[i-1].Date) {
+			t.Errorf("The logs are not ordered by date: %#v", body.Logs)
+		}
+	}
+
+	r = MustRequest(t, "GET", "/?from=now", nil)
+	assertAPIError(t, apiLogsHandler(r, params), http.StatusBadRequest,
+		"The parameter 'from' needs to be an RFC 3339 date.")
+
+	params = httprouter.Params{{Key: "id", Value: "100"}}
+	assertAPIError(t, apiLogsHandler(r, params), http.StatusNotFound, errMonitorNotFound.Message)
+}
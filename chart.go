@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/pg.v4"
+)
+
+// Dimensions of the uptime chart (in SVG user units).
+const (
+	chartWidth       = 800
+	chartHeight      = 240
+	chartMarginLeft  = 60
+	chartMarginRight = 10
+
+	// The status strip shows the up and down periods.
+	chartStripTop    = 0
+	chartStripHeight = 20
+
+	// The plot shows the response times.
+	chartPlotTop    = 35
+	chartPlotBottom = 210
+
+	// chartBuckets is the number of points of the response time
+	// line. Checks within a bucket are averaged.
+	chartBuckets = 200
+
+	chartDateFormat = "Jan 2, 2006 3:04 PM"
+)
+
+// TimeRange is the period of time shown on a page.
+type TimeRange struct {
+	// Name identifies presets (such as "24h").
+	Name     string
+	From, To time.Time
+}
+
+// Duration returns the length of the range.
+func (r TimeRange) Duration() time.Duration {
+	return r.To.Sub(r.From)
+}
+
+// timeRangePresets are the ranges that can be selected. The
+// first one is the default.
+var timeRangePresets = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// TimeRangeNames returns the names of all presets.
+func TimeRangeNames() []string {
+	names := []string{}
+	for _, preset := range timeRangePresets {
+		names = append(names, preset.Name)
+	}
+
+	return names
+}
+
+// NewTimeRange returns the preset name ending at now. If there is
+// no such preset, the default is returned and ok is false.
+func NewTimeRange(name string, now time.Time) (r TimeRange, ok bool) {
+	preset := timeRangePresets[0]
+	for _, p := range timeRangePresets {
+		if p.Name == name {
+			preset, ok = p, true
+			break
+		}
+	}
+
+	return TimeRange{preset.Name, now.Add(-preset.Duration), now}, ok
+}
+
+// CustomTimeRange is the name of ranges that are not a preset.
+const CustomTimeRange = "custom"
+
+// customRangeFormat is the format of the dates of custom ranges
+// (as submitted by <input type="date">).
+const customRangeFormat = "2006-01-02"
+
+// maxCustomRange is the longest range that can be selected.
+const maxCustomRange = 366 * 24 * time.Hour
+
+// ParseTimeRange returns the range selected by the query parameter
+// "range". Custom ranges ("range=custom") are selected by "from" and
+// "to" (both dates, "to" is inclusive) and must not end after now.
+func ParseTimeRange(query url.Values, now time.Time) (TimeRange, error) {
+	if query.Get("range") != CustomTimeRange {
+		r, _ := NewTimeRange(query.Get("range"), now)
+		return r, nil
+	}
+
+	from, err := time.ParseInLocation(customRangeFormat, query.Get("from"), now.Location())
+	if err != nil {
+		return TimeRange{}, errors.New("Please enter a valid start date.")
+	}
+
+	to, err := time.ParseInLocation(customRangeFormat, query.Get("to"), now.Location())
+	if err != nil {
+		return TimeRange{}, errors.New("Please enter a valid end date.")
+	}
+
+	to = to.AddDate(0, 0, 1)
+	if to.After(now) {
+		to = now
+	}
+
+	r := TimeRange{CustomTimeRange, from, to}
+	if !r.To.After(r.From) {
+		return TimeRange{}, errors.New("The start date needs to be before the end date.")
+	} else if r.Duration() > maxCustomRange {
+		return TimeRange{}, errors.New("The range cannot be longer than a year.")
+	}
+
+	return r, nil
+}
+
+// ChartPeriod is a period in which the monitor was in one state.
+type ChartPeriod struct {
+	X, Width float64
+	Event    EventType
+	Title    string
+}
+
+// ChartTick is a label on one of the axes.
+type ChartTick struct {
+	X, Y  float64
+	Label string
+}
+
+// UptimeChart contains everything needed to render the chart
+// as SVG (see monitors/view.html).
+type UptimeChart struct {
+	Width, Height int
+	PlotLeft      float64
+	PlotRight     float64
+	PlotTop       float64
+	PlotBottom    float64
+	StripTop      float64
+	StripHeight   float64
+
+	Periods []ChartPeriod
+
+	// Lines contains the points of the response time line. The
+	// line is interrupted where there are no successful checks.
+	Lines  []string
+	XTicks []ChartTick
+	YTicks []ChartTick
+
+	// Empty is true if there are no successful checks
+	// in the range.
+	Empty bool
+}
+
+// NewUptimeChart creates the chart for the range. initial is the
+// latest event before the range begins (or nil if there is none),
+// logs and checks need to be ordered by date (oldest first).
+func NewUptimeChart(r TimeRange, initial *MonitorLog, logs []MonitorLog, checks []MonitorCheck) UptimeChart {
+	c := UptimeChart{
+		Width:       chartWidth,
+		Height:      chartHeight,
+		PlotLeft:    chartMarginLeft,
+		PlotRight:   chartWidth - chartMarginRight,
+		PlotTop:     chartPlotTop,
+		PlotBottom:  chartPlotBottom,
+		StripTop:    chartStripTop,
+		StripHeight: chartStripHeight,
+	}
+
+	c.addPeriods(r, initial, logs)
+	c.addResponseTimes(r, checks)
+	c.addXTicks(r)
+	return c
+}
+
+// x returns the horizontal position of t.
+func (c *UptimeChart) x(r TimeRange, t time.Time) float64 {
+	ratio := float64(t.Sub(r.From)) / float64(r.Duration())
+	ratio = math.Max(0, math.Min(1, ratio))
+	return roundChart(c.PlotLeft + ratio*(c.PlotRight-c.PlotLeft))
+}
+
+// addPeriods adds a period for every state the monitor was in.
+func (c *UptimeChart) addPeriods(r TimeRange, initial *MonitorLog, logs []MonitorLog) {
+	type change struct {
+		date  time.Time
+		event EventType
+	}
+
+	changes := []change{}
+	if initial != nil {
+		changes = append(changes, change{r.From, initial.Event})
+	}
+
+	for _, l := range logs {
+		changes = append(changes, change{l.Date, l.Event})
+	}
+
+	for i, ch := range changes {
+		end := r.To
+		if i+1 < len(changes) {
+			end = changes[i+1].date
+		}
+
+		x, endX := c.x(r, ch.date), c.x(r, end)
+		if endX <= x {
+			continue
+		}
+
+		c.Periods = append(c.Periods, ChartPeriod{
+			X:     x,
+			Width: roundChart(endX - x),
+			Event: ch.event,
+			Title: fmt.Sprintf("%v: %v – %v", ch.event.ShortName(),
+				ch.date.Format(chartDateFormat), end.Format(chartDateFormat)),
+		})
+	}
+}
+
+// addResponseTimes adds the line of the average response times of
+// all successful checks along with the labels of the y axis.
+func (c *UptimeChart) addResponseTimes(r TimeRange, checks []MonitorCheck) {
+	c.Empty = true
+	var sums [chartBuckets]time.Duration
+	var counts [chartBuckets]int
+	var max time.Duration
+	for _, check := range checks {
+		if !check.Up || check.Date.Before(r.From) || check.Date.After(r.To) {
+			continue
+		}
+
+		i := int(float64(check.Date.Sub(r.From)) / float64(r.Duration()) * chartBuckets)
+		if i >= chartBuckets {
+			i = chartBuckets - 1
+		}
+
+		sums[i] += check.Duration
+		counts[i]++
+		c.Empty = false
+	}
+
+	for i := range sums {
+		if counts[i] > 0 && sums[i]/time.Duration(counts[i]) > max {
+			max = sums[i] / time.Duration(counts[i])
+		}
+	}
+
+	scale := niceDuration(max)
+	for _, f := range []float64{0, 0.5, 1} {
+		c.YTicks = append(c.YTicks, ChartTick{
+			X:     c.PlotLeft - 5,
+			Y:     c.y(time.Duration(f*float64(scale)), scale),
+			Label: formatChartDuration(time.Duration(f * float64(scale))),
+		})
+	}
+
+	bucketWidth := r.Duration() / chartBuckets
+	points := []string{}
+	for i := range sums {
+		if counts[i] == 0 {
+			if len(points) > 0 {
+				c.Lines = append(c.Lines, strings.Join(points, " "))
+				points = []string{}
+			}
+			continue
+		}
+
+		center := r.From.Add(time.Duration(i)*bucketWidth + bucketWidth/2)
+		avg := sums[i] / time.Duration(counts[i])
+		points = append(points, fmt.Sprintf("%v,%v", c.x(r, center), c.y(avg, scale)))
+	}
+
+	if len(points) > 0 {
+		c.Lines = append(c.Lines, strings.Join(points, " "))
+	}
+}
+
+// y returns the vertical position of d if scale is the
+// maximum of the axis.
+func (c *UptimeChart) y(d, scale time.Duration) float64 {
+	ratio := float64(d) / float64(scale)
+	return roundChart(c.PlotBottom - ratio*(c.PlotBottom-c.PlotTop))
+}
+
+func (c *UptimeChart) addXTicks(r TimeRange) {
+	format := "Jan 2"
+	if r.Duration() <= 24*time.Hour {
+		format = "3:04 PM"
+	}
+
+	const ticks = 4
+	for i := 0; i <= ticks; i++ {
+		t := r.From.Add(r.Duration() * time.Duration(i) / ticks)
+		c.XTicks = append(c.XTicks, ChartTick{
+			X:     c.x(r, t),
+			Y:     c.PlotBottom + 20,
+			Label: t.Format(format),
+		})
+	}
+}
+
+// niceDuration rounds d up to 1, 2 or 5 times a power of ten
+// milliseconds (but at least 10ms) so that the axis is readable.
+func niceDuration(d time.Duration) time.Duration {
+	ms := float64(d) / float64(time.Millisecond)
+	if ms <= 10 {
+		return 10 * time.Millisecond
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(ms)))
+	for _, f := range []float64{1, 2, 5, 10} {
+		if ms <= f*magnitude {
+			return time.Duration(f * magnitude * float64(time.Millisecond))
+		}
+	}
+
+	return d
+}
+
+// formatChartDuration formats d as milliseconds or seconds.
+func formatChartDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%d ms", d/time.Millisecond)
+	}
+
+	return fmt.Sprintf("%g s", d.Seconds())
+}
+
+// roundChart rounds to one decimal place to keep the SVG small.
+func roundChart(f float64) float64 {
+	return math.Floor(f*10+0.5) / 10
+}
+
+// loadUptimeChart loads the logs and checks of the monitor
+// within the range and creates the chart.
+func loadUptimeChart(q queryer, monitorID int, r TimeRange) (UptimeChart, error) {
+	initial := &MonitorLog{}
+	err := q.Model(initial).Where("monitor_id = ? AND date < ?", monitorID, r.From).
+		Order("date DESC, id DESC").Limit(1).Select()
+	if err == pg.ErrNoRows {
+		initial = nil
+	} else if err != nil {
+		return UptimeChart{}, err
+	}
+
+	logs := []MonitorLog{}
+	err = q.Model(&logs).
+		Where("monitor_id = ? AND date >= ? AND date <= ?", monitorID, r.From, r.To).
+		Order("date ASC, id ASC").Select()
+	if err != nil {
+		return UptimeChart{}, err
+	}
+
+	// The checks are averaged by the database already since there
+	// may be hundreds of thousands of them.
+	bucket := r.Duration().Seconds() / chartBuckets
+	from := float64(r.From.UnixNano()) / float64(time.Second)
+	checks := []MonitorCheck{}
+	_, err = q.Query(&checks, `SELECT
+			to_timestamp(? + (floor((extract(epoch FROM date) - ?) / ?) + 0.5) * ?) AS date,
+			avg(duration)::bigint AS duration, true AS up
+		FROM monitor_checks
+		WHERE monitor_id = ? AND up AND date >= ? AND date <= ?
+		GROUP BY 1 ORDER BY 1`,
+		from, from, bucket, bucket, monitorID, r.From, r.To)
+	if err != nil {
+		return UptimeChart{}, err
+	}
+
+	return NewUptimeChart(r, initial, logs, checks), nil
+}
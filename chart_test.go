@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTimeRange(t *testing.T) {
+	now := time.Date(2016, 5, 22, 12, 0, 0, 0, time.UTC)
+	testcase := []struct {
+		name     string
+		expected string
+		duration time.Duration
+		ok       bool
+	}{
+		{"24h", "24h", 24 * time.Hour, true},
+		{"7d", "7d", 7 * 24 * time.Hour, true},
+		{"30d", "30d", 30 * 24 * time.Hour, true},
+		{"", "24h", 24 * time.Hour, false},
+		{"1y", "24h", 24 * time.Hour, false},
+	}
+
+	for _, row := range testcase {
+		r, ok := NewTimeRange(row.name, now)
+		if r.Name != row.expected || ok != row.ok || !r.To.Equal(now) ||
+			r.Duration() != row.duration {
+			t.Errorf("NewTimeRange(%q) => %v, %v", row.name, r, ok)
+		}
+	}
+}
+
+func TestUptimeChartPeriods(t *testing.T) {
+	now := time.Date(2016, 5, 22, 12, 0, 0, 0, time.UTC)
+	r, _ := NewTimeRange("24h", now)
+	logs := []MonitorLog{
+		{Event: MonitorDownEvent, Date: now.Add(-12 * time.Hour)},
+		{Event: MonitorUpEvent, Date: now.Add(-6 * time.Hour)},
+	}
+
+	chart := NewUptimeChart(r, &MonitorLog{Event: MonitorUpEvent}, logs, nil)
+	expected := []ChartPeriod{
+		{X: 60, Width: 365, Event: MonitorUpEvent},
+		{X: 425, Width: 182.5, Event: MonitorDownEvent},
+		{X: 607.5, Width: 182.5, Event: MonitorUpEvent},
+	}
+
+	if len(chart.Periods) != len(expected) {
+		t.Fatalf("Chart has periods %#v, wanted: %#v", chart.Periods, expected)
+	}
+
+	for i, p := range chart.Periods {
+		e := expected[i]
+		if p.X != e.X || p.Width != e.Width || p.Event != e.Event {
+			t.Errorf("Period %d: %#v, wanted: %#v", i, p, e)
+		}
+	}
+
+	if !strings.HasPrefix(chart.Periods[1].Title, "Down: May 22, 2016 12:00 AM") {
+		t.Errorf("Unexpected title: %q", chart.Periods[1].Title)
+	}
+
+	// Without any events before the range, nothing is known about
+	// the time before the first event.
+	chart = NewUptimeChart(r, nil, logs, nil)
+	if len(chart.Periods) != 2 || chart.Periods[0].X != 425 {
+		t.Errorf("Unexpected periods: %#v", chart.Periods)
+	}
+}
+
+func TestUptimeChartResponseTimes(t *testing.T) {
+	now := time.Date(2016, 5, 22, 12, 0, 0, 0, time.UTC)
+	r, _ := NewTimeRange("24h", now)
+	checks := []MonitorCheck{
+		{Date: r.From, Duration: 100 * time.Millisecond, Up: true},
+		{Date: r.From.Add(time.Minute), Duration: 300 * time.Millisecond, Up: true},
+		{Date: r.From.Add(time.Hour), Duration: 10 * time.Second, Up: false},
+		{Date: now.Add(-time.Minute), Duration: 400 * time.Millisecond, Up: true},
+	}
+
+	chart := NewUptimeChart(r, nil, nil, checks)
+	if chart.Empty {
+		t.Errorf("Chart is empty although there are successful checks")
+	}
+
+	// Both lines only consist of one bucket. The first bucket averages
+	// 200ms and the y axis ends at 500ms.
+	if len(chart.Lines) != 2 || chart.Lines[0] != "61.8,140" || chart.Lines[1] != "788.2,70" {
+		t.Errorf("Unexpected lines: %q", chart.Lines)
+	}
+
+	if n := len(chart.YTicks); n != 3 || chart.YTicks[2].Label != "500 ms" {
+		t.Errorf("Unexpected y axis: %#v", chart.YTicks)
+	}
+
+	if n := len(chart.XTicks); n != 5 || chart.XTicks[0].Label != "12:00 PM" {
+		t.Errorf("Unexpected x axis: %#v", chart.XTicks)
+	}
+
+	if chart := NewUptimeChart(r, nil, nil, checks[2:3]); !chart.Empty || len(chart.Lines) != 0 {
+		t.Errorf("Chart without successful checks is not empty: %#v", chart)
+	}
+}
+
+func TestNiceDuration(t *testing.T) {
+	testcase := []struct {
+		in, out time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{7 * time.Millisecond, 10 * time.Millisecond},
+		{11 * time.Millisecond, 20 * time.Millisecond},
+		{200 * time.Millisecond, 200 * time.Millisecond},
+		{201 * time.Millisecond, 500 * time.Millisecond},
+		{1200 * time.Millisecond, 2 * time.Second},
+		{6 * time.Second, 10 * time.Second},
+	}
+
+	for _, row := range testcase {
+		if d := niceDuration(row.in); d != row.out {
+			t.Errorf("niceDuration(%v) => %v, wanted: %v", row.in, d, row.out)
+		}
+	}
+}
+
+func TestLoadUptimeChart(t *testing.T) {
+	defer InitTestConnection(t)()
+	now := time.Now()
+	err := writeMonitorChecks([]MonitorCheck{
+		{MonitorId: 1, Date: now.Add(-2 * time.Hour), Duration: 100 * time.Millisecond, Up: true},
+		{MonitorId: 1, Date: now.Add(-2 * time.Hour), Duration: 300 * time.Millisecond, Up: true},
+		{MonitorId: 1, Date: now.Add(-time.Hour), Duration: time.Second, Up: false},
+		{MonitorId: 2, Date: now.Add(-time.Hour), Duration: time.Second, Up: true},
+	})
+	if err != nil {
+		t.Fatalf("Could not store checks: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	r, _ := NewTimeRange("24h", now)
+	chart, err := loadUptimeChart(tx, 1, r)
+	if err != nil {
+		t.Fatalf("loadUptimeChart returned an error: %v", err)
+	}
+
+	// The test data only contains logs from 2016, so the latest one
+	// (up) is used for the whole range.
+	if len(chart.Periods) != 1 || chart.Periods[0].Event != MonitorUpEvent {
+		t.Errorf("Unexpected periods: %#v", chart.Periods)
+	}
+
+	if len(chart.Lines) != 1 || strings.Contains(chart.Lines[0], " ") {
+		t.Errorf("Wanted a single averaged point, got: %q", chart.Lines)
+	}
+
+	if chart.YTicks[2].Label != "200 ms" {
+		t.Errorf("Unexpected y axis: %#v", chart.YTicks)
+	}
+}
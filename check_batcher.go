@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// DefaultCheckBatchSize is the number of checks after which
+	// the batch is written.
+	DefaultCheckBatchSize = 100
+
+	// DefaultCheckFlushInterval is the maximum time a check is
+	// kept in memory before it is written.
+	DefaultCheckFlushInterval = 10 * time.Second
+
+	// checkQueueSize is the number of checks that may be queued
+	// while a batch is being written. Further checks are dropped.
+	checkQueueSize = 1000
+)
+
+// writeMonitorChecks inserts the checks with a single statement. If
+// that fails (such as because a monitor has been deleted in the
+// meantime), every check is inserted on its own so that only the
+// invalid ones are lost. The first error is returned.
+func writeMonitorChecks(checks []MonitorCheck) error {
+	if err := db.Create(&checks); err == nil {
+		return nil
+	}
+
+	var firstErr error
+	for i := range checks {
+		if err := db.Create(&checks[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// CheckBatcher collects the results of checks and writes them in
+// batches, so that storing every check does not require a round
+// trip to the database each time.
+type CheckBatcher struct {
+	// Write stores a batch of checks.
+	Write func([]MonitorCheck) error
+
+	// BatchSize is the number of checks after which a batch
+	// is written.
+	BatchSize int
+
+	// FlushInterval is the maximum time checks are kept before
+	// they are written (even if the batch is not full).
+	FlushInterval time.Duration
+
+	checks chan MonitorCheck
+	done   chan struct{}
+}
+
+// NewCheckBatcher creates a batcher that writes to the database.
+func NewCheckBatcher() *CheckBatcher {
+	return &CheckBatcher{
+		Write:         writeMonitorChecks,
+		BatchSize:     DefaultCheckBatchSize,
+		FlushInterval: DefaultCheckFlushInterval,
+	}
+}
+
+// Start starts writing checks in the background.
+func (b *CheckBatcher) Start() {
+	b.checks = make(chan MonitorCheck, checkQueueSize)
+	b.done = make(chan struct{})
+	go b.run()
+}
+
+// Stop writes the remaining checks and waits until that is done.
+// Add must not be called afterwards.
+func (b *CheckBatcher) Stop() {
+	close(b.checks)
+	<-b.done
+}
+
+// Add queues a check for writing. It does not block; if too many
+// checks are waiting to be written, the check is dropped.
+func (b *CheckBatcher) Add(check MonitorCheck) {
+	select {
+	case b.checks <- check:
+	default:
+		log.Printf("CheckBatcher: queue is full, dropping check of monitor %d",
+			check.MonitorId)
+	}
+}
+
+func (b *CheckBatcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]MonitorCheck, 0, b.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := b.Write(batch); err != nil {
+			log.Printf("CheckBatcher: could not write %d checks: %v", len(batch), err)
+		}
+
+		batch = make([]MonitorCheck, 0, b.BatchSize)
+	}
+
+	for {
+		select {
+		case check, ok := <-b.checks:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, check)
+			if len(batch) >= b.BatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
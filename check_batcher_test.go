@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCheckWriter records every batch.
+type fakeCheckWriter struct {
+	sync.Mutex
+	batches [][]MonitorCheck
+	err     error
+}
+
+func (w *fakeCheckWriter) write(checks []MonitorCheck) error {
+	w.Lock()
+	defer w.Unlock()
+	w.batches = append(w.batches, checks)
+	return w.err
+}
+
+func (w *fakeCheckWriter) sizes() []int {
+	w.Lock()
+	defer w.Unlock()
+	sizes := []int{}
+	for _, batch := range w.batches {
+		sizes = append(sizes, len(batch))
+	}
+
+	return sizes
+}
+
+func newFakeCheckBatcher(size int, interval time.Duration) (*fakeCheckWriter, *CheckBatcher) {
+	w := &fakeCheckWriter{}
+	b := &CheckBatcher{Write: w.write, BatchSize: size, FlushInterval: interval}
+	return w, b
+}
+
+func TestCheckBatcherBatchSize(t *testing.T) {
+	w, b := newFakeCheckBatcher(3, time.Hour)
+	b.Start()
+	for i := 1; i <= 7; i++ {
+		b.Add(MonitorCheck{MonitorId: i})
+	}
+	b.Stop()
+
+	sizes := w.sizes()
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("Batches of size %v were written, wanted: [3 3 1]", sizes)
+	}
+
+	for i, check := range append(w.batches[0], w.batches[1]...) {
+		if check.MonitorId != i+1 {
+			t.Errorf("Check %d is out of order: %#v", i, check)
+		}
+	}
+}
+
+func TestCheckBatcherFlushInterval(t *testing.T) {
+	w, b := newFakeCheckBatcher(100, 5*time.Millisecond)
+	b.Start()
+	defer b.Stop()
+
+	b.Add(MonitorCheck{MonitorId: 1})
+	for i := 0; i < 100; i++ {
+		if len(w.sizes()) > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Errorf("The check has not been written after the flush interval")
+}
+
+func TestCheckBatcherWriteError(t *testing.T) {
+	defer shutupLog()()
+	w, b := newFakeCheckBatcher(1, time.Hour)
+	w.err = errors.New("database is down")
+	b.Start()
+	b.Add(MonitorCheck{MonitorId: 1})
+	b.Add(MonitorCheck{MonitorId: 2})
+	b.Stop()
+
+	if sizes := w.sizes(); len(sizes) != 2 {
+		t.Errorf("Batches of size %v were written, wanted: [1 1]", sizes)
+	}
+}
+
+func TestWriteMonitorChecks(t *testing.T) {
+	defer InitTestConnection(t)()
+	now := time.Now()
+	checks := []MonitorCheck{
+		{MonitorId: 1, Date: now, Duration: 20 * time.Millisecond, Up: true},
+		{MonitorId: 100, Date: now, Reason: "monitor does not exist"},
+		{MonitorId: 4, Date: now, Duration: time.Second, Reason: "timeout"},
+	}
+
+	if err := writeMonitorChecks(checks); err == nil {
+		t.Errorf("writeMonitorChecks did not report the invalid check")
+	}
+
+	stored := []MonitorCheck{}
+	if err := db.Model(&stored).Order("monitor_id ASC").Select(); err != nil {
+		t.Fatalf("Could not fetch checks: %v", err)
+	}
+
+	if len(stored) != 2 || stored[0].MonitorId != 1 || stored[1].MonitorId != 4 {
+		t.Fatalf("Unexpected checks have been stored: %#v", stored)
+	}
+
+	if !stored[0].Up || stored[0].Duration != 20*time.Millisecond ||
+		stored[1].Up || stored[1].Reason != "timeout" {
+		t.Errorf("Checks have not been stored correctly: %#v", stored)
+	}
+}
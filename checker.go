@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCheckTimeout is used if a monitor does not specify
+// its own timeout.
+const DefaultCheckTimeout = 10 * time.Second
+
+// Keys of the settings that are shared by all monitor types.
+const (
+	// ConfigTarget is what is being checked (like the URL
+	// or the host).
+	ConfigTarget = "target"
+
+	// ConfigTimeout is the time after which the check fails.
+	ConfigTimeout = "timeout"
+)
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	// Up is true if the server is up.
+	Up bool
+
+	// Duration is how long the check took.
+	Duration time.Duration
+
+	// Reason describes why the server is considered
+	// up or down (such as "connection refused").
+	Reason string
+}
+
+// Event returns the EventType matching the result (either
+// MonitorUpEvent or MonitorDownEvent).
+func (r CheckResult) Event() EventType {
+	if r.Up {
+		return MonitorUpEvent
+	}
+
+	return MonitorDownEvent
+}
+
+// A Checker checks whether a server is up.
+type Checker interface {
+	Check() CheckResult
+}
+
+// CheckerConfig contains the type-specific settings of
+// a monitor (such as the URL for http monitors).
+type CheckerConfig map[string]string
+
+// String returns the trimmed value for key or def if it is empty.
+func (c CheckerConfig) String(key, def string) string {
+	if v := strings.TrimSpace(c[key]); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// Required returns the trimmed value for key or an error if it
+// is empty.
+func (c CheckerConfig) Required(key string) (string, error) {
+	v := c.String(key, "")
+	if v == "" {
+		return "", fmt.Errorf("The setting %q is required", key)
+	}
+
+	return v, nil
+}
+
+// Int returns the value for key as an integer or def if it
+// is empty.
+func (c CheckerConfig) Int(key string, def int) (int, error) {
+	v := c.String(key, "")
+	if v == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("The setting %q needs to be an integer", key)
+	}
+
+	return i, nil
+}
+
+// Bool returns the value for key as a bool or def if it is
+// empty. Besides the values understood by strconv.ParseBool,
+// "on" (as sent by checkboxes) and "off" are accepted.
+func (c CheckerConfig) Bool(key string, def bool) (bool, error) {
+	switch v := strings.ToLower(c.String(key, "")); v {
+	case "":
+		return def, nil
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("The setting %q needs to be a boolean", key)
+		}
+
+		return b, nil
+	}
+}
+
+// Duration returns the value for key as a duration or def if it
+// is empty. Plain numbers are interpreted as seconds.
+func (c CheckerConfig) Duration(key string, def time.Duration) (time.Duration, error) {
+	v := c.String(key, "")
+	if v == "" {
+		return def, nil
+	}
+
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		v = fmt.Sprintf("%vs", secs)
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("The setting %q needs to be a positive duration", key)
+	}
+
+	return d, nil
+}
+
+// Timeout returns the timeout of the check.
+func (c CheckerConfig) Timeout() (time.Duration, error) {
+	return c.Duration(ConfigTimeout, DefaultCheckTimeout)
+}
+
+// CheckerFactory creates a new Checker from the config. An
+// error is returned if the config is invalid.
+type CheckerFactory func(config CheckerConfig) (Checker, error)
+
+// Kinds of CheckerFields.
+const (
+	FieldText     = "text"
+	FieldTextarea = "textarea"
+	FieldCheckbox = "checkbox"
+	FieldSelect   = "select"
+
+	// FieldPassword is a text field whose value is hidden.
+	FieldPassword = "password"
+)
+
+// CheckerField describes a type-specific setting so that it
+// can be shown in the monitor form.
+type CheckerField struct {
+	// Name is the key of the setting in the CheckerConfig.
+	Name  string
+	Label string
+
+	// Kind is one of the Field* constants.
+	Kind        string
+	Placeholder string
+	Help        string
+
+	// Choices are the options of FieldSelect fields. The
+	// first choice is the default.
+	Choices []string
+
+	// Default is used by checkboxes (either "on" or "off").
+	Default string
+}
+
+// CheckerType describes a monitor type (such as "http").
+type CheckerType struct {
+	// Name is the name of the type as it is stored in
+	// Monitor.Type.
+	Name        string
+	Description string
+
+	// TargetLabel and TargetPlaceholder describe what the
+	// target is for this type (such as the URL).
+	TargetLabel       string
+	TargetPlaceholder string
+
+	// Fields are all type-specific settings.
+	Fields []CheckerField
+
+	// New creates a checker for a monitor of this type.
+	New CheckerFactory
+}
+
+var checkerTypes = map[string]CheckerType{}
+
+// SupportedTypes is a sorted slice with the names of all
+// monitoring types such as pinging or checking for a word
+// in an http page.
+var SupportedTypes = []string{}
+
+// RegisterCheckerType makes a monitor type available. It is
+// meant to be called from init and panics if a type with
+// the same name has already been registered.
+func RegisterCheckerType(t CheckerType) {
+	if _, dup := checkerTypes[t.Name]; dup {
+		panic("RegisterCheckerType called twice for type " + t.Name)
+	}
+
+	checkerTypes[t.Name] = t
+	SupportedTypes = append(SupportedTypes, t.Name)
+	sort.Strings(SupportedTypes)
+}
+
+// LookupCheckerType returns the type with the given name.
+func LookupCheckerType(name string) (CheckerType, bool) {
+	t, ok := checkerTypes[name]
+	return t, ok
+}
+
+// NewChecker creates the checker for m.
+func NewChecker(m Monitor) (Checker, error) {
+	t, ok := LookupCheckerType(m.Type)
+	if !ok {
+		return nil, fmt.Errorf("Unknown monitor type: %q", m.Type)
+	}
+
+	return t.New(m.Settings.CheckerConfig())
+}
+
+// retryDelay is the time to wait before a failed check
+// is repeated.
+var retryDelay = 2 * time.Second
+
+// checkMonitor runs a single check for m. A failed check is repeated
+// up to m.Settings.Retries times. An error is returned if no checker
+// could be created for m.
+func checkMonitor(m Monitor) (CheckResult, error) {
+	checker, err := NewChecker(m)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	var result CheckResult
+	for attempt := 0; attempt <= m.Settings.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryDelay)
+		}
+
+		start := time.Now()
+		result = checker.Check()
+		if result.Duration == 0 {
+			result.Duration = time.Since(start)
+		}
+
+		if result.Up {
+			break
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of the settings of http monitors.
+const (
+	HTTPConfigMethod          = "method"
+	HTTPConfigHeaders         = "headers"
+	HTTPConfigExpectedStatus  = "expected_status"
+	HTTPConfigFollowRedirects = "follow_redirects"
+	HTTPConfigMaxRedirects    = "max_redirects"
+	HTTPConfigMaxBodySize     = "max_body_size"
+)
+
+const (
+	defaultExpectedStatus = "200-299"
+	defaultMaxRedirects   = 10
+
+	// defaultMaxBodySize is the maximum number of bytes
+	// that are read for checking the body (1 MiB).
+	defaultMaxBodySize = 1 << 20
+)
+
+// httpCheckTransport is shared by all http checks. Keep-alives are
+// disabled so that every check opens a new connection (otherwise,
+// a server that stopped accepting connections might still be up).
+var httpCheckTransport http.RoundTripper = &http.Transport{
+	Proxy:             http.ProxyFromEnvironment,
+	DisableKeepAlives: true,
+}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min, Max int
+}
+
+// Contains is true if code is in the range.
+func (r StatusRange) Contains(code int) bool {
+	return r.Min <= code && code <= r.Max
+}
+
+// ParseStatusRanges parses a comma separated list of status codes
+// and ranges such as "200-299, 301".
+func ParseStatusRanges(s string) ([]StatusRange, error) {
+	ranges := []StatusRange{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		max := min
+		if err == nil && len(bounds) == 2 {
+			max, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+
+		if err != nil || min < 100 || max > 599 || min > max {
+			return nil, fmt.Errorf("Invalid status code range: %q", part)
+		}
+
+		ranges = append(ranges, StatusRange{min, max})
+	}
+
+	if len(ranges) == 0 {
+		return nil, errors.New("At least one expected status code is required")
+	}
+
+	return ranges, nil
+}
+
+// ParseHeaders parses one header per line ("Name: value").
+func ParseHeaders(s string) (http.Header, error) {
+	header := http.Header{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("Invalid header: %q", line)
+		}
+
+		header.Add(name, strings.TrimSpace(parts[1]))
+	}
+
+	return header, nil
+}
+
+// A BodyAssertion checks the body of a response. It returns an
+// error describing why the body is not as expected. Only the
+// first HTTPChecker.MaxBodySize bytes are passed; truncated is
+// true if the body has been longer than that.
+type BodyAssertion interface {
+	Assert(body []byte, truncated bool) error
+}
+
+// HTTPChecker requests a URL and checks the status code
+// (and optionally the body) of the response.
+type HTTPChecker struct {
+	URL     string
+	Method  string
+	Header  http.Header
+	Timeout time.Duration
+
+	// ExpectedStatus contains all status codes that are
+	// considered to be up.
+	ExpectedStatus []StatusRange
+
+	// FollowRedirects determines whether redirects are followed
+	// (at most MaxRedirects times). If not, the status code of the
+	// redirect itself is checked.
+	FollowRedirects bool
+	MaxRedirects    int
+
+	// Assertion checks the body if it is not nil. At most
+	// MaxBodySize bytes of the body are read.
+	Assertion   BodyAssertion
+	MaxBodySize int
+
+	// Transport is used for making the request. If nil,
+	// httpCheckTransport will be used.
+	Transport http.RoundTripper
+}
+
+// NewHTTPChecker creates an HTTPChecker from the config.
+func NewHTTPChecker(config CheckerConfig) (*HTTPChecker, error) {
+	rawURL, err := config.Required(ConfigTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Invalid http(s) URL: %q", rawURL)
+	}
+
+	c := &HTTPChecker{URL: u.String()}
+	c.Method = strings.ToUpper(config.String(HTTPConfigMethod, "GET"))
+	if strings.ContainsAny(c.Method, " \t\r\n") {
+		return nil, fmt.Errorf("Invalid http method: %q", c.Method)
+	}
+
+	if c.Header, err = ParseHeaders(config[HTTPConfigHeaders]); err != nil {
+		return nil, err
+	}
+
+	if c.Timeout, err = config.Timeout(); err != nil {
+		return nil, err
+	}
+
+	expected := config.String(HTTPConfigExpectedStatus, defaultExpectedStatus)
+	if c.ExpectedStatus, err = ParseStatusRanges(expected); err != nil {
+		return nil, err
+	}
+
+	c.FollowRedirects, err = config.Bool(HTTPConfigFollowRedirects, true)
+	if err != nil {
+		return nil, err
+	}
+
+	c.MaxRedirects, err = config.Int(HTTPConfigMaxRedirects, defaultMaxRedirects)
+	if err != nil {
+		return nil, err
+	} else if c.MaxRedirects < 0 {
+		return nil, errors.New("The number of redirects cannot be negative")
+	}
+
+	c.MaxBodySize, err = config.Int(HTTPConfigMaxBodySize, defaultMaxBodySize)
+	if err != nil {
+		return nil, err
+	} else if c.MaxBodySize <= 0 {
+		return nil, errors.New("The maximum body size needs to be positive")
+	}
+
+	return c, nil
+}
+
+func (c *HTTPChecker) checkRedirect(req *http.Request, via []*http.Request) error {
+	if !c.FollowRedirects {
+		return http.ErrUseLastResponse
+	}
+
+	if len(via) >= c.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", c.MaxRedirects)
+	}
+
+	return nil
+}
+
+// statusExpected is true if code is one of the expected codes.
+func (c *HTTPChecker) statusExpected(code int) bool {
+	for _, r := range c.ExpectedStatus {
+		if r.Contains(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check requests the URL and checks the response's status code.
+func (c *HTTPChecker) Check() CheckResult {
+	result := CheckResult{}
+	req, err := http.NewRequest(c.Method, c.URL, nil)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+
+	for name, values := range c.Header {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = values[0]
+		} else {
+			req.Header[name] = values
+		}
+	}
+
+	transport := c.Transport
+	if transport == nil {
+		transport = httpCheckTransport
+	}
+
+	client := &http.Client{
+		Transport:     transport,
+		Timeout:       c.Timeout,
+		CheckRedirect: c.checkRedirect,
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Reason = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	// Read the body (or at least a bit of it) so that the time it
+	// takes to send the response is included in the duration.
+	var body []byte
+	if c.Assertion != nil {
+		limit := io.LimitReader(resp.Body, int64(c.MaxBodySize)+1)
+		body, err = ioutil.ReadAll(limit)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, resp.Body, 4096)
+	}
+	result.Duration = time.Since(start)
+
+	if !c.statusExpected(resp.StatusCode) {
+		result.Reason = "Unexpected status: " + resp.Status
+		return result
+	}
+
+	if err != nil && err != io.EOF {
+		result.Reason = "Error while reading the body: " + err.Error()
+		return result
+	}
+
+	if c.Assertion != nil {
+		truncated := len(body) > c.MaxBodySize
+		if truncated {
+			body = body[:c.MaxBodySize]
+		}
+
+		if err := c.Assertion.Assert(body, truncated); err != nil {
+			result.Reason = err.Error()
+			return result
+		}
+	}
+
+	result.Up = true
+	result.Reason = resp.Status
+	return result
+}
+
+// httpFields are the settings shared by all http modes.
+var httpFields = []CheckerField{
+	{Name: HTTPConfigMethod, Label: "Method", Kind: FieldText,
+		Placeholder: "GET"},
+	{Name: HTTPConfigHeaders, Label: "Headers", Kind: FieldTextarea,
+		Placeholder: "Authorization: Basic dXNlcjpwYXNz",
+		Help:        "One header per line."},
+	{Name: HTTPConfigExpectedStatus, Label: "Expected status", Kind: FieldText,
+		Placeholder: defaultExpectedStatus,
+		Help:        "Comma separated status codes and ranges."},
+	{Name: HTTPConfigFollowRedirects, Label: "Follow redirects",
+		Kind: FieldCheckbox, Default: "on"},
+	{Name: HTTPConfigMaxRedirects, Label: "Maximum redirects", Kind: FieldText,
+		Placeholder: strconv.Itoa(defaultMaxRedirects)},
+}
+
+// maxBodySizeField is used by all modes that check the body.
+var maxBodySizeField = CheckerField{
+	Name: HTTPConfigMaxBodySize, Label: "Maximum body size", Kind: FieldText,
+	Placeholder: strconv.Itoa(defaultMaxBodySize),
+	Help:        "Only this many bytes of the body are checked.",
+}
+
+// registerHTTPCheckerType registers a mode of the http checker. The
+// settings of all http checks are added to t.Fields. assertion parses
+// the config of the mode and may be nil for plain http checks.
+func registerHTTPCheckerType(t CheckerType, assertion func(CheckerConfig) (BodyAssertion, error)) {
+	t.TargetLabel = "URL"
+	t.TargetPlaceholder = "https://example.com/"
+	t.Fields = append(append([]CheckerField{}, httpFields...), t.Fields...)
+	t.New = func(config CheckerConfig) (Checker, error) {
+		c, err := NewHTTPChecker(config)
+		if err != nil {
+			return nil, err
+		}
+
+		if assertion != nil {
+			if c.Assertion, err = assertion(config); err != nil {
+				return nil, err
+			}
+		}
+
+		return c, nil
+	}
+
+	RegisterCheckerType(t)
+}
+
+func init() {
+	registerHTTPCheckerType(CheckerType{
+		Name:        "http",
+		Description: "Checks the status code of an HTTP(S) URL.",
+	}, nil)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustHTTPChecker(t *testing.T, config CheckerConfig) *HTTPChecker {
+	c, err := NewHTTPChecker(config)
+	if err != nil {
+		t.Fatalf("NewHTTPChecker(%v) returned an error: %v", config, err)
+	}
+
+	return c
+}
+
+func newHTTPCheckServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "error", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" || r.Header.Get("X-Token") != "secret" ||
+			r.Host != "example.com" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestHTTPChecker(t *testing.T) {
+	server := newHTTPCheckServer()
+	defer server.Close()
+
+	testcase := []struct {
+		config CheckerConfig
+		up     bool
+		reason string
+	}{
+		{CheckerConfig{"target": "/ok"}, true, "200 OK"},
+		{CheckerConfig{"target": "/error"}, false,
+			"Unexpected status: 503 Service Unavailable"},
+		{CheckerConfig{"target": "/error", "expected_status": "200, 500-503"},
+			true, "503 Service Unavailable"},
+		{CheckerConfig{"target": "/redirect"}, true, "200 OK"},
+		{CheckerConfig{"target": "/redirect", "follow_redirects": "off"},
+			false, "Unexpected status: 302 Found"},
+		{CheckerConfig{"target": "/redirect", "follow_redirects": "off",
+			"expected_status": "302"}, true, "302 Found"},
+		{CheckerConfig{"target": "/loop", "max_redirects": "3"},
+			false, "stopped after 3 redirects"},
+		{CheckerConfig{"target": "/slow", "timeout": "50ms"},
+			false, "Client.Timeout exceeded"},
+		{CheckerConfig{"target": "/echo", "method": "head",
+			"headers": "X-Token: secret\nHost: example.com"}, true, "200 OK"},
+		{CheckerConfig{"target": "/echo"}, false, "400 Bad Request"},
+	}
+
+	for _, row := range testcase {
+		row.config["target"] = server.URL + row.config["target"]
+		result := mustHTTPChecker(t, row.config).Check()
+		if result.Up != row.up || !strings.Contains(result.Reason, row.reason) {
+			msg := "Check(%v) => (up=%v, %q), wanted: (up=%v, %q)"
+			t.Errorf(msg, row.config, result.Up, result.Reason, row.up, row.reason)
+		}
+
+		if result.Duration <= 0 {
+			t.Errorf("Check(%v) did not measure the duration", row.config)
+		}
+	}
+}
+
+func TestHTTPCheckerConnectionRefused(t *testing.T) {
+	server := newHTTPCheckServer()
+	url := server.URL
+	server.Close()
+
+	result := mustHTTPChecker(t, CheckerConfig{"target": url}).Check()
+	if result.Up || !strings.Contains(result.Reason, "connection refused") {
+		t.Errorf("Check() => (up=%v, %q), wanted to be down", result.Up, result.Reason)
+	}
+}
+
+func TestNewHTTPCheckerDefaults(t *testing.T) {
+	c := mustHTTPChecker(t, CheckerConfig{"target": "https://example.com"})
+	if c.Method != "GET" {
+		t.Errorf("Method: %q, wanted: GET", c.Method)
+	}
+
+	if c.Timeout != DefaultCheckTimeout {
+		t.Errorf("Timeout: %v, wanted: %v", c.Timeout, DefaultCheckTimeout)
+	}
+
+	if !c.FollowRedirects || c.MaxRedirects != defaultMaxRedirects {
+		t.Errorf("Unexpected redirect policy: %v, %v", c.FollowRedirects, c.MaxRedirects)
+	}
+
+	if len(c.ExpectedStatus) != 1 || c.ExpectedStatus[0] != (StatusRange{200, 299}) {
+		t.Errorf("Unexpected status ranges: %v", c.ExpectedStatus)
+	}
+}
+
+func TestNewHTTPCheckerInvalid(t *testing.T) {
+	testcase := []CheckerConfig{
+		{},
+		{"target": "example.com"},
+		{"target": "ftp://example.com"},
+		{"target": "http://"},
+		{"target": "http://example.com", "method": "GE T"},
+		{"target": "http://example.com", "headers": "no colon"},
+		{"target": "http://example.com", "timeout": "-1"},
+		{"target": "http://example.com", "expected_status": "2xx"},
+		{"target": "http://example.com", "follow_redirects": "maybe"},
+		{"target": "http://example.com", "max_redirects": "-1"},
+		{"target": "http://example.com", "max_body_size": "0"},
+	}
+
+	for _, config := range testcase {
+		if _, err := NewHTTPChecker(config); err == nil {
+			t.Errorf("NewHTTPChecker(%v) did not return an error", config)
+		}
+	}
+}
+
+func TestParseStatusRanges(t *testing.T) {
+	testcase := []struct {
+		in  string
+		out []StatusRange
+	}{
+		{"200", []StatusRange{{200, 200}}},
+		{"200-299", []StatusRange{{200, 299}}},
+		{" 200 - 299, 301,", []StatusRange{{200, 299}, {301, 301}}},
+		{"", nil},
+		{"299-200", nil},
+		{"600", nil},
+		{"abc", nil},
+	}
+
+	for _, row := range testcase {
+		ranges, err := ParseStatusRanges(row.in)
+		if row.out == nil {
+			if err == nil {
+				t.Errorf("ParseStatusRanges(%q) did not return an error", row.in)
+			}
+			continue
+		}
+
+		if err != nil || len(ranges) != len(row.out) {
+			t.Errorf("ParseStatusRanges(%q) => %v, %v", row.in, ranges, err)
+			continue
+		}
+
+		for i := range ranges {
+			if ranges[i] != row.out[i] {
+				t.Errorf("ParseStatusRanges(%q) => %v, wanted: %v", row.in, ranges, row.out)
+			}
+		}
+	}
+}
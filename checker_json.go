@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONConfigAssertions is the key of the assertions of
+// http-json monitors (one assertion per line).
+const JSONConfigAssertions = "json_assertions"
+
+// jsonOperators are all supported comparison operators. Longer
+// operators need to come first so that "<=" is not parsed as "<".
+var jsonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// JSONAssertion is a single assertion such as `$.status == "ok"`.
+// It consists of a path, an operator and a JSON value. If the
+// operator is omitted (`$.ready`), the value at the path needs to
+// exist and must neither be null nor false.
+type JSONAssertion struct {
+	Expr string
+
+	// Path contains the keys (strings) and indices (ints)
+	// leading to the value.
+	Path     []interface{}
+	Operator string
+	Value    interface{}
+}
+
+// ParseJSONAssertion parses a single assertion.
+func ParseJSONAssertion(expr string) (*JSONAssertion, error) {
+	expr = strings.TrimSpace(expr)
+	a := &JSONAssertion{Expr: expr}
+
+	path, rest, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid assertion %q: %v", expr, err)
+	}
+	a.Path = path
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return a, nil
+	}
+
+	for _, op := range jsonOperators {
+		if strings.HasPrefix(rest, op) {
+			a.Operator = op
+			break
+		}
+	}
+
+	if a.Operator == "" {
+		return nil, fmt.Errorf("Invalid assertion %q: unknown operator", expr)
+	}
+
+	literal := strings.TrimSpace(rest[len(a.Operator):])
+	if err := decodeJSON([]byte(literal), &a.Value); err != nil {
+		return nil, fmt.Errorf("Invalid assertion %q: %q is not a JSON value", expr, literal)
+	}
+
+	switch a.Value.(type) {
+	case json.Number, string:
+	default:
+		if a.Operator != "==" && a.Operator != "!=" {
+			msg := "Invalid assertion %q: %v can only compare numbers and strings"
+			return nil, fmt.Errorf(msg, expr, a.Operator)
+		}
+	}
+
+	return a, nil
+}
+
+// parseJSONPath parses a path like `$.items[0]["name"]` at the
+// beginning of s and returns the remaining string.
+func parseJSONPath(s string) ([]interface{}, string, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, "", errors.New("path needs to start with $")
+	}
+
+	path := []interface{}{}
+	s = s[1:]
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			end := 1
+			for end < len(s) && isJSONPathChar(s[end]) {
+				end++
+			}
+
+			if end == 1 {
+				return nil, "", errors.New("missing key after '.'")
+			}
+
+			path = append(path, s[1:end])
+			s = s[end:]
+
+		case '[':
+			segment, rest, err := parseJSONPathIndex(s[1:])
+			if err != nil {
+				return nil, "", err
+			}
+
+			path = append(path, segment)
+			s = rest
+
+		default:
+			return path, s, nil
+		}
+	}
+
+	return path, s, nil
+}
+
+// parseJSONPathIndex parses the index (or the quoted key) after a
+// '[' along with the closing ']' and returns the remaining string.
+func parseJSONPathIndex(s string) (interface{}, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, "", errors.New("missing ']'")
+		}
+
+		inner := strings.TrimSpace(s[:end])
+		if i, err := strconv.Atoi(inner); err == nil && i >= 0 {
+			return i, s[end+1:], nil
+		}
+
+		return nil, "", fmt.Errorf("invalid index %q", inner)
+	}
+
+	// The key may contain ']', so the closing quote is searched
+	// first.
+	end := 1
+	for ; end < len(s) && s[end] != '"'; end++ {
+		if s[end] == '\\' {
+			end++
+		}
+	}
+
+	if end >= len(s) {
+		return nil, "", errors.New("missing closing quote")
+	}
+
+	key, err := strconv.Unquote(s[:end+1])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid key %s", s[:end+1])
+	}
+
+	s = strings.TrimLeft(s[end+1:], " \t")
+	if !strings.HasPrefix(s, "]") {
+		return nil, "", errors.New("missing ']'")
+	}
+
+	return key, s[1:], nil
+}
+
+func isJSONPathChar(c byte) bool {
+	return c == '_' || c == '-' || ('0' <= c && c <= '9') ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// decodeJSON decodes data while keeping numbers as json.Number.
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	// More does not notice stray closing brackets, so the rest
+	// of the data has to be decoded.
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+
+	return nil
+}
+
+// lookup returns the value at the path and whether it exists.
+func (a *JSONAssertion) lookup(doc interface{}) (interface{}, bool) {
+	for _, elem := range a.Path {
+		switch elem := elem.(type) {
+		case string:
+			object, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			if doc, ok = object[elem]; !ok {
+				return nil, false
+			}
+
+		case int:
+			array, ok := doc.([]interface{})
+			if !ok || elem >= len(array) {
+				return nil, false
+			}
+
+			doc = array[elem]
+		}
+	}
+
+	return doc, true
+}
+
+// Eval evaluates the assertion against the decoded document.
+// The error describes why the assertion failed.
+func (a *JSONAssertion) Eval(doc interface{}) error {
+	value, ok := a.lookup(doc)
+	if !ok {
+		return fmt.Errorf("Assertion failed: %v (not found)", a.Expr)
+	}
+
+	got, _ := json.Marshal(value)
+	failed := fmt.Errorf("Assertion failed: %v (got %s)", a.Expr, got)
+	if a.Operator == "" {
+		if value == nil || value == false {
+			return failed
+		}
+
+		return nil
+	}
+
+	var cmp int
+	switch want := a.Value.(type) {
+	case json.Number:
+		have, ok := value.(json.Number)
+		if !ok {
+			return compareOrEqual(a, value, failed)
+		}
+
+		x, errX := have.Float64()
+		y, errY := want.Float64()
+		if errX != nil || errY != nil {
+			return failed
+		}
+
+		cmp = compareFloats(x, y)
+
+	case string:
+		have, ok := value.(string)
+		if !ok {
+			return compareOrEqual(a, value, failed)
+		}
+
+		cmp = strings.Compare(have, want)
+
+	default:
+		return compareOrEqual(a, value, failed)
+	}
+
+	var passed bool
+	switch a.Operator {
+	case "==":
+		passed = cmp == 0
+	case "!=":
+		passed = cmp != 0
+	case "<":
+		passed = cmp < 0
+	case "<=":
+		passed = cmp <= 0
+	case ">":
+		passed = cmp > 0
+	case ">=":
+		passed = cmp >= 0
+	}
+
+	if !passed {
+		return failed
+	}
+
+	return nil
+}
+
+// compareOrEqual is used if the values cannot be ordered. In that
+// case, only == and != are meaningful.
+func compareOrEqual(a *JSONAssertion, value interface{}, failed error) error {
+	equal := reflect.DeepEqual(value, a.Value)
+	if (a.Operator == "==" && equal) || (a.Operator == "!=" && !equal) {
+		return nil
+	}
+
+	return failed
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// JSONAssertions checks that a JSON body satisfies all assertions.
+type JSONAssertions []*JSONAssertion
+
+// NewJSONAssertions parses the assertions in the config.
+func NewJSONAssertions(config CheckerConfig) (JSONAssertions, error) {
+	assertions := JSONAssertions{}
+	for _, line := range strings.Split(config[JSONConfigAssertions], "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		a, err := ParseJSONAssertion(line)
+		if err != nil {
+			return nil, err
+		}
+
+		assertions = append(assertions, a)
+	}
+
+	if len(assertions) == 0 {
+		return nil, fmt.Errorf("The setting %q is required", JSONConfigAssertions)
+	}
+
+	return assertions, nil
+}
+
+// Assert decodes the body and returns the first failed assertion.
+func (assertions JSONAssertions) Assert(body []byte, truncated bool) error {
+	if truncated {
+		return fmt.Errorf("Response body exceeds %d bytes", len(body))
+	}
+
+	var doc interface{}
+	if err := decodeJSON(body, &doc); err != nil {
+		return fmt.Errorf("Response is not valid JSON: %v", err)
+	}
+
+	for _, a := range assertions {
+		if err := a.Eval(doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	t := CheckerType{
+		Name:        "http-json",
+		Description: "Checks the JSON response of an HTTP(S) API.",
+		Fields: []CheckerField{
+			{Name: JSONConfigAssertions, Label: "Assertions", Kind: FieldTextarea,
+				Placeholder: "$.status == \"ok\"\n$.db.latency_ms < 200",
+				Help:        "One assertion per line. All assertions need to pass."},
+			maxBodySizeField,
+		},
+	}
+
+	registerHTTPCheckerType(t, func(c CheckerConfig) (BodyAssertion, error) {
+		assertions, err := NewJSONAssertions(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return assertions, nil
+	})
+}
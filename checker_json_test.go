@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testHealthResponse = `{
+	"status": "ok",
+	"version": "1.2.3",
+	"ready": true,
+	"maintenance": false,
+	"db": {"latency_ms": 150, "replicas": null},
+	"queues": [{"name": "mail", "size": 3}, {"name": "jobs", "size": 120}],
+	"with space": "yes"
+}`
+
+func TestDecodeJSON(t *testing.T) {
+	var doc interface{}
+	for _, data := range []string{`{"a": 1}`, " [1, 2]\n", `"ok"`} {
+		if err := decodeJSON([]byte(data), &doc); err != nil {
+			t.Errorf("decodeJSON(%q): unexpected error: %v", data, err)
+		}
+	}
+
+	for _, data := range []string{`{"a": 1}}`, `[1]]`, `{"a": 1} {"b": 2}`, `1 x`, `{"a": 1`} {
+		if err := decodeJSON([]byte(data), &doc); err == nil {
+			t.Errorf("decodeJSON(%q): no error", data)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	testcase := []struct {
+		expr string
+		path []interface{}
+		rest string
+	}{
+		{`$`, []interface{}{}, ``},
+		{`$.items[0]["name"] == 1`, []interface{}{"items", 0, "name"}, ` == 1`},
+		{`$[ 1 ][ "a" ]`, []interface{}{1, "a"}, ``},
+		{`$["a]b"].c`, []interface{}{"a]b", "c"}, ``},
+		{`$["a\"]"]`, []interface{}{`a"]`}, ``},
+		{`$[""]`, []interface{}{""}, ``},
+	}
+
+	for _, row := range testcase {
+		path, rest, err := parseJSONPath(row.expr)
+		if err != nil || !reflect.DeepEqual(path, row.path) || rest != row.rest {
+			t.Errorf("parseJSONPath(%q) => (%#v, %q, %v), wanted: (%#v, %q)",
+				row.expr, path, rest, err, row.path, row.rest)
+		}
+	}
+
+	for _, expr := range []string{`.a`, `$.`, `$[`, `$[0`, `$["a"`, `$["a]`, `$[-1]`, `$[a]`, `$["a" b]`} {
+		if path, _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("parseJSONPath(%q) => %#v, wanted an error", expr, path)
+		}
+	}
+}
+
+func TestJSONAssertionEval(t *testing.T) {
+	var doc interface{}
+	if err := decodeJSON([]byte(testHealthResponse), &doc); err != nil {
+		t.Fatalf("Could not decode test document: %v", err)
+	}
+
+	testcase := []struct {
+		expr   string
+		passed bool
+	}{
+		{`$.status == "ok"`, true},
+		{`$.status == "degraded"`, false},
+		{`$.status != "degraded"`, true},
+		{`$.db.latency_ms < 200`, true},
+		{`$.db.latency_ms<150`, false},
+		{`$.db.latency_ms <= 150`, true},
+		{`$.db.latency_ms >= 150.0`, true},
+		{`$.db.latency_ms > 150`, false},
+		{`$.db.latency_ms == 150`, true},
+		{`$.db.replicas == null`, true},
+		{`$.db.replicas`, false},
+		{`$.db.missing`, false},
+		{`$.ready`, true},
+		{`$.ready == true`, true},
+		{`$.maintenance`, false},
+		{`$.maintenance != true`, true},
+		{`$.queues[0].name == "mail"`, true},
+		{`$.queues[1]["size"] < 100`, false},
+		{`$.queues[2]`, false},
+		{`$["with space"] == "yes"`, true},
+		{`$.version > "1.10"`, true},
+		{`$.status < 10`, false},
+		{`$.db == {"latency_ms": 150, "replicas": null}`, true},
+		{`$.status.foo`, false},
+	}
+
+	for _, row := range testcase {
+		a, err := ParseJSONAssertion(row.expr)
+		if err != nil {
+			t.Errorf("ParseJSONAssertion(%q) returned an error: %v", row.expr, err)
+			continue
+		}
+
+		if err := a.Eval(doc); (err == nil) != row.passed {
+			t.Errorf("Eval(%q) => %v, wanted passed=%v", row.expr, err, row.passed)
+		}
+	}
+}
+
+func TestParseJSONAssertionInvalid(t *testing.T) {
+	testcase := []string{
+		``,
+		`status == "ok"`,
+		`$.`,
+		`$.status = "ok"`,
+		`$.status == ok`,
+		`$.status == "ok" "ok"`,
+		`$.items[`,
+		`$.items[-1]`,
+		`$.items[abc]`,
+		`$.ready < true`,
+	}
+
+	for _, expr := range testcase {
+		if _, err := ParseJSONAssertion(expr); err == nil {
+			t.Errorf("ParseJSONAssertion(%q) did not return an error", expr)
+		}
+	}
+}
+
+func TestHTTPJSONChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/invalid" {
+				w.Write([]byte("<html>"))
+			} else {
+				w.Write([]byte(testHealthResponse))
+			}
+		}))
+	defer server.Close()
+
+	testcase := []struct {
+		config CheckerConfig
+		up     bool
+		reason string
+	}{
+		{CheckerConfig{"json_assertions": "$.status == \"ok\"\n\n$.ready"},
+			true, "200 OK"},
+		{CheckerConfig{"json_assertions": "$.ready\n$.db.latency_ms < 100"},
+			false, "Assertion failed: $.db.latency_ms < 100 (got 150)"},
+		{CheckerConfig{"json_assertions": "$.status == \"ok\"",
+			"max_body_size": "10"}, false, "Response body exceeds 10 bytes"},
+		{CheckerConfig{"json_assertions": "$.ready", "target": "/invalid"},
+			false, "Response is not valid JSON"},
+	}
+
+	jsonType, _ := LookupCheckerType("http-json")
+	for _, row := range testcase {
+		row.config["target"] = server.URL + row.config["target"]
+		checker, err := jsonType.New(row.config)
+		if err != nil {
+			t.Errorf("Could not create checker for %v: %v", row.config, err)
+			continue
+		}
+
+		result := checker.Check()
+		if result.Up != row.up || !strings.Contains(result.Reason, row.reason) {
+			msg := "Check(%v) => (up=%v, %q), wanted: (up=%v, %q)"
+			t.Errorf(msg, row.config, result.Up, result.Reason, row.up, row.reason)
+		}
+	}
+}
+
+func TestNewJSONAssertionsInvalid(t *testing.T) {
+	testcase := []CheckerConfig{
+		{},
+		{"json_assertions": "\n  \n"},
+		{"json_assertions": "$.ready\n$.status ~ \"ok\""},
+	}
+
+	for _, config := range testcase {
+		if _, err := NewJSONAssertions(config); err == nil {
+			t.Errorf("NewJSONAssertions(%v) did not return an error", config)
+		}
+	}
+}
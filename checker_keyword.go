@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// Keys of the settings of http-keyword monitors.
+const (
+	KeywordConfigKeyword = "keyword"
+	KeywordConfigRegexp  = "keyword_regexp"
+	KeywordConfigAbsent  = "keyword_absent"
+)
+
+// KeywordAssertion checks whether the body contains a keyword
+// or matches a regular expression.
+type KeywordAssertion struct {
+	// Keyword is the literal string to look for. It is only
+	// used if Regexp is nil.
+	Keyword string
+	Regexp  *regexp.Regexp
+
+	// Absent inverts the assertion: the server is considered
+	// to be down if the keyword is found.
+	Absent bool
+}
+
+// NewKeywordAssertion creates a KeywordAssertion from the config.
+func NewKeywordAssertion(config CheckerConfig) (*KeywordAssertion, error) {
+	// Leading and trailing spaces may be part of the keyword.
+	a := &KeywordAssertion{Keyword: config[KeywordConfigKeyword]}
+	if a.Keyword == "" {
+		return nil, fmt.Errorf("The setting %q is required", KeywordConfigKeyword)
+	}
+
+	isRegexp, err := config.Bool(KeywordConfigRegexp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if isRegexp {
+		if a.Regexp, err = regexp.Compile(a.Keyword); err != nil {
+			return nil, fmt.Errorf("Invalid regular expression: %v", err)
+		}
+	}
+
+	if a.Absent, err = config.Bool(KeywordConfigAbsent, false); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Assert checks the body. If the body has been truncated, only
+// the part that has been read is checked.
+func (a *KeywordAssertion) Assert(body []byte, truncated bool) error {
+	found := false
+	what := "Keyword"
+	if a.Regexp != nil {
+		found = a.Regexp.Match(body)
+		what = "Regular expression"
+	} else {
+		found = bytes.Contains(body, []byte(a.Keyword))
+	}
+
+	switch {
+	case found && a.Absent:
+		return fmt.Errorf("%v %q found in body", what, a.Keyword)
+	case !found && !a.Absent:
+		return fmt.Errorf("%v %q not found in body", what, a.Keyword)
+	}
+
+	return nil
+}
+
+func init() {
+	t := CheckerType{
+		Name:        "http-keyword",
+		Description: "Checks whether an HTTP(S) page contains a keyword.",
+		Fields: []CheckerField{
+			{Name: KeywordConfigKeyword, Label: "Keyword", Kind: FieldText,
+				Placeholder: "Welcome"},
+			{Name: KeywordConfigRegexp, Label: "Keyword is a regular expression",
+				Kind: FieldCheckbox, Default: "off"},
+			{Name: KeywordConfigAbsent, Label: "Down if the keyword is found",
+				Kind: FieldCheckbox, Default: "off"},
+			maxBodySizeField,
+		},
+	}
+
+	registerHTTPCheckerType(t, func(c CheckerConfig) (BodyAssertion, error) {
+		a, err := NewKeywordAssertion(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return a, nil
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPKeywordChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Status: all systems operational (build 1234)"))
+		}))
+	defer server.Close()
+
+	testcase := []struct {
+		config CheckerConfig
+		up     bool
+		reason string
+	}{
+		{CheckerConfig{"keyword": "operational"}, true, "200 OK"},
+		{CheckerConfig{"keyword": "Operational"}, false,
+			`Keyword "Operational" not found in body`},
+		{CheckerConfig{"keyword": "outage", "keyword_absent": "on"},
+			true, "200 OK"},
+		{CheckerConfig{"keyword": "operational", "keyword_absent": "on"},
+			false, `Keyword "operational" found in body`},
+		{CheckerConfig{"keyword": `build \d+`, "keyword_regexp": "on"},
+			true, "200 OK"},
+		{CheckerConfig{"keyword": `(?i)ALL SYSTEMS`, "keyword_regexp": "on"},
+			true, "200 OK"},
+		{CheckerConfig{"keyword": `build [a-z]+`, "keyword_regexp": "on"},
+			false, `Regular expression "build [a-z]+" not found in body`},
+
+		// Only the first 10 bytes are checked.
+		{CheckerConfig{"keyword": "Status", "max_body_size": "10"},
+			true, "200 OK"},
+		{CheckerConfig{"keyword": "operational", "max_body_size": "10"},
+			false, "not found in body"},
+	}
+
+	keywordType, _ := LookupCheckerType("http-keyword")
+	for _, row := range testcase {
+		row.config["target"] = server.URL
+		checker, err := keywordType.New(row.config)
+		if err != nil {
+			t.Errorf("Could not create checker for %v: %v", row.config, err)
+			continue
+		}
+
+		result := checker.Check()
+		if result.Up != row.up || !strings.Contains(result.Reason, row.reason) {
+			msg := "Check(%v) => (up=%v, %q), wanted: (up=%v, %q)"
+			t.Errorf(msg, row.config, result.Up, result.Reason, row.up, row.reason)
+		}
+	}
+}
+
+func TestNewKeywordAssertionInvalid(t *testing.T) {
+	testcase := []CheckerConfig{
+		{},
+		{"keyword": ""},
+		{"keyword": "(", "keyword_regexp": "on"},
+		{"keyword": "foo", "keyword_regexp": "maybe"},
+		{"keyword": "foo", "keyword_absent": "maybe"},
+	}
+
+	for _, config := range testcase {
+		if _, err := NewKeywordAssertion(config); err == nil {
+			t.Errorf("NewKeywordAssertion(%v) did not return an error", config)
+		}
+	}
+}
+
+func TestKeywordAssertionKeepsSpaces(t *testing.T) {
+	a, err := NewKeywordAssertion(CheckerConfig{"keyword": " ok "})
+	if err != nil {
+		t.Fatalf("NewKeywordAssertion returned an error: %v", err)
+	}
+
+	if err := a.Assert([]byte("not ok!"), false); err == nil {
+		t.Errorf("Keyword %q was found in %q", a.Keyword, "not ok!")
+	}
+
+	if err := a.Assert([]byte("it is ok now"), false); err != nil {
+		t.Errorf("Keyword %q not found: %v", a.Keyword, err)
+	}
+}
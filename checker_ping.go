@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Keys of the settings of ping monitors.
+const (
+	PingConfigCount         = "count"
+	PingConfigInterval      = "interval"
+	PingConfigLossThreshold = "loss_threshold"
+	PingConfigRTTThreshold  = "rtt_threshold"
+)
+
+const (
+	defaultPingCount    = 3
+	defaultPingInterval = 500 * time.Millisecond
+	maxPingCount        = 100
+
+	// Protocol numbers as used by icmp.ParseMessage.
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+)
+
+// lookupIPAddr resolves the hosts of ping monitors. It is replaced
+// by the tests.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// icmpSocket is an ICMP socket along with the information
+// needed for sending and parsing messages.
+type icmpSocket struct {
+	conn *icmp.PacketConn
+
+	// privileged is true for raw sockets. Datagram sockets
+	// need UDP addresses as destination and the kernel
+	// rewrites the ID of echo requests.
+	privileged bool
+	ipv6       bool
+}
+
+// listenICMP opens an unprivileged datagram ICMP socket if the
+// system allows it and falls back to a raw socket otherwise (which
+// usually requires root or CAP_NET_RAW).
+func listenICMP(ipv6 bool) (*icmpSocket, error) {
+	networks := []string{"udp4", "ip4:icmp"}
+	address := "0.0.0.0"
+	if ipv6 {
+		networks = []string{"udp6", "ip6:ipv6-icmp"}
+		address = "::"
+	}
+
+	conn, err := icmp.ListenPacket(networks[0], address)
+	if err == nil {
+		return &icmpSocket{conn: conn, ipv6: ipv6}, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(networks[1], address)
+	if rawErr != nil {
+		return nil, fmt.Errorf("Could not open ICMP socket: %v (unprivileged: %v)", rawErr, err)
+	}
+
+	return &icmpSocket{conn: conn, privileged: true, ipv6: ipv6}, nil
+}
+
+// PingChecker sends ICMP echo requests to a host. The host is down
+// if more than MaxLoss percent of the requests are lost or if the
+// average round-trip time exceeds MaxRTT (unless MaxRTT is 0).
+type PingChecker struct {
+	Host  string
+	Count int
+
+	// Interval is the time between two requests.
+	Interval time.Duration
+
+	// Timeout limits the whole check, including the lookup of the
+	// host. Every reply is awaited for at most its share of it;
+	// requests that would be sent after the timeout are not sent
+	// at all.
+	Timeout time.Duration
+
+	MaxLoss float64
+	MaxRTT  time.Duration
+}
+
+// NewPingChecker creates a PingChecker from the config.
+func NewPingChecker(config CheckerConfig) (*PingChecker, error) {
+	c := &PingChecker{}
+	var err error
+	if c.Host, err = config.Required(ConfigTarget); err != nil {
+		return nil, err
+	}
+
+	c.Count, err = config.Int(PingConfigCount, defaultPingCount)
+	if err != nil {
+		return nil, err
+	} else if c.Count <= 0 || c.Count > maxPingCount {
+		return nil, fmt.Errorf("The number of packets needs to be between 1 and %d", maxPingCount)
+	}
+
+	if c.Interval, err = config.Duration(PingConfigInterval, defaultPingInterval); err != nil {
+		return nil, err
+	}
+
+	if c.Timeout, err = config.Timeout(); err != nil {
+		return nil, err
+	}
+
+	loss, err := config.Int(PingConfigLossThreshold, 0)
+	if err != nil {
+		return nil, err
+	} else if loss < 0 || loss >= 100 {
+		return nil, errors.New("The loss threshold needs to be between 0 and 99 percent")
+	}
+	c.MaxLoss = float64(loss)
+
+	if config.String(PingConfigRTTThreshold, "") != "" {
+		if c.MaxRTT, err = config.Duration(PingConfigRTTThreshold, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// pingStats summarizes the replies of a ping check.
+type pingStats struct {
+	Sent, Received int
+	RTTs           []time.Duration
+}
+
+// Loss returns the percentage of lost packets.
+func (s pingStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 100
+	}
+
+	return float64(s.Sent-s.Received) * 100 / float64(s.Sent)
+}
+
+// AverageRTT returns the average round-trip time.
+func (s pingStats) AverageRTT() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+
+	var sum time.Duration
+	for _, rtt := range s.RTTs {
+		sum += rtt
+	}
+
+	return sum / time.Duration(len(s.RTTs))
+}
+
+// evaluate decides whether the host is up based on the stats.
+func (c *PingChecker) evaluate(s pingStats) CheckResult {
+	result := CheckResult{Duration: s.AverageRTT()}
+	result.Reason = fmt.Sprintf("%d/%d packets received, %.0f%% loss",
+		s.Received, s.Sent, s.Loss())
+	if s.Received > 0 {
+		result.Reason += fmt.Sprintf(", average rtt %v", result.Duration)
+	}
+
+	switch {
+	case s.Received == 0:
+		result.Reason = "Host unreachable: " + result.Reason
+	case s.Loss() > c.MaxLoss:
+		result.Reason = "Packet loss too high: " + result.Reason
+	case c.MaxRTT > 0 && result.Duration > c.MaxRTT:
+		result.Reason = "Round-trip time too high: " + result.Reason
+	default:
+		result.Up = true
+	}
+
+	return result
+}
+
+// resolve looks up the IP address of the host, preferring IPv4
+// addresses. The lookup is aborted once the deadline has passed.
+func (c *PingChecker) resolve(deadline time.Time) (net.IP, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	addrs, err := lookupIPAddr(ctx, c.Host)
+	if err != nil {
+		return nil, err
+	} else if len(addrs) == 0 {
+		return nil, fmt.Errorf("No address found for %s", c.Host)
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP, nil
+		}
+	}
+
+	return addrs[0].IP, nil
+}
+
+// Check pings the host.
+func (c *PingChecker) Check() CheckResult {
+	deadline := time.Now().Add(c.Timeout)
+	ip, err := c.resolve(deadline)
+	if err != nil {
+		return CheckResult{Reason: err.Error()}
+	}
+
+	// The requests may only take the time left after the lookup.
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return CheckResult{Reason: "Timeout while resolving " + c.Host}
+	}
+
+	socket, err := listenICMP(ip.To4() == nil)
+	if err != nil {
+		return CheckResult{Reason: err.Error()}
+	}
+	defer socket.conn.Close()
+
+	stats, err := socket.ping(ip, c.Count, c.Interval, remaining)
+	if err != nil {
+		return CheckResult{Reason: err.Error()}
+	}
+
+	return c.evaluate(stats)
+}
+
+// ping sends count echo requests to ip and waits for the replies.
+// It returns once timeout has passed at the latest.
+func (s *icmpSocket) ping(ip net.IP, count int, interval, timeout time.Duration) (pingStats, error) {
+	stats := pingStats{}
+	deadline := time.Now().Add(timeout)
+	wait := timeout / time.Duration(count)
+
+	// Replies are identified by the payload, since the ID of the
+	// echo request might be rewritten by the kernel.
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return stats, err
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if s.privileged {
+		dst = &net.IPAddr{IP: ip}
+	}
+
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	protocol := protocolICMP
+	if s.ipv6 {
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		protocol = protocolIPv6ICMP
+	}
+
+	id := os.Getpid() & 0xffff
+	buf := make([]byte, 1500)
+	var last time.Time
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			time.Sleep(interval - time.Since(last))
+		}
+
+		if !time.Now().Before(deadline) {
+			break
+		}
+
+		msg := icmp.Message{Type: requestType, Body: &icmp.Echo{
+			ID: id, Seq: seq, Data: token,
+		}}
+
+		packet, err := msg.Marshal(nil)
+		if err != nil {
+			return stats, err
+		}
+
+		start := time.Now()
+		last = start
+		if _, err := s.conn.WriteTo(packet, dst); err != nil {
+			return stats, fmt.Errorf("Could not send echo request: %v", err)
+		}
+		stats.Sent++
+
+		if readDeadline := start.Add(wait); readDeadline.Before(deadline) {
+			s.conn.SetReadDeadline(readDeadline)
+		} else {
+			s.conn.SetReadDeadline(deadline)
+		}
+		for {
+			n, _, err := s.conn.ReadFrom(buf)
+			if err != nil {
+				// Timeout; the packet is lost.
+				break
+			}
+
+			reply, err := icmp.ParseMessage(protocol, buf[:n])
+			if err != nil || reply.Type != replyType {
+				continue
+			}
+
+			echo, ok := reply.Body.(*icmp.Echo)
+			if !ok || echo.Seq != seq || !bytes.Equal(echo.Data, token) {
+				continue
+			}
+
+			stats.Received++
+			stats.RTTs = append(stats.RTTs, time.Since(start))
+			break
+		}
+	}
+
+	return stats, nil
+}
+
+func init() {
+	RegisterCheckerType(CheckerType{
+		Name:              "ping",
+		Description:       "Sends ICMP echo requests to a host.",
+		TargetLabel:       "Host",
+		TargetPlaceholder: "example.com",
+		Fields: []CheckerField{
+			{Name: PingConfigCount, Label: "Packets", Kind: FieldText,
+				Placeholder: strconv.Itoa(defaultPingCount)},
+			{Name: PingConfigInterval, Label: "Packet interval", Kind: FieldText,
+				Placeholder: defaultPingInterval.String()},
+			{Name: PingConfigLossThreshold, Label: "Loss threshold (%)", Kind: FieldText,
+				Placeholder: "0",
+				Help:        "Down if more packets are lost."},
+			{Name: PingConfigRTTThreshold, Label: "Round-trip time threshold", Kind: FieldText,
+				Placeholder: "200ms",
+				Help:        "Down if the average round-trip time is higher."},
+		},
+		New: func(config CheckerConfig) (Checker, error) {
+			c, err := NewPingChecker(config)
+			if err != nil {
+				return nil, err
+			}
+
+			return c, nil
+		},
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPingCheckerEvaluate(t *testing.T) {
+	ms := time.Millisecond
+	c := &PingChecker{MaxLoss: 40, MaxRTT: 100 * ms}
+	testcase := []struct {
+		stats  pingStats
+		up     bool
+		reason string
+	}{
+		{pingStats{3, 3, []time.Duration{10 * ms, 20 * ms, 30 * ms}}, true,
+			"3/3 packets received, 0% loss, average rtt 20ms"},
+		{pingStats{3, 2, []time.Duration{10 * ms, 20 * ms}}, true,
+			"2/3 packets received, 33% loss, average rtt 15ms"},
+		{pingStats{2, 1, []time.Duration{10 * ms}}, false,
+			"Packet loss too high: 1/2 packets received, 50% loss, average rtt 10ms"},
+		{pingStats{3, 0, nil}, false,
+			"Host unreachable: 0/3 packets received, 100% loss"},
+		{pingStats{2, 2, []time.Duration{150 * ms, 100 * ms}}, false,
+			"Round-trip time too high: 2/2 packets received, 0% loss, average rtt 125ms"},
+	}
+
+	for _, row := range testcase {
+		result := c.evaluate(row.stats)
+		if result.Up != row.up || result.Reason != row.reason {
+			msg := "evaluate(%v) => (up=%v, %q), wanted: (up=%v, %q)"
+			t.Errorf(msg, row.stats, result.Up, result.Reason, row.up, row.reason)
+		}
+	}
+}
+
+func TestNewPingChecker(t *testing.T) {
+	c, err := NewPingChecker(CheckerConfig{"target": "localhost"})
+	if err != nil {
+		t.Fatalf("NewPingChecker returned an error: %v", err)
+	}
+
+	if c.Count != defaultPingCount || c.Timeout != DefaultCheckTimeout ||
+		c.Interval != defaultPingInterval || c.MaxLoss != 0 || c.MaxRTT != 0 {
+		t.Errorf("Unexpected defaults: %#v", c)
+	}
+
+	c, err = NewPingChecker(CheckerConfig{"target": "localhost", "count": "5",
+		"loss_threshold": "20", "rtt_threshold": "200ms"})
+	if err != nil {
+		t.Fatalf("NewPingChecker returned an error: %v", err)
+	}
+
+	if c.Count != 5 || c.MaxLoss != 20 || c.MaxRTT != 200*time.Millisecond {
+		t.Errorf("Unexpected settings: %#v", c)
+	}
+}
+
+func TestNewPingCheckerInvalid(t *testing.T) {
+	testcase := []CheckerConfig{
+		{},
+		{"target": "localhost", "count": "0"},
+		{"target": "localhost", "count": "1000"},
+		{"target": "localhost", "loss_threshold": "100"},
+		{"target": "localhost", "loss_threshold": "-1"},
+		{"target": "localhost", "rtt_threshold": "fast"},
+		{"target": "localhost", "interval": "0"},
+	}
+
+	for _, config := range testcase {
+		if _, err := NewPingChecker(config); err == nil {
+			t.Errorf("NewPingChecker(%v) did not return an error", config)
+		}
+	}
+}
+
+func TestPingCheckerLocalhost(t *testing.T) {
+	socket, err := listenICMP(false)
+	if err != nil {
+		t.Skipf("ICMP sockets are not available: %v", err)
+	}
+	socket.conn.Close()
+
+	c, err := NewPingChecker(CheckerConfig{"target": "127.0.0.1",
+		"count": "2", "interval": "10ms"})
+	if err != nil {
+		t.Fatalf("NewPingChecker returned an error: %v", err)
+	}
+
+	result := c.Check()
+	if !result.Up || !strings.HasPrefix(result.Reason, "2/2 packets received") {
+		t.Errorf("Check() => (up=%v, %q), wanted to be up", result.Up, result.Reason)
+	}
+}
+
+func TestPingCheckerTimeout(t *testing.T) {
+	socket, err := listenICMP(false)
+	if err != nil {
+		t.Skipf("ICMP sockets are not available: %v", err)
+	}
+	socket.conn.Close()
+
+	// 192.0.2.1 is reserved for documentation, so the replies are
+	// usually lost. Sending all packets would take at least 1s.
+	c, err := NewPingChecker(CheckerConfig{"target": "192.0.2.1",
+		"count": "100", "interval": "10ms", "timeout": "200ms"})
+	if err != nil {
+		t.Fatalf("NewPingChecker returned an error: %v", err)
+	}
+
+	start := time.Now()
+	c.Check()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Check took %v, wanted at most the timeout (200ms)", elapsed)
+	}
+}
+
+func TestPingCheckerResolveTimeout(t *testing.T) {
+	defer func(f func(context.Context, string) ([]net.IPAddr, error)) {
+		lookupIPAddr = f
+	}(lookupIPAddr)
+
+	// The stub hangs until the lookup is aborted, like a DNS
+	// server that never answers.
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	c, err := NewPingChecker(CheckerConfig{"target": "example.com",
+		"timeout": "100ms"})
+	if err != nil {
+		t.Fatalf("NewPingChecker returned an error: %v", err)
+	}
+
+	start := time.Now()
+	result := c.Check()
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("Check took %v, wanted at most the timeout (100ms)", elapsed)
+	}
+
+	if result.Up {
+		t.Errorf("Check() => up, wanted to be down")
+	}
+}
+
+func TestPingCheckerResolve(t *testing.T) {
+	defer func(f func(context.Context, string) ([]net.IPAddr, error)) {
+		lookupIPAddr = f
+	}(lookupIPAddr)
+
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("2001:db8::1")},
+			{IP: net.ParseIP("192.0.2.1")}}, nil
+	}
+
+	c := &PingChecker{Host: "example.com"}
+	ip, err := c.resolve(time.Now().Add(time.Second))
+	if err != nil || !ip.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("resolve() => (%v, %v), wanted the IPv4 address", ip, err)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Keys of the settings of socket monitors.
+const (
+	SocketConfigSend         = "send"
+	SocketConfigExpect       = "expect"
+	SocketConfigExpectRegexp = "expect_regexp"
+	SocketConfigProtocol     = "protocol"
+	SocketConfigEncoding     = "payload_encoding"
+	SocketConfigRetries      = "retries"
+	SocketConfigReadTimeout  = "read_timeout"
+)
+
+const (
+	// maxSocketResponse is the maximum number of bytes read
+	// while waiting for the expected response.
+	maxSocketResponse = 64 << 10
+
+	defaultUDPRetries     = 2
+	defaultUDPReadTimeout = 2 * time.Second
+)
+
+// unescapePayload interprets Go escape sequences such as \r\n
+// or \x00 so that binary payloads can be entered as text.
+func unescapePayload(s string) ([]byte, error) {
+	buf := []byte{}
+	for len(s) > 0 {
+		c, multibyte, tail, err := strconv.UnquoteChar(s, 0)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid escape sequence in %q", s)
+		}
+
+		if multibyte {
+			var encoded [utf8.UTFMax]byte
+			n := utf8.EncodeRune(encoded[:], c)
+			buf = append(buf, encoded[:n]...)
+		} else {
+			buf = append(buf, byte(c))
+		}
+
+		s = tail
+	}
+
+	return buf, nil
+}
+
+// decodePayload decodes the setting key, which is either
+// hex encoded or text (see unescapePayload).
+func decodePayload(config CheckerConfig, key string) ([]byte, error) {
+	switch encoding := config.String(SocketConfigEncoding, "text"); encoding {
+	case "text":
+		return unescapePayload(config[key])
+
+	case "hex":
+		stripped := strings.Join(strings.Fields(config[key]), "")
+		payload, err := hex.DecodeString(stripped)
+		if err != nil {
+			return nil, fmt.Errorf("The setting %q is not valid hex", key)
+		}
+
+		return payload, nil
+
+	default:
+		return nil, fmt.Errorf("Unknown payload encoding: %q", encoding)
+	}
+}
+
+// ResponseMatcher checks the response of a server. The response
+// either needs to start with Prefix or match Regexp.
+type ResponseMatcher struct {
+	Prefix []byte
+	Regexp *regexp.Regexp
+}
+
+// Match checks the data that has been received so far. final is
+// true once more data cannot change whether the response matches.
+func (m *ResponseMatcher) Match(data []byte) (matched, final bool) {
+	if m.Regexp != nil {
+		matched = m.Regexp.Match(data)
+		return matched, matched
+	}
+
+	if len(data) >= len(m.Prefix) {
+		return bytes.HasPrefix(data, m.Prefix), true
+	}
+
+	return false, !bytes.HasPrefix(m.Prefix, data)
+}
+
+// String returns what is expected.
+func (m *ResponseMatcher) String() string {
+	if m.Regexp != nil {
+		return m.Regexp.String()
+	}
+
+	return string(m.Prefix)
+}
+
+// newResponseMatcher creates a matcher from the config or returns
+// nil if no response is expected.
+func newResponseMatcher(config CheckerConfig) (*ResponseMatcher, error) {
+	expect := config[SocketConfigExpect]
+	if expect == "" {
+		return nil, nil
+	}
+
+	isRegexp, err := config.Bool(SocketConfigExpectRegexp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ResponseMatcher{}
+	if isRegexp {
+		if m.Regexp, err = regexp.Compile(expect); err != nil {
+			return nil, fmt.Errorf("Invalid regular expression: %v", err)
+		}
+	} else if m.Prefix, err = decodePayload(config, SocketConfigExpect); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// parseSocketAddress validates a "host:port" address.
+func parseSocketAddress(config CheckerConfig) (string, error) {
+	address, err := config.Required(ConfigTarget)
+	if err != nil {
+		return "", err
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("Invalid address (host:port): %q", address)
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return "", fmt.Errorf("Invalid port: %q", port)
+	}
+
+	return address, nil
+}
+
+// summarizeResponse returns the first line of the response
+// (shortened if necessary) for showing it in the logs.
+func summarizeResponse(data []byte) string {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		data = data[:i]
+	}
+
+	if len(data) > 64 {
+		data = data[:64]
+	}
+
+	return strconv.Quote(string(data))
+}
+
+// SocketChecker connects to a TCP server. Optionally, it sends a
+// payload and checks the response (such as the banner of an SSH
+// or SMTP server).
+// For UDP, sending a payload and expecting a response is required
+// (there is no connection that could be established). The payload
+// is sent again (at most Retries times) if no valid reply has been
+// received within ReadTimeout. All attempts together take at most
+// Timeout.
+type SocketChecker struct {
+	Protocol string
+	Address  string
+	Timeout  time.Duration
+	Send     []byte
+
+	// Expect checks the response if it is not nil.
+	Expect *ResponseMatcher
+
+	Retries     int
+	ReadTimeout time.Duration
+}
+
+// NewSocketChecker creates a SocketChecker from the config.
+func NewSocketChecker(config CheckerConfig) (*SocketChecker, error) {
+	c := &SocketChecker{}
+	var err error
+	if c.Address, err = parseSocketAddress(config); err != nil {
+		return nil, err
+	}
+
+	c.Protocol = strings.ToLower(config.String(SocketConfigProtocol, "tcp"))
+	if c.Protocol != "tcp" && c.Protocol != "udp" {
+		return nil, fmt.Errorf("Unknown protocol: %q", c.Protocol)
+	}
+
+	if c.Timeout, err = config.Timeout(); err != nil {
+		return nil, err
+	}
+
+	if c.Send, err = decodePayload(config, SocketConfigSend); err != nil {
+		return nil, err
+	}
+
+	if c.Expect, err = newResponseMatcher(config); err != nil {
+		return nil, err
+	}
+
+	if c.Protocol != "udp" {
+		return c, nil
+	}
+
+	if len(c.Send) == 0 || c.Expect == nil {
+		return nil, errors.New("UDP monitors need a payload and an expected response")
+	}
+
+	c.Retries, err = config.Int(SocketConfigRetries, defaultUDPRetries)
+	if err != nil {
+		return nil, err
+	} else if c.Retries < 0 {
+		return nil, errors.New("The number of retries cannot be negative")
+	}
+
+	c.ReadTimeout, err = config.Duration(SocketConfigReadTimeout, defaultUDPReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Check connects to the server. For TCP, the duration of the result
+// is the time it took to establish the connection. For UDP, it is the
+// round-trip time of the successful attempt.
+func (c *SocketChecker) Check() CheckResult {
+	if c.Protocol == "udp" {
+		return c.checkUDP()
+	}
+
+	result := CheckResult{}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	result.Reason = fmt.Sprintf("Connected in %v", result.Duration)
+	conn.SetDeadline(start.Add(c.Timeout))
+	if len(c.Send) > 0 {
+		if _, err := conn.Write(c.Send); err != nil {
+			result.Reason = "Error while sending: " + err.Error()
+			return result
+		}
+	}
+
+	if c.Expect != nil {
+		response, matched, err := readResponse(conn, c.Expect)
+		if !matched {
+			result.Reason = fmt.Sprintf("Expected %q, got: %v",
+				c.Expect.String(), summarizeResponse(response))
+			if err != nil {
+				result.Reason += " (" + err.Error() + ")"
+			}
+
+			return result
+		}
+
+		result.Reason += ", received " + summarizeResponse(response)
+	}
+
+	result.Up = true
+	return result
+}
+
+// readResponse reads from conn until the response matches (or
+// cannot match anymore). The connection's deadline needs to be set.
+func readResponse(conn net.Conn, m *ResponseMatcher) ([]byte, bool, error) {
+	response := []byte{}
+	buf := make([]byte, 4096)
+	for len(response) < maxSocketResponse {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if matched, final := m.Match(response); final {
+			return response, matched, nil
+		}
+
+		if err != nil {
+			return response, false, err
+		}
+	}
+
+	return response, false, nil
+}
+
+func (c *SocketChecker) checkUDP() CheckResult {
+	result := CheckResult{}
+	deadline := time.Now().Add(c.Timeout)
+	conn, err := net.DialTimeout("udp", c.Address, c.Timeout)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxSocketResponse)
+	attempt := 1
+	for ; attempt <= c.Retries+1; attempt++ {
+		start := time.Now()
+		if !start.Before(deadline) {
+			break
+		}
+
+		// The retries must not extend the timeout of the check.
+		if readDeadline := start.Add(c.ReadTimeout); readDeadline.Before(deadline) {
+			conn.SetDeadline(readDeadline)
+		} else {
+			conn.SetDeadline(deadline)
+		}
+
+		if _, err := conn.Write(c.Send); err != nil {
+			result.Reason = "Error while sending: " + err.Error()
+			return result
+		}
+
+		n, err := conn.Read(buf)
+		result.Duration = time.Since(start)
+		if err != nil {
+			result.Reason = err.Error()
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+
+			// Most likely an ICMP port unreachable message;
+			// trying again won't help.
+			return result
+		}
+
+		if matched, _ := c.Expect.Match(buf[:n]); !matched {
+			result.Reason = fmt.Sprintf("Expected %q, got: %v",
+				c.Expect.String(), summarizeResponse(buf[:n]))
+			continue
+		}
+
+		result.Up = true
+		result.Reason = fmt.Sprintf("Received %v after %v (attempt %d)",
+			summarizeResponse(buf[:n]), result.Duration, attempt)
+		return result
+	}
+
+	result.Reason = fmt.Sprintf("No valid reply after %d attempts: %v",
+		attempt-1, result.Reason)
+	return result
+}
+
+func init() {
+	RegisterCheckerType(CheckerType{
+		Name:              "socket",
+		Description:       "Connects to a TCP or UDP port.",
+		TargetLabel:       "Address",
+		TargetPlaceholder: "example.com:22",
+		Fields: []CheckerField{
+			{Name: SocketConfigProtocol, Label: "Protocol", Kind: FieldSelect,
+				Choices: []string{"tcp", "udp"}},
+			{Name: SocketConfigSend, Label: "Send", Kind: FieldText,
+				Placeholder: `HELO example.com\r\n`,
+				Help:        "Required for UDP."},
+			{Name: SocketConfigExpect, Label: "Expected response", Kind: FieldText,
+				Placeholder: "SSH-2.0-",
+				Help:        "The response needs to start with this. Required for UDP."},
+			{Name: SocketConfigExpectRegexp, Label: "Expected response is a regular expression",
+				Kind: FieldCheckbox, Default: "off"},
+			{Name: SocketConfigEncoding, Label: "Payload encoding", Kind: FieldSelect,
+				Choices: []string{"text", "hex"},
+				Help:    `Text may contain escape sequences such as \r\n or \x00.`},
+			{Name: SocketConfigRetries, Label: "UDP retries", Kind: FieldText,
+				Placeholder: strconv.Itoa(defaultUDPRetries)},
+			{Name: SocketConfigReadTimeout, Label: "UDP read timeout", Kind: FieldText,
+				Placeholder: defaultUDPReadTimeout.String()},
+		},
+		New: func(config CheckerConfig) (Checker, error) {
+			c, err := NewSocketChecker(config)
+			if err != nil {
+				return nil, err
+			}
+
+			return c, nil
+		},
+	})
+}
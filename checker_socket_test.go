@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTCPTestServer starts a server that writes banner to every
+// client and echos everything it receives afterwards.
+func newTCPTestServer(t *testing.T, banner string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte(banner))
+				buf := make([]byte, 1024)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					conn.Write(buf[:n])
+				}
+			}(conn)
+		}
+	}()
+
+	return l
+}
+
+func TestSocketChecker(t *testing.T) {
+	l := newTCPTestServer(t, "SSH-2.0-OpenSSH_7.2\r\n")
+	defer l.Close()
+
+	testcase := []struct {
+		config CheckerConfig
+		up     bool
+		reason string
+	}{
+		{CheckerConfig{}, true, "Connected in"},
+		{CheckerConfig{"expect": "SSH-2.0-"}, true, `received "SSH-2.0-OpenSSH_7.2"`},
+		{CheckerConfig{"expect": "220 "}, false,
+			`Expected "220 ", got: "SSH-2.0-OpenSSH_7.2"`},
+		{CheckerConfig{"expect": `OpenSSH_\d+`, "expect_regexp": "on"},
+			true, "Connected in"},
+		{CheckerConfig{"send": `PING\r\n`, "expect": `PING\r\n$`,
+			"expect_regexp": "on"}, true, "Connected in"},
+		{CheckerConfig{"expect": "never", "expect_regexp": "on",
+			"timeout": "50ms"}, false, "i/o timeout"},
+	}
+
+	for _, row := range testcase {
+		row.config["target"] = l.Addr().String()
+		c, err := NewSocketChecker(row.config)
+		if err != nil {
+			t.Errorf("NewSocketChecker(%v) returned an error: %v", row.config, err)
+			continue
+		}
+
+		result := c.Check()
+		if result.Up != row.up || !strings.Contains(result.Reason, row.reason) {
+			msg := "Check(%v) => (up=%v, %q), wanted: (up=%v, %q)"
+			t.Errorf(msg, row.config, result.Up, result.Reason, row.up, row.reason)
+		}
+
+		if result.Duration <= 0 || result.Duration > time.Second {
+			t.Errorf("Check(%v) has unexpected duration: %v", row.config, result.Duration)
+		}
+	}
+}
+
+func TestSocketCheckerConnectionRefused(t *testing.T) {
+	l := newTCPTestServer(t, "")
+	address := l.Addr().String()
+	l.Close()
+
+	c, err := NewSocketChecker(CheckerConfig{"target": address})
+	if err != nil {
+		t.Fatalf("NewSocketChecker returned an error: %v", err)
+	}
+
+	result := c.Check()
+	if result.Up || !strings.Contains(result.Reason, "connection refused") {
+		t.Errorf("Check() => (up=%v, %q), wanted to be down", result.Up, result.Reason)
+	}
+}
+
+func TestNewSocketCheckerInvalid(t *testing.T) {
+	testcase := []CheckerConfig{
+		{},
+		{"target": "localhost"},
+		{"target": ":22"},
+		{"target": "localhost:ssh"},
+		{"target": "localhost:70000"},
+		{"target": "localhost:22", "timeout": "abc"},
+		{"target": "localhost:22", "send": `\q`},
+		{"target": "localhost:22", "expect": "(", "expect_regexp": "on"},
+	}
+
+	for _, config := range testcase {
+		if _, err := NewSocketChecker(config); err == nil {
+			t.Errorf("NewSocketChecker(%v) did not return an error", config)
+		}
+	}
+}
+
+func TestUnescapePayload(t *testing.T) {
+	testcase := []struct {
+		in  string
+		out []byte
+	}{
+		{"", []byte{}},
+		{`HELO example.com\r\n`, []byte("HELO example.com\r\n")},
+		{`\x00\xff"'`, []byte{0, 0xff, '"', '\''}},
+		{`üü`, []byte("üü")},
+	}
+
+	for _, row := range testcase {
+		out, err := unescapePayload(row.in)
+		if err != nil || !bytes.Equal(out, row.out) {
+			t.Errorf("unescapePayload(%q) => %q, %v; wanted: %q", row.in, out, err, row.out)
+		}
+	}
+}
+
+func TestResponseMatcher(t *testing.T) {
+	m := &ResponseMatcher{Prefix: []byte("220 ")}
+	testcase := []struct {
+		data           string
+		matched, final bool
+	}{
+		{"", false, false},
+		{"22", false, false},
+		{"220 smtp", true, true},
+		{"5", false, true},
+		{"554 go away", false, true},
+	}
+
+	for _, row := range testcase {
+		matched, final := m.Match([]byte(row.data))
+		if matched != row.matched || final != row.final {
+			t.Errorf("Match(%q) => (%v, %v), wanted: (%v, %v)",
+				row.data, matched, final, row.matched, row.final)
+		}
+	}
+}
+
+// newUDPTestServer answers every "PING" with "PONG", but ignores
+// the first `drop` datagrams.
+func newUDPTestServer(t *testing.T, drop int) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			if drop > 0 {
+				drop--
+				continue
+			}
+
+			if bytes.Equal(buf[:n], []byte("PING")) {
+				conn.WriteToUDP([]byte("PONG\x00\x01"), addr)
+			} else {
+				conn.WriteToUDP([]byte("ERR"), addr)
+			}
+		}
+	}()
+
+	return conn
+}
+
+func TestSocketCheckerUDP(t *testing.T) {
+	testcase := []struct {
+		drop   int
+		config CheckerConfig
+		up     bool
+		reason string
+	}{
+		{0, CheckerConfig{"send": "PING", "expect": "PONG"},
+			true, `Received "PONG\x00\x01"`},
+		{0, CheckerConfig{"send": "50494e47", "expect": "504f4e47 0001",
+			"payload_encoding": "hex"}, true, "(attempt 1)"},
+		{0, CheckerConfig{"send": "PING", "expect": "^PONG", "expect_regexp": "on"},
+			true, "(attempt 1)"},
+		{2, CheckerConfig{"send": "PING", "expect": "PONG", "retries": "2"},
+			true, "(attempt 3)"},
+		{2, CheckerConfig{"send": "PING", "expect": "PONG", "retries": "1"},
+			false, "No valid reply after 2 attempts"},
+		{0, CheckerConfig{"send": "HELLO", "expect": "PONG", "retries": "0"},
+			false, `No valid reply after 1 attempts: Expected "PONG", got: "ERR"`},
+	}
+
+	for _, row := range testcase {
+		conn := newUDPTestServer(t, row.drop)
+		row.config["target"] = conn.LocalAddr().String()
+		row.config["protocol"] = "udp"
+		row.config["read_timeout"] = "50ms"
+
+		c, err := NewSocketChecker(row.config)
+		if err != nil {
+			t.Errorf("NewSocketChecker(%v) returned an error: %v", row.config, err)
+			conn.Close()
+			continue
+		}
+
+		result := c.Check()
+		conn.Close()
+		if result.Up != row.up || !strings.Contains(result.Reason, row.reason) {
+			msg := "Check(%v) => (up=%v, %q), wanted: (up=%v, %q)"
+			t.Errorf(msg, row.config, result.Up, result.Reason, row.up, row.reason)
+		}
+	}
+}
+
+func TestSocketCheckerUDPTimeout(t *testing.T) {
+	conn := newUDPTestServer(t, 100)
+	defer conn.Close()
+
+	c, err := NewSocketChecker(CheckerConfig{"target": conn.LocalAddr().String(),
+		"protocol": "udp", "send": "PING", "expect": "PONG", "retries": "50",
+		"read_timeout": "40ms", "timeout": "100ms"})
+	if err != nil {
+		t.Fatalf("NewSocketChecker returned an error: %v", err)
+	}
+
+	start := time.Now()
+	result := c.Check()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Check took %v, wanted at most the timeout (100ms)", elapsed)
+	}
+
+	if result.Up || !strings.Contains(result.Reason, "No valid reply") {
+		t.Errorf("Check() => (up=%v, %q), wanted: no valid reply", result.Up, result.Reason)
+	}
+}
+
+func TestSocketCheckerUDPDefaults(t *testing.T) {
+	c, err := NewSocketChecker(CheckerConfig{"target": "localhost:53",
+		"protocol": "UDP", "send": "x", "expect": "y"})
+	if err != nil {
+		t.Fatalf("NewSocketChecker returned an error: %v", err)
+	}
+
+	if c.Protocol != "udp" || c.Retries != defaultUDPRetries ||
+		c.ReadTimeout != defaultUDPReadTimeout {
+		t.Errorf("Unexpected defaults: %#v", c)
+	}
+}
+
+func TestNewSocketCheckerUDPInvalid(t *testing.T) {
+	testcase := []CheckerConfig{
+		{"protocol": "sctp"},
+		{"protocol": "udp"},
+		{"protocol": "udp", "send": "PING"},
+		{"protocol": "udp", "expect": "PONG"},
+		{"protocol": "udp", "send": "PING", "expect": "PONG", "retries": "-1"},
+		{"protocol": "udp", "send": "PING", "expect": "PONG", "read_timeout": "0"},
+		{"protocol": "udp", "send": "zz", "expect": "00", "payload_encoding": "hex"},
+		{"protocol": "udp", "send": "PING", "expect": "PONG", "payload_encoding": "b64"},
+	}
+
+	for _, config := range testcase {
+		config["target"] = "localhost:53"
+		if _, err := NewSocketChecker(config); err == nil {
+			t.Errorf("NewSocketChecker(%v) did not return an error", config)
+		}
+	}
+}
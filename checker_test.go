@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeChecker always returns the same result.
+type fakeChecker struct {
+	result CheckResult
+}
+
+func (c fakeChecker) Check() CheckResult {
+	return c.result
+}
+
+// registerFakeCheckerType registers a type for testing. Call the
+// returned function to remove it again.
+func registerFakeCheckerType(name string, f CheckerFactory) func() {
+	RegisterCheckerType(CheckerType{Name: name, New: f})
+
+	return func() {
+		delete(checkerTypes, name)
+		for i, n := range SupportedTypes {
+			if n == name {
+				SupportedTypes = append(SupportedTypes[:i], SupportedTypes[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func TestCheckResultEvent(t *testing.T) {
+	if e := (CheckResult{Up: true}).Event(); e != MonitorUpEvent {
+		t.Errorf("Up result has event %v, wanted: %v", e, MonitorUpEvent)
+	}
+
+	if e := (CheckResult{Up: false}).Event(); e != MonitorDownEvent {
+		t.Errorf("Down result has event %v, wanted: %v", e, MonitorDownEvent)
+	}
+}
+
+func TestSupportedTypes(t *testing.T) {
+	for _, name := range []string{"http", "socket", "ping"} {
+		if _, ok := LookupCheckerType(name); !ok {
+			t.Errorf("Type %q has not been registered", name)
+		}
+	}
+
+	if !sort.StringsAreSorted(SupportedTypes) {
+		t.Errorf("SupportedTypes are not sorted: %q", SupportedTypes)
+	}
+
+	if len(SupportedTypes) != len(checkerTypes) {
+		msg := "SupportedTypes (%q) does not match the registered types"
+		t.Errorf(msg, SupportedTypes)
+	}
+}
+
+func TestRegisterCheckerTypeTwice(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Registering a type twice did not panic")
+		}
+	}()
+
+	RegisterCheckerType(CheckerType{Name: "http"})
+}
+
+func TestNewCheckerUnknownType(t *testing.T) {
+	_, err := NewChecker(Monitor{Type: "unknown"})
+	if err == nil || err.Error() != `Unknown monitor type: "unknown"` {
+		t.Errorf("NewChecker returned unexpected error: %v", err)
+	}
+}
+
+func TestCheckMonitor(t *testing.T) {
+	defer registerFakeCheckerType("fake", func(CheckerConfig) (Checker, error) {
+		return fakeChecker{CheckResult{Up: true, Reason: "fine"}}, nil
+	})()
+
+	result, err := checkMonitor(Monitor{Type: "fake"})
+	if err != nil {
+		t.Fatalf("checkMonitor returned an error: %v", err)
+	}
+
+	if !result.Up || result.Reason != "fine" {
+		t.Errorf("checkMonitor returned unexpected result: %#v", result)
+	}
+
+	if result.Duration <= 0 || result.Duration > time.Second {
+		t.Errorf("checkMonitor did not measure the duration: %v", result.Duration)
+	}
+}
+
+func TestCheckMonitorFactoryError(t *testing.T) {
+	factoryErr := errors.New("invalid config")
+	defer registerFakeCheckerType("broken", func(CheckerConfig) (Checker, error) {
+		return nil, factoryErr
+	})()
+
+	if _, err := checkMonitor(Monitor{Type: "broken"}); err != factoryErr {
+		t.Errorf("checkMonitor returned %v, wanted: %v", err, factoryErr)
+	}
+}
+
+// countingChecker is up after failing a number of times.
+type countingChecker struct {
+	failures *int
+}
+
+func (c countingChecker) Check() CheckResult {
+	if *c.failures > 0 {
+		*c.failures--
+		return CheckResult{Reason: "failed"}
+	}
+
+	return CheckResult{Up: true}
+}
+
+func TestCheckMonitorRetries(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	failures := 0
+	defer registerFakeCheckerType("flaky", func(CheckerConfig) (Checker, error) {
+		return countingChecker{&failures}, nil
+	})()
+
+	testcase := []struct {
+		failures, retries int
+		up                bool
+	}{
+		{0, 0, true},
+		{1, 0, false},
+		{1, 1, true},
+		{2, 3, true},
+		{4, 3, false},
+	}
+
+	for _, row := range testcase {
+		failures = row.failures
+		m := Monitor{Type: "flaky", Settings: MonitorSettings{Retries: row.retries}}
+		result, err := checkMonitor(m)
+		if err != nil || result.Up != row.up {
+			msg := "checkMonitor with %d failures and %d retries => (%v, %v), wanted up=%v"
+			t.Errorf(msg, row.failures, row.retries, result.Up, err, row.up)
+		}
+	}
+}
+
+func TestNewCheckerPassesSettings(t *testing.T) {
+	var got CheckerConfig
+	defer registerFakeCheckerType("config", func(c CheckerConfig) (Checker, error) {
+		got = c
+		return fakeChecker{}, nil
+	})()
+
+	m := Monitor{Type: "config", Settings: MonitorSettings{
+		Target:  "example.com",
+		Timeout: 5,
+		Options: map[string]string{"count": "3"},
+	}}
+
+	if _, err := NewChecker(m); err != nil {
+		t.Fatalf("NewChecker returned an error: %v", err)
+	}
+
+	if got["target"] != "example.com" || got["timeout"] != "5" || got["count"] != "3" {
+		t.Errorf("The checker got an unexpected config: %v", got)
+	}
+}
+
+func TestCheckerConfig(t *testing.T) {
+	config := CheckerConfig{
+		"name":    " foo ",
+		"empty":   "  ",
+		"number":  "42",
+		"on":      "on",
+		"false":   "false",
+		"seconds": "1.5",
+		"minutes": "2m",
+	}
+
+	if v := config.String("name", "def"); v != "foo" {
+		t.Errorf("String(name) => %q, wanted: foo", v)
+	}
+
+	if v := config.String("empty", "def"); v != "def" {
+		t.Errorf("String(empty) => %q, wanted: def", v)
+	}
+
+	if _, err := config.Required("empty"); err == nil {
+		t.Errorf("Required(empty) did not return an error")
+	}
+
+	if v, err := config.Int("number", 0); v != 42 || err != nil {
+		t.Errorf("Int(number) => %v, %v", v, err)
+	}
+
+	if _, err := config.Int("name", 0); err == nil {
+		t.Errorf("Int(name) did not return an error")
+	}
+
+	if v, err := config.Bool("on", false); !v || err != nil {
+		t.Errorf("Bool(on) => %v, %v", v, err)
+	}
+
+	if v, err := config.Bool("false", true); v || err != nil {
+		t.Errorf("Bool(false) => %v, %v", v, err)
+	}
+
+	if v, err := config.Bool("missing", true); !v || err != nil {
+		t.Errorf("Bool(missing) => %v, %v", v, err)
+	}
+
+	if v, err := config.Duration("seconds", 0); v != 1500*time.Millisecond || err != nil {
+		t.Errorf("Duration(seconds) => %v, %v", v, err)
+	}
+
+	if v, err := config.Duration("minutes", 0); v != 2*time.Minute || err != nil {
+		t.Errorf("Duration(minutes) => %v, %v", v, err)
+	}
+
+	if _, err := config.Duration("name", 0); err == nil {
+		t.Errorf("Duration(name) did not return an error")
+	}
+
+	if v, err := config.Timeout(); v != DefaultCheckTimeout || err != nil {
+		t.Errorf("Timeout() => %v, %v", v, err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// dashboardPageSize is the number of monitors shown
+	// on each page of the dashboard.
+	dashboardPageSize = 50
+
+	// donutRadius is the radius of the donut charts of
+	// the stats tiles (the SVG is 42 units wide).
+	donutRadius = 15.9155
+)
+
+// donutCircumference is the circumference of the donut charts. With
+// the radius above, it is 100 units so that percentages can be used
+// for the dash array directly.
+var donutCircumference = 2 * math.Pi * donutRadius
+
+// DashboardStats counts the monitors by their latest event.
+type DashboardStats struct {
+	Total  int `json:"total"`
+	Up     int `json:"up"`
+	Down   int `json:"down"`
+	Paused int `json:"paused"`
+
+	// Pending monitors have not been checked since they have
+	// been created or resumed.
+	Pending int `json:"pending"`
+}
+
+// Add counts count monitors whose latest event is e.
+func (s *DashboardStats) Add(e EventType, count int) {
+	s.Total += count
+	switch e {
+	case MonitorUpEvent:
+		s.Up += count
+	case MonitorDownEvent:
+		s.Down += count
+	case MonitorPausedEvent:
+		s.Paused += count
+	default:
+		s.Pending += count
+	}
+}
+
+// StatTile is one of the tiles on the dashboard.
+type StatTile struct {
+	Label string
+	Count int
+	Total int
+	Color string
+}
+
+// Percentage returns the share of all monitors (0 if there
+// are no monitors).
+func (t StatTile) Percentage() float64 {
+	if t.Total == 0 {
+		return 0
+	}
+
+	return float64(t.Count) * 100 / float64(t.Total)
+}
+
+// DonutDashArray returns the stroke-dasharray of the donut chart's
+// segment (the rest of the circle is shown in grey).
+func (t StatTile) DonutDashArray() string {
+	filled := t.Percentage() / 100 * donutCircumference
+	return fmt.Sprintf("%.2f %.2f", filled, donutCircumference-filled)
+}
+
+// DonutRadius returns the radius of the donut chart.
+func (t StatTile) DonutRadius() float64 {
+	return donutRadius
+}
+
+// Tiles returns the tiles shown on the dashboard.
+func (s DashboardStats) Tiles() []StatTile {
+	return []StatTile{
+		{"Up monitors", s.Up, s.Total, MonitorUpEvent.CSSColor()},
+		{"Down monitors", s.Down, s.Total, MonitorDownEvent.CSSColor()},
+		{"Paused monitors", s.Paused, s.Total, MonitorPausedEvent.CSSColor()},
+	}
+}
+
+// loadDashboardStats counts all monitors by their latest event.
+func loadDashboardStats() (DashboardStats, error) {
+	stats := DashboardStats{}
+	counts := []struct {
+		Event EventType
+		Count int
+	}{}
+
+	err := joinLatestLog(db.Model(&Monitor{}).Alias("m").
+		Column("l1.event", "count(*) AS count")).
+		Group("l1.event").
+		Select(&counts)
+
+	for _, c := range counts {
+		stats.Add(c.Event, c.Count)
+	}
+
+	return stats, err
+}
+
+// Dashboard is passed to the dashboard's template.
+type Dashboard struct {
+	Stats    DashboardStats
+	Monitors []MonitorStatus
+	Page     Pagination
+
+	// Uptime contains the uptime of the last 24 hours of
+	// every monitor on the page.
+	Uptime map[int]UptimeReport
+
+	Permissions
+}
+
+// UptimeOf returns the uptime report of the monitor.
+func (d Dashboard) UptimeOf(id int) UptimeReport {
+	return d.Uptime[id]
+}
+
+var publicStatusTmpl = MustTemplate(NewBareboneTemplate("status.html"))
+
+// PublicStatus is passed to the public status page. It only
+// contains the names and states of the monitors.
+type PublicStatus struct {
+	Stats    DashboardStats
+	Monitors []MonitorStatus
+}
+
+// publicStatusHandler shows the state of every monitor without
+// requiring to log in (if it is enabled, see main).
+func publicStatusHandler(_ *http.Request, _ httprouter.Params) Page {
+	status := PublicStatus{Monitors: []MonitorStatus{}}
+	dt := TransactionErrorHandler{}
+
+	stats, err := loadDashboardStats()
+	status.Stats = stats
+	dt.Err(err)
+
+	if dt.FirstErr() == nil {
+		dt.Err(joinLatestLog(db.Model(&Monitor{}).Alias("m").
+			Column("m.id", "m.name", "l1.event")).
+			Order("m.name ASC, m.id ASC").
+			Select(&status.Monitors))
+	}
+
+	return defaultTW.SetTemplate(publicStatusTmpl).SetTmplArgs(status).
+		SetError(dt.FirstErr())
+}
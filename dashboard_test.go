@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+func TestDashboardStatsAdd(t *testing.T) {
+	stats := DashboardStats{}
+	stats.Add(MonitorUpEvent, 3)
+	stats.Add(MonitorDownEvent, 2)
+	stats.Add(MonitorPausedEvent, 1)
+	stats.Add(MonitorCreatedEvent, 4)
+
+	expected := DashboardStats{Total: 10, Up: 3, Down: 2, Paused: 1, Pending: 4}
+	if stats != expected {
+		t.Errorf("Wanted %+v; got: %+v", expected, stats)
+	}
+}
+
+func TestDashboardStatsTiles(t *testing.T) {
+	stats := DashboardStats{Total: 4, Up: 2, Down: 1, Paused: 1}
+	tiles := stats.Tiles()
+	if len(tiles) != 3 {
+		t.Fatalf("Wanted 3 tiles; got: %v", len(tiles))
+	}
+
+	for i, expected := range []struct {
+		count      int
+		percentage float64
+		dashArray  string
+		color      string
+	}{
+		{2, 50, "50.00 50.00", MonitorUpEvent.CSSColor()},
+		{1, 25, "25.00 75.00", MonitorDownEvent.CSSColor()},
+		{1, 25, "25.00 75.00", MonitorPausedEvent.CSSColor()},
+	} {
+		tile := tiles[i]
+		if tile.Count != expected.count || tile.Total != stats.Total {
+			t.Errorf("Tile %v: wanted %v of %v; got: %v of %v", i,
+				expected.count, stats.Total, tile.Count, tile.Total)
+		}
+
+		if p := tile.Percentage(); p != expected.percentage {
+			t.Errorf("Tile %v: wanted %v%%; got: %v%%", i, expected.percentage, p)
+		}
+
+		if d := tile.DonutDashArray(); d != expected.dashArray {
+			t.Errorf("Tile %v: wanted dash array %q; got: %q", i, expected.dashArray, d)
+		}
+
+		if tile.Color != expected.color {
+			t.Errorf("Tile %v: wanted color %q; got: %q", i, expected.color, tile.Color)
+		}
+	}
+}
+
+func TestStatTileWithoutMonitors(t *testing.T) {
+	tile := StatTile{Label: "Up monitors"}
+	if p := tile.Percentage(); p != 0 {
+		t.Errorf("Wanted 0%%; got: %v%%", p)
+	}
+
+	if d := tile.DonutDashArray(); d != "0.00 100.00" {
+		t.Errorf("Wanted an empty donut; got: %q", d)
+	}
+}
+
+func TestLoadDashboardStats(t *testing.T) {
+	defer InitTestConnection(t)()
+	stats, err := loadDashboardStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DashboardStats{Total: 4, Up: 3, Down: 1}
+	if stats != expected {
+		t.Errorf("Wanted %+v; got: %+v", expected, stats)
+	}
+}
+
+func TestPublicStatusHandler(t *testing.T) {
+	defer InitTestConnection(t)()
+	tw := getTemplateWriter(t, publicStatusHandler(nil, nil))
+	if tw.Err != nil {
+		t.Fatalf("publicStatusHandler returned an error: %v", tw.Err)
+	}
+
+	status := tw.TmplArgs.(PublicStatus)
+	if status.Stats.Total != 4 || len(status.Monitors) != 4 {
+		t.Fatalf("Unexpected status: %#v", status)
+	}
+
+	for _, m := range status.Monitors {
+		if m.Settings.Target != "" {
+			t.Errorf("The target of %q is shown publicly", m.Name)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 
 	"gopkg.in/pg.v4"
+	"gopkg.in/pg.v4/orm"
+	"gopkg.in/pg.v4/types"
 )
 
 const databaseConfigName = "database-config.json"
@@ -65,6 +67,22 @@ func InitConnection() *pg.DB {
 	return pg.Connect(options)
 }
 
+// queryer is implemented by both *pg.DB and *pg.Tx, so that
+// queries can be run within a transaction or without one.
+type queryer interface {
+	Model(model ...interface{}) *orm.Query
+	Query(model, query interface{}, params ...interface{}) (*types.Result, error)
+}
+
+// joinLatestLog joins every monitor (aliased as "m") with its
+// latest log entry (aliased as "l1").
+func joinLatestLog(q *orm.Query) *orm.Query {
+	return q.Join("JOIN monitor_logs l1 ON (m.id = l1.monitor_id)").
+		Join("LEFT OUTER JOIN monitor_logs l2 ON (m.id = l2.monitor_id " +
+			"AND l1.date <= l2.date AND l1.id < l2.id)").
+		Where("l2.id IS NULL")
+}
+
 // TransactionErrorHandler is used for dealing with
 // mutiple errors during a transaction without
 // checking for an error every time.
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// EscalationPolicy notifies further channels if a monitor stays down.
+// The channels linked to the monitor are notified as soon as it goes
+// down; the channels of the policy are notified if it is still down
+// After minutes later and then every Repeat minutes until it comes
+// back up or the outage is acknowledged.
+type EscalationPolicy struct {
+	ChannelIds []int `json:"channel_ids"`
+
+	// After and Repeat are in minutes. If Repeat is zero, the
+	// escalation is not repeated.
+	After  int `json:"after"`
+	Repeat int `json:"repeat,omitempty"`
+}
+
+// AfterDuration returns the time after which the outage is escalated.
+func (p EscalationPolicy) AfterDuration() time.Duration {
+	return time.Duration(p.After) * time.Minute
+}
+
+// RepeatDuration returns the time between two repeated escalations.
+func (p EscalationPolicy) RepeatDuration() time.Duration {
+	return time.Duration(p.Repeat) * time.Minute
+}
+
+// Step returns the number of escalation notifications that are due
+// once the monitor has been down for downtime.
+func (p EscalationPolicy) Step(downtime time.Duration) int {
+	if len(p.ChannelIds) == 0 || downtime < p.AfterDuration() {
+		return 0
+	} else if p.Repeat <= 0 {
+		return 1
+	}
+
+	return 1 + int((downtime-p.AfterDuration())/p.RepeatDuration())
+}
+
+// Outage is a monitor that is down at the moment.
+type Outage struct {
+	Monitor Monitor
+
+	// Since is the date of the down event; Reason is its reason.
+	Since  time.Time
+	Reason string
+}
+
+// loadOutages loads every monitor whose latest event is a down event.
+func loadOutages() ([]Outage, error) {
+	rows := []struct {
+		Id       int
+		Name     string
+		Type     string
+		Settings MonitorSettings
+		Date     time.Time
+		Reason   string
+	}{}
+
+	err := joinLatestLog(db.Model(&Monitor{}).Alias("m").
+		Column("m.id", "m.name", "m.type", "m.settings", "l1.date", "l1.reason")).
+		Where("l1.event = ?", MonitorDownEvent).
+		Order("m.id ASC").
+		Select(&rows)
+
+	outages := make([]Outage, len(rows))
+	for i, row := range rows {
+		outages[i] = Outage{
+			Monitor: Monitor{Id: row.Id, Name: row.Name, Type: row.Type, Settings: row.Settings},
+			Since:   row.Date,
+			Reason:  row.Reason,
+		}
+	}
+
+	return outages, err
+}
+
+// escalationInterval is the time between two evaluations of the
+// escalation policies.
+const escalationInterval = 30 * time.Second
+
+// outageKey identifies an outage.
+type outageKey struct {
+	monitorID int
+	since     int64
+}
+
+// Escalator periodically sends the escalation notifications of the
+// monitors that are down (see EscalationPolicy). It only remembers
+// which notifications it has sent while it is running, so the latest
+// escalation of an outage is repeated after a restart.
+type Escalator struct {
+	Interval time.Duration
+
+	// Outages returns the monitors that are down at the moment.
+	Outages func() ([]Outage, error)
+
+	// Acknowledged tells whether the outage of the monitor that
+	// started at since has been acknowledged (see Incident).
+	Acknowledged func(monitorID int, since time.Time) (bool, error)
+
+	// Notify sends the notification (such as
+	// NotificationDispatcher.Add).
+	Notify func(Notification)
+
+	// steps contains the number of escalations sent about every
+	// outage that is still going on.
+	steps map[outageKey]int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewEscalator creates an escalator evaluating the outages logged
+// in the database.
+func NewEscalator(notify func(Notification)) *Escalator {
+	return &Escalator{
+		Interval:     escalationInterval,
+		Outages:      loadOutages,
+		Acknowledged: outageAcknowledged,
+		Notify:       notify,
+	}
+}
+
+// Start evaluates the escalation policies in the background every
+// e.Interval.
+func (e *Escalator) Start() {
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.run()
+}
+
+// Stop stops the evaluation and waits until it has stopped.
+func (e *Escalator) Stop() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *Escalator) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case now := <-ticker.C:
+			if err := e.Evaluate(now); err != nil {
+				log.Printf("Escalation: could not load outages: %v", err)
+			}
+		}
+	}
+}
+
+// Evaluate sends the escalations that are due at now. If several
+// are due (because the evaluation has been delayed), only one is
+// sent.
+func (e *Escalator) Evaluate(now time.Time) error {
+	outages, err := e.Outages()
+	if err != nil {
+		return err
+	}
+
+	steps := map[outageKey]int{}
+	for _, o := range outages {
+		p := o.Monitor.Settings.Escalation
+		if p == nil {
+			continue
+		}
+
+		key := outageKey{o.Monitor.Id, o.Since.UnixNano()}
+		steps[key] = e.steps[key]
+		step := p.Step(now.Sub(o.Since))
+		if step <= steps[key] {
+			continue
+		}
+
+		if ack, err := e.Acknowledged(o.Monitor.Id, o.Since); err != nil {
+			log.Printf("Escalation: could not check outage of monitor %d: %v",
+				o.Monitor.Id, err)
+			continue
+		} else if ack {
+			continue
+		}
+
+		e.Notify(Notification{
+			Monitor:    o.Monitor,
+			Event:      MonitorDownEvent,
+			Date:       now,
+			Reason:     o.Reason,
+			DownSince:  o.Since,
+			Escalation: step,
+		})
+		steps[key] = step
+	}
+
+	// Outages that have ended are forgotten.
+	e.steps = steps
+	return nil
+}
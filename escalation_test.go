@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEscalationPolicyStep(t *testing.T) {
+	policy := EscalationPolicy{ChannelIds: []int{1}, After: 10, Repeat: 5}
+	once := EscalationPolicy{ChannelIds: []int{1}, After: 10}
+	testcase := []struct {
+		policy   EscalationPolicy
+		downtime time.Duration
+		expected int
+	}{
+		{policy, 9 * time.Minute, 0},
+		{policy, 10 * time.Minute, 1},
+		{policy, 14 * time.Minute, 1},
+		{policy, 15 * time.Minute, 2},
+		{policy, 31 * time.Minute, 5},
+		{once, 9 * time.Minute, 0},
+		{once, 2 * time.Hour, 1},
+		{EscalationPolicy{After: 10}, time.Hour, 0},
+	}
+
+	for _, row := range testcase {
+		if step := row.policy.Step(row.downtime); step != row.expected {
+			t.Errorf("%#v.Step(%v) = %d, wanted: %d", row.policy, row.downtime, step, row.expected)
+		}
+	}
+}
+
+func TestEscalatorEvaluate(t *testing.T) {
+	defer shutupLog()()
+
+	start := time.Now()
+	escalated := Monitor{Id: 1, Settings: MonitorSettings{
+		Escalation: &EscalationPolicy{ChannelIds: []int{2}, After: 10, Repeat: 30},
+	}}
+	outages := []Outage{
+		{Monitor: escalated, Since: start, Reason: "timeout"},
+		{Monitor: Monitor{Id: 2}, Since: start},
+	}
+
+	var sent []Notification
+	acknowledged := map[int]bool{}
+	e := &Escalator{
+		Outages: func() ([]Outage, error) {
+			return outages, nil
+		},
+		Acknowledged: func(monitorID int, since time.Time) (bool, error) {
+			return acknowledged[monitorID], nil
+		},
+		Notify: func(n Notification) {
+			sent = append(sent, n)
+		},
+	}
+
+	evaluate := func(after time.Duration, expected int) {
+		if err := e.Evaluate(start.Add(after)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(sent) != expected {
+			t.Fatalf("After %v: sent %d escalations, wanted: %d", after, len(sent), expected)
+		}
+	}
+
+	evaluate(5*time.Minute, 0)
+	evaluate(10*time.Minute, 1)
+	evaluate(11*time.Minute, 1)
+
+	n := sent[0]
+	if n.Monitor.Id != 1 || !n.IsEscalation() || n.Escalation != 1 ||
+		!n.DownSince.Equal(start) || n.Reason != "timeout" {
+		t.Errorf("Unexpected escalation: %#v", n)
+	}
+
+	// Missed repetitions are only sent once.
+	evaluate(75*time.Minute, 2)
+	if sent[1].Escalation != 3 {
+		t.Errorf("Sent escalation %d, wanted: 3", sent[1].Escalation)
+	}
+
+	acknowledged[1] = true
+	evaluate(2*time.Hour, 2)
+	acknowledged[1] = false
+
+	// A new outage is escalated again from the start.
+	outages[0].Since = start.Add(3 * time.Hour)
+	evaluate(3*time.Hour+5*time.Minute, 2)
+	evaluate(3*time.Hour+10*time.Minute, 3)
+	if sent[2].Escalation != 1 {
+		t.Errorf("Sent escalation %d for a new outage, wanted: 1", sent[2].Escalation)
+	}
+
+	e.Outages = func() ([]Outage, error) {
+		return nil, errors.New("database is down")
+	}
+	if err := e.Evaluate(start); err == nil {
+		t.Errorf("No error if the outages cannot be loaded")
+	}
+}
+
+func TestLoadOutages(t *testing.T) {
+	defer InitTestConnection(t)()
+
+	policy := &EscalationPolicy{ChannelIds: []int{1}, After: 5}
+	monitors := []Monitor{
+		{Name: "Down", Type: "http", Settings: MonitorSettings{Escalation: policy}},
+		{Name: "Up again", Type: "http"},
+	}
+	if err := db.Create(&monitors); err != nil {
+		t.Fatal(err)
+	}
+
+	// Postgres stores microseconds.
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	logs := []MonitorLog{
+		{Event: MonitorDownEvent, Date: start, MonitorId: monitors[0].Id, Reason: "refused"},
+		{Event: MonitorDownEvent, Date: start, MonitorId: monitors[1].Id},
+		{Event: MonitorUpEvent, Date: start.Add(time.Minute), MonitorId: monitors[1].Id},
+	}
+	if err := db.Create(&logs); err != nil {
+		t.Fatal(err)
+	}
+
+	outages, err := loadOutages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, o := range outages {
+		if o.Monitor.Id == monitors[1].Id {
+			t.Errorf("The monitor that is up again is down: %#v", o)
+		} else if o.Monitor.Id == monitors[0].Id {
+			found = true
+			if o.Monitor.Name != "Down" || o.Monitor.Settings.Escalation == nil ||
+				o.Reason != "refused" || !o.Since.Equal(start) {
+				t.Errorf("Unexpected outage: %#v", o)
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("The outage has not been loaded: %#v", outages)
+	}
+}
@@ -29,6 +29,11 @@ var (
 
 	err404 = StatusError{Status: 404, Message: "Page could not be found"}
 
+	errMonitorNotFound = StatusError{
+		Status:  http.StatusNotFound,
+		Message: "Monitor could not be found",
+	}
+
 	exportFormatNotSupported = []byte("Export format is not supported.")
 	exportIdNotAnInterger    = []byte("ID needs to be an integer.")
 )
@@ -43,6 +48,8 @@ var (
 	indexTmpl       = MustTemplate(NewTemplate("index.html"))
 	monitorViewTmpl = MustTemplate(NewTemplate("monitors/view.html"))
 	monitorAddTmpl  = MustTemplate(NewTemplate("monitors/add.html"))
+
+	monitorDeleteTmpl = MustTemplate(NewTemplate("monitors/delete.html"))
 )
 
 // UptimeCheckerHandle is the basic handle for this webpage. Every
@@ -93,97 +100,138 @@ func handleServerError(org error, w http.ResponseWriter) {
 	}
 }
 
-func dashboardHandler(_ *http.Request, _ httprouter.Params) Page {
+func dashboardHandler(r *http.Request, _ httprouter.Params) Page {
 	tw := defaultTW.SetTemplate(indexTmpl)
-	monitors := []struct {
-		Id    int
-		Name  string
-		Type  string
-		Event EventType
-	}{}
-
-	err := NewDatabaseError(db.Model(&Monitor{}).Alias("m").
-		Column("m.name", "m.type", "m.id", "l1.event").
-		Join("JOIN monitor_logs l1 ON (m.id = l1.monitor_id)").
-		Join("LEFT OUTER JOIN monitor_logs l2 ON (m.id = l2.monitor_id " +
-		"AND l1.date <= l2.date AND l1.id < l2.id)").
-		Where("l2.id IS NULL").
-		Order("m.id ASC").
-		Limit(50).
-		Select(&monitors))
-
-	return tw.SetTmplArgs(monitors).SetError(err)
-}
+	dashboard := Dashboard{Monitors: []MonitorStatus{}, Permissions: permissionsOf(r)}
+	dt := TransactionErrorHandler{}
 
-func getAddMonitorTemplate(errMsg string) Page {
-	data := struct {
-		Values []string
-		Err    string
-	}{SupportedTypes, errMsg}
+	stats, err := loadDashboardStats()
+	dashboard.Stats = stats
+	dashboard.Page = NewPagination(r.URL.Query(), dashboardPageSize, stats.Total)
+	dt.Err(err)
+
+	if dt.FirstErr() == nil {
+		dt.Err(joinLatestLog(db.Model(&Monitor{}).Alias("m").
+			Column("m.name", "m.type", "m.id", "l1.event")).
+			Order("m.id ASC").
+			Offset(dashboard.Page.Offset()).
+			Limit(dashboard.Page.PageSize).
+			Select(&dashboard.Monitors))
+	}
+
+	if dt.FirstErr() == nil {
+		ids := []int{}
+		for _, m := range dashboard.Monitors {
+			ids = append(ids, m.Id)
+		}
+
+		uptimeRange, _ := NewTimeRange("24h", time.Now())
+		dashboard.Uptime, err = loadUptimeReports(db, ids, uptimeRange)
+		dt.Err(err)
+	}
+
+	return tw.SetTmplArgs(dashboard).SetError(dt.FirstErr())
+}
 
-	return defaultTW.SetTemplate(monitorAddTmpl).SetTmplArgs(data)
+func getAddMonitorTemplate(form MonitorForm) Page {
+	err := form.loadChannelChoices()
+	return defaultTW.SetTemplate(monitorAddTmpl).SetTmplArgs(form).
+		SetError(NewDatabaseError(err))
 }
 
 func addMonitorGetHandler(_ *http.Request, _ httprouter.Params) Page {
-	return getAddMonitorTemplate("")
+	return getAddMonitorTemplate(NewMonitorForm(Monitor{}, true, ""))
 }
 
 func addMonitorPostHandler(r *http.Request, _ httprouter.Params) Page {
-	if err := r.ParseForm(); err != nil {
-		msg := "Form data invaild. Please check input."
-		return getAddMonitorTemplate(msg)
+	monitor, paused, err := parseMonitorForm(r)
+	if err != nil {
+		return getAddMonitorTemplate(NewMonitorForm(monitor, paused, err.Error()))
 	}
 
-	monitor := Monitor{}
-	monitor.Name = strings.TrimSpace(r.PostFormValue("name"))
-	if monitor.Name == "" {
-		return getAddMonitorTemplate("A name for the monitor is required.")
+	if err := createMonitor(&monitor, paused); err != nil {
+		return defaultTW.SetError(err)
 	}
 
-	monitor.Type = r.PostFormValue("type") // TODO: Actually parse type
-	tx, err := db.Begin()
-	defer tx.Rollback()
+	refreshScheduler()
+	return Redirect{
+		Location: fmt.Sprintf("/monitors/view/%d/", monitor.Id),
+		Request:  r, Status: http.StatusSeeOther,
+	}
+}
 
+// createMonitor inserts the monitor along with its created event
+// and a started event (or a paused event if paused is true).
+func createMonitor(monitor *Monitor, paused bool) HTTPError {
+	tx, err := db.Begin()
 	errHandler := TransactionErrorHandler{}
-	errHandler.Err(err)
-	if err == nil {
-		errHandler.Err(tx.Create(&monitor))
-		createdEvent := MonitorLog{
-			Event:     MonitorCreatedEvent,
-			Date:      time.Now(),
-			MonitorId: monitor.Id,
-		}
+	if err != nil {
+		return errHandler.Err(err).FirstErr()
+	}
+	defer tx.Rollback()
 
-		errHandler.Err(tx.Create(&createdEvent))
-		secondEvent := MonitorLog{
-			Event:     MonitorStartedEvent,
-			Date:      time.Now(),
-			MonitorId: monitor.Id,
-		}
-		if r.PostFormValue("paused") == "on" {
-			secondEvent.Event = MonitorPausedEvent
-		}
+	errHandler.Err(tx.Create(monitor))
+	createdEvent := MonitorLog{
+		Event:     MonitorCreatedEvent,
+		Date:      time.Now(),
+		MonitorId: monitor.Id,
+	}
 
-		errHandler.Err(tx.Create(&secondEvent)).Err(tx.Commit())
+	errHandler.Err(tx.Create(&createdEvent))
+	secondEvent := MonitorLog{
+		Event:     MonitorStartedEvent,
+		Date:      time.Now(),
+		MonitorId: monitor.Id,
+	}
+	if paused {
+		secondEvent.Event = MonitorPausedEvent
 	}
 
+	errHandler.Err(tx.Create(&secondEvent))
 	if errHandler.FirstErr() == nil {
-		tx.Commit()
-		return Redirect{
-			Location: fmt.Sprintf("/monitors/view/%d/", monitor.Id),
-			Request:  r, Status: http.StatusSeeOther,
-		}
-	} else {
-		return defaultTW.SetError(errHandler.FirstErr())
+		errHandler.Err(tx.Commit())
 	}
+
+	return errHandler.FirstErr()
+}
+
+// deliveriesShown is the number of notification deliveries
+// shown on the page of a monitor.
+const deliveriesShown = 20
+
+// MonitorView is passed to the template showing a monitor.
+type MonitorView struct {
+	Monitor
+
+	// Range is the range shown in the chart. Ranges are the
+	// names of all ranges that can be selected. RangeErr is set
+	// if the custom range is invalid (the default is shown then).
+	Range    TimeRange
+	Ranges   []string
+	RangeErr string
+
+	Chart  UptimeChart
+	Uptime UptimeReport
+
+	// Channels are the notification channels linked to the
+	// monitor and EscalationChannels are the channels of its
+	// escalation policy. Deliveries are the latest notifications
+	// sent about the monitor.
+	Channels           []NotificationChannel
+	EscalationChannels []NotificationChannel
+	Deliveries         []NotificationDelivery
+
+	// Incidents are the latest incidents of the monitor. Users
+	// are the users the incidents can be assigned to.
+	Incidents []Incident
+	Users     []User
+
+	Permissions
 }
 
-func viewMonitorHandler(_ *http.Request, params httprouter.Params) Page {
+func viewMonitorHandler(r *http.Request, params httprouter.Params) Page {
 	id, err := strconv.Atoi(params.ByName("id"))
-	notFoundErr := defaultTW.SetError(StatusError{
-		Status:  http.StatusNotFound,
-		Message: "Monitor could not be found",
-	})
+	notFoundErr := defaultTW.SetError(errMonitorNotFound)
 
 	if err != nil {
 		return notFoundErr
@@ -206,11 +254,176 @@ func viewMonitorHandler(_ *http.Request, params httprouter.Params) Page {
 	dt.Err(tx.Model(&monitor.Logs).Where("monitor_id=?", id).
 		Limit(50).Order("date DESC").Select())
 
+	view := MonitorView{Monitor: monitor, Ranges: TimeRangeNames(), Permissions: permissionsOf(r)}
+	if view.Range, err = ParseTimeRange(r.URL.Query(), time.Now()); err != nil {
+		view.RangeErr = err.Error()
+		view.Range, _ = NewTimeRange("", time.Now())
+	}
+
+	if dt.FirstErr() == nil {
+		view.Chart, err = loadUptimeChart(tx, id, view.Range)
+		dt.Err(err)
+	}
+
+	if dt.FirstErr() == nil {
+		reports, err := loadUptimeReports(tx, []int{id}, view.Range)
+		view.Uptime = reports[id]
+		dt.Err(err)
+	}
+
+	if dt.FirstErr() == nil {
+		view.Channels, err = loadChannels(tx, monitor.Settings.ChannelIds)
+		dt.Err(err)
+	}
+
+	if p := monitor.Settings.Escalation; p != nil && dt.FirstErr() == nil {
+		view.EscalationChannels, err = loadChannels(tx, p.ChannelIds)
+		dt.Err(err)
+	}
+
+	if dt.FirstErr() == nil {
+		dt.Err(tx.Model(&view.Deliveries).Where("monitor_id = ?", id).
+			Limit(deliveriesShown).Order("date DESC, id DESC").Select())
+	}
+
+	if dt.FirstErr() == nil {
+		view.Incidents, err = loadIncidents(tx, id, incidentsShown)
+		dt.Err(err)
+	}
+
+	if len(view.Incidents) > 0 && view.CanEdit() && dt.FirstErr() == nil {
+		dt.Err(tx.Model(&view.Users).Column("id", "name").Order("name ASC").Select())
+	}
+
 	if dt.FirstErr() != nil {
 		return defaultTW.SetError(dt.FirstErr())
 	}
 
-	return defaultTW.SetTmplArgs(monitor).SetTemplate(monitorViewTmpl)
+	return defaultTW.SetTmplArgs(view).SetTemplate(monitorViewTmpl)
+}
+
+// findMonitor loads the monitor whose id is in params. If the
+// monitor could not be loaded, the returned page shows the error.
+func findMonitor(params httprouter.Params) (Monitor, Page) {
+	monitor, err := loadMonitor(params)
+	if err != nil {
+		return monitor, defaultTW.SetError(err)
+	}
+
+	return monitor, nil
+}
+
+// loadMonitor loads the monitor whose id is in params. The error is
+// errMonitorNotFound if there is no such monitor.
+func loadMonitor(params httprouter.Params) (Monitor, HTTPError) {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return Monitor{}, errMonitorNotFound
+	}
+
+	monitor := Monitor{Id: id}
+	if err := db.Select(&monitor); err == pg.ErrNoRows {
+		return monitor, errMonitorNotFound
+	} else if err != nil {
+		return monitor, NewDatabaseError(err)
+	}
+
+	return monitor, nil
+}
+
+func editMonitorGetHandler(_ *http.Request, params httprouter.Params) Page {
+	monitor, errPage := findMonitor(params)
+	if errPage != nil {
+		return errPage
+	}
+
+	return getAddMonitorTemplate(NewMonitorForm(monitor, false, ""))
+}
+
+func editMonitorPostHandler(r *http.Request, params httprouter.Params) Page {
+	existing, errPage := findMonitor(params)
+	if errPage != nil {
+		return errPage
+	}
+
+	monitor, _, err := parseMonitorForm(r)
+	monitor.Id = existing.Id
+	if err != nil {
+		return getAddMonitorTemplate(NewMonitorForm(monitor, false, err.Error()))
+	}
+
+	if err := db.Update(&monitor); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	refreshScheduler()
+
+	return Redirect{
+		Location: fmt.Sprintf("/monitors/view/%d/", monitor.Id),
+		Request:  r, Status: http.StatusSeeOther,
+	}
+}
+
+func deleteMonitorGetHandler(_ *http.Request, params httprouter.Params) Page {
+	monitor, errPage := findMonitor(params)
+	if errPage != nil {
+		return errPage
+	}
+
+	return defaultTW.SetTemplate(monitorDeleteTmpl).SetTmplArgs(monitor)
+}
+
+// deleteMonitorPostHandler deletes the monitor. Its logs are
+// deleted by the database (ON DELETE CASCADE).
+func deleteMonitorPostHandler(r *http.Request, params httprouter.Params) Page {
+	monitor, errPage := findMonitor(params)
+	if errPage != nil {
+		return errPage
+	}
+
+	if err := db.Delete(&monitor); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	refreshScheduler()
+
+	return Redirect{Location: "/", Request: r, Status: http.StatusSeeOther}
+}
+
+// localRedirect returns next if it is a path on this server
+// and fallback otherwise.
+func localRedirect(next, fallback string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") ||
+		strings.HasPrefix(next, "/\\") {
+		return fallback
+	}
+
+	return next
+}
+
+// pauseMonitorHandler returns the handler pausing (or resuming) a
+// monitor. The user is redirected to the page in the form value
+// "next" (or the monitor's page).
+func pauseMonitorHandler(paused bool) UptimeCheckerHandler {
+	return func(r *http.Request, params httprouter.Params) Page {
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil {
+			return defaultTW.SetError(errMonitorNotFound)
+		}
+
+		if _, err := setMonitorPaused(id, paused); err == pg.ErrNoRows {
+			return defaultTW.SetError(errMonitorNotFound)
+		} else if err != nil {
+			return defaultTW.SetError(NewDatabaseError(err))
+		}
+
+		refreshScheduler()
+		location := fmt.Sprintf("/monitors/view/%d/", id)
+		return Redirect{
+			Location: localRedirect(r.PostFormValue("next"), location),
+			Request:  r, Status: http.StatusSeeOther,
+		}
+	}
 }
 
 func exportLogsHandlerCSV(w http.ResponseWriter, logs []MonitorLog) {
@@ -159,28 +159,33 @@ func MarkLong(t *testing.T) {
 
 func TestDashboardHandler(t *testing.T) {
 	defer InitTestConnection(t)()
-	tw := getTemplateWriter(t, dashboardHandler(nil, nil))
+	r := MustRequest(t, "GET", "/", nil)
+	tw := getTemplateWriter(t, dashboardHandler(r, nil))
 	if tw.Err != nil {
 		t.Errorf("dashboardHandler returned an error: %v", tw.Err)
 	}
 
-	monitors := tw.TmplArgs.([]struct {
-		Id    int
-		Name  string
-		Type  string
-		Event EventType
-	})
+	dashboard := tw.TmplArgs.(Dashboard)
+	monitors := dashboard.Monitors
+	stats := DashboardStats{Total: 4, Up: 3, Down: 1}
+	if dashboard.Stats != stats {
+		t.Errorf("Wanted stats %+v; got: %+v", stats, dashboard.Stats)
+	}
 
-	expected := []struct {
-		Id    int
-		Name  string
-		Type  string
-		Event EventType
-	}{
-		{1, "TCP/UDP Socket", "socket", MonitorUpEvent},
-		{2, "HTTP(s) Server", "http", MonitorUpEvent},
-		{3, "Main Server", "ping", MonitorUpEvent},
-		{4, "Down server", "ping", MonitorDownEvent},
+	if dashboard.Page.Page != 1 || dashboard.Page.Pages() != 1 {
+		t.Errorf("Wanted a single page; got: %+v", dashboard.Page)
+	}
+
+	if len(dashboard.Uptime) != len(monitors) {
+		t.Errorf("Wanted the uptime of %v monitors; got: %v",
+			len(monitors), len(dashboard.Uptime))
+	}
+
+	expected := []MonitorStatus{
+		{1, "TCP/UDP Socket", "socket", MonitorUpEvent, MonitorSettings{}},
+		{2, "HTTP(s) Server", "http", MonitorUpEvent, MonitorSettings{}},
+		{3, "Main Server", "ping", MonitorUpEvent, MonitorSettings{}},
+		{4, "Down server", "ping", MonitorDownEvent, MonitorSettings{}},
 	}
 
 	if len(expected) != len(monitors) {
@@ -198,28 +203,26 @@ func TestDashboardHandler(t *testing.T) {
 }
 
 func assertAddMonitorTemplate(t *testing.T, err string, o interface{}) {
-
-	data := o.(struct {
-		Values []string
-		Err    string
-	})
+	data := o.(MonitorForm)
 	if data.Err != err {
 		t.Errorf("Template shows a validation error: %v", data.Err)
 	}
 
 	diff := false
 	for i, r := range SupportedTypes {
-		if r != data.Values[i] {
+		if i >= len(data.Types) || r != data.Types[i].Name {
 			diff = true
 		}
 	}
 
-	if len(data.Values) != len(SupportedTypes) || diff {
-		t.Errorf("%#v != %#v", SupportedTypes, data.Values)
+	if len(data.Types) != len(SupportedTypes) || diff {
+		t.Errorf("%#v != %#v", SupportedTypes, data.Types)
 	}
 }
 
 func TestAddMonitorGetHandler(t *testing.T) {
+	// The form loads the notification channels.
+	defer InitTestConnection(t)()
 	tw := getTemplateWriter(t, addMonitorGetHandler(nil, nil))
 
 	if tw.Err != nil {
@@ -230,10 +233,7 @@ func TestAddMonitorGetHandler(t *testing.T) {
 }
 
 func assertAddMonitorErrMsg(t *testing.T, tw TemplateWriter, expected string) {
-	err := tw.TmplArgs.(struct {
-		Values []string
-		Err    string
-	}).Err
+	err := tw.TmplArgs.(MonitorForm).Err
 	if err != expected {
 		msg := "Wanted template error message to be: %q, got: %q"
 		t.Errorf(msg, expected, err)
@@ -257,6 +257,22 @@ func TestAddMonitorPostHandlerErrorNoName(t *testing.T) {
 	assertAddMonitorErrMsg(t, tw, "A name for the monitor is required.")
 }
 
+func TestAddMonitorPostHandlerErrorInvalidType(t *testing.T) {
+	defer InitTestConnection(t)()
+
+	for _, mType := range []string{"", "hello", "Socket", "sock"} {
+		data := url.Values{}
+		data.Set("name", "foo")
+		data.Set("type", mType)
+
+		r := MustRequest(t, "POST", "", strings.NewReader(data.Encode()))
+		r.Header.Set("Content-Type", ContentTypeURLEncoded)
+
+		tw := getTemplateWriter(t, addMonitorPostHandler(r, nil))
+		assertAddMonitorErrMsg(t, tw, "Please select a valid type.")
+	}
+}
+
 func TestAddMonitorPostHandlerErrorInvalidForm(t *testing.T) {
 	defer InitTestConnection(t)()
 	r := MustRequest(t, "POST", "", strings.NewReader("%"))
@@ -282,6 +298,7 @@ func TestAddMonitorPostHandler(t *testing.T) {
 	type testcase struct {
 		name   string
 		mType  string
+		target string
 		paused bool
 	}
 
@@ -299,6 +316,7 @@ func TestAddMonitorPostHandler(t *testing.T) {
 		form := url.Values{}
 		form.Set("name", row.name)
 		form.Set("type", row.mType)
+		form.Set("target", row.target)
 		form.Set("paused", paused2str(row.paused))
 
 		r := MustRequest(t, "POST", "", strings.NewReader(form.Encode()))
@@ -328,6 +346,11 @@ func TestAddMonitorPostHandler(t *testing.T) {
 		}
 
 		assertMonitor(t, monitor, mId, row.name, row.mType)
+		if monitor.Settings.Target != row.target {
+			msg := "Wanted monitor %q's target to be: %q, got: %q"
+			t.Errorf(msg, row.name, row.target, monitor.Settings.Target)
+		}
+
 		logs := []MonitorLog{}
 		err = db.Model(&logs).Where("monitor_id = ?", mId).Select()
 		if err != nil {
@@ -359,9 +382,9 @@ func TestAddMonitorPostHandler(t *testing.T) {
 	}
 
 	cases := []testcase{
-		{"foo", "hello", true},
-		{"bar", "world", true},
-		{"started", "ping", false},
+		{"foo", "http", "http://localhost/", true},
+		{"bar", "socket", "localhost:22", true},
+		{"started", "ping", "localhost", false},
 	}
 
 	for _, row := range cases {
@@ -386,12 +409,16 @@ func TestViewMonitorHandler(t *testing.T) {
 
 	for _, row := range cases {
 		params := httprouter.Params{{Key: "id", Value: strconv.Itoa(row.id)}}
-		tw := getTemplateWriter(t, viewMonitorHandler(nil, params))
+		r := MustRequest(t, "GET", "/monitors/view/1/", nil)
+		tw := getTemplateWriter(t, viewMonitorHandler(r, params))
 		if tw.Err != nil {
 			t.Errorf("TemplateWriter contains an error: %v", tw.Err)
 		} else {
-			monitor := tw.TmplArgs.(Monitor)
-			assertMonitor(t, monitor, row.id, row.name, row.mType)
+			view := tw.TmplArgs.(MonitorView)
+			assertMonitor(t, view.Monitor, row.id, row.name, row.mType)
+			if view.Range.Name != "24h" {
+				t.Errorf("The default range is %q, wanted: 24h", view.Range.Name)
+			}
 		}
 	}
 }
@@ -401,7 +428,8 @@ func TestViewMonitorHandlerNotFound(t *testing.T) {
 	testcase := []string{"5", "abc", "foo", "Bar", "100", "-1", "6"}
 	for _, id := range testcase {
 		param := httprouter.Params{httprouter.Param{Key: "id", Value: id}}
-		tw := getTemplateWriter(t, viewMonitorHandler(nil, param))
+		r := MustRequest(t, "GET", "/monitors/view/"+id+"/", nil)
+		tw := getTemplateWriter(t, viewMonitorHandler(r, param))
 		if tw.Err == nil {
 			msg := "Expceted TemplateWriter to contain " +
 				"an error for id: %q. TemplateWriter: %#v"
@@ -430,6 +458,165 @@ func TestViewMonitorHandlerNotFound(t *testing.T) {
 	}
 }
 
+func assertMonitorNotFound(t *testing.T, page Page, id string) {
+	tw := getTemplateWriter(t, page)
+	if err, ok := tw.Err.(StatusError); !ok || err != errMonitorNotFound {
+		t.Errorf("Wanted monitor %q not to be found, got error: %v", id, tw.Err)
+	}
+}
+
+func TestEditMonitorGetHandler(t *testing.T) {
+	defer InitTestConnection(t)()
+	params := httprouter.Params{{Key: "id", Value: "2"}}
+	tw := getTemplateWriter(t, editMonitorGetHandler(nil, params))
+	if tw.Err != nil {
+		t.Fatalf("editMonitorGetHandler returned an error: %v", tw.Err)
+	}
+
+	assertAddMonitorTemplate(t, "", tw.TmplArgs)
+	form := tw.TmplArgs.(MonitorForm)
+	assertMonitor(t, form.Monitor, 2, "HTTP(s) Server", "http")
+	if !form.Editing() || form.Monitor.Settings.Target != "http://localhost:8092/" {
+		t.Errorf("The form does not show the existing monitor: %#v", form.Monitor)
+	}
+
+	for _, id := range []string{"abc", "100"} {
+		params := httprouter.Params{{Key: "id", Value: id}}
+		assertMonitorNotFound(t, editMonitorGetHandler(nil, params), id)
+	}
+}
+
+func TestEditMonitorPostHandler(t *testing.T) {
+	defer InitTestConnection(t)()
+	form := url.Values{}
+	form.Set("name", "Renamed")
+	form.Set("type", "ping")
+	form.Set("target", "example.com")
+	form.Set("interval", "120")
+
+	params := httprouter.Params{{Key: "id", Value: "2"}}
+	page := editMonitorPostHandler(postForm(t, form), params)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/monitors/view/2/" {
+		t.Fatalf("Wanted a redirect to the monitor, got: %#v", page)
+	}
+
+	monitor := Monitor{Id: 2}
+	if err := db.Select(&monitor); err != nil {
+		t.Fatalf("Could not fetch monitor from database: %v", err)
+	}
+
+	assertMonitor(t, monitor, 2, "Renamed", "ping")
+	if monitor.Settings.Target != "example.com" || monitor.Settings.Interval != 120 {
+		t.Errorf("Settings have not been updated: %#v", monitor.Settings)
+	}
+
+	form.Set("name", "")
+	tw := getTemplateWriter(t, editMonitorPostHandler(postForm(t, form), params))
+	assertAddMonitorErrMsg(t, tw, "A name for the monitor is required.")
+	if id := tw.TmplArgs.(MonitorForm).Monitor.Id; id != 2 {
+		t.Errorf("The form lost the id of the monitor: %v", id)
+	}
+}
+
+func TestDeleteMonitorHandlers(t *testing.T) {
+	defer InitTestConnection(t)()
+	params := httprouter.Params{{Key: "id", Value: "1"}}
+	tw := getTemplateWriter(t, deleteMonitorGetHandler(nil, params))
+	if tw.Err != nil {
+		t.Fatalf("deleteMonitorGetHandler returned an error: %v", tw.Err)
+	}
+
+	assertMonitor(t, tw.TmplArgs.(Monitor), 1, "TCP/UDP Socket", "socket")
+
+	r := MustRequest(t, "POST", "", nil)
+	page := deleteMonitorPostHandler(r, params)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/" {
+		t.Fatalf("Wanted a redirect to the dashboard, got: %#v", page)
+	}
+
+	if err := db.Select(&Monitor{Id: 1}); err == nil {
+		t.Errorf("Monitor 1 has not been deleted")
+	}
+
+	n, err := db.Model(&MonitorLog{}).Where("monitor_id = ?", 1).Count()
+	if err != nil || n != 0 {
+		t.Errorf("The logs of monitor 1 have not been deleted: %v, %v", n, err)
+	}
+
+	assertMonitorNotFound(t, deleteMonitorPostHandler(r, params), "1")
+	assertMonitorNotFound(t, deleteMonitorGetHandler(nil, params), "1")
+}
+
+func TestLocalRedirect(t *testing.T) {
+	testcase := []struct {
+		next, expected string
+	}{
+		{"/", "/"},
+		{"/monitors/view/1/", "/monitors/view/1/"},
+		{"", "/fallback"},
+		{"http://example.com/", "/fallback"},
+		{"//example.com/", "/fallback"},
+		{"/\\example.com/", "/fallback"},
+	}
+
+	for _, row := range testcase {
+		if l := localRedirect(row.next, "/fallback"); l != row.expected {
+			t.Errorf("localRedirect(%q) => %q, wanted: %q", row.next, l, row.expected)
+		}
+	}
+}
+
+func TestPauseMonitorHandler(t *testing.T) {
+	defer InitTestConnection(t)()
+	params := httprouter.Params{{Key: "id", Value: "2"}}
+	latestEvent := func() EventType {
+		log := MonitorLog{}
+		err := db.Model(&log).Where("monitor_id = ?", 2).
+			Order("date DESC, id DESC").Limit(1).Select()
+		if err != nil {
+			t.Fatalf("Could not fetch the latest log: %v", err)
+		}
+
+		return log.Event
+	}
+
+	testcase := []struct {
+		paused   bool
+		next     string
+		expected EventType
+		location string
+	}{
+		{true, "/", MonitorPausedEvent, "/"},
+		{true, "", MonitorPausedEvent, "/monitors/view/2/"},
+		{false, "http://example.com", MonitorStartedEvent, "/monitors/view/2/"},
+	}
+
+	for _, row := range testcase {
+		form := url.Values{"next": {row.next}}
+		page := pauseMonitorHandler(row.paused)(postForm(t, form), params)
+		redirect, ok := page.(Redirect)
+		if !ok || redirect.Location != row.location {
+			t.Errorf("Wanted a redirect to %q, got: %#v", row.location, page)
+		}
+
+		if e := latestEvent(); e != row.expected {
+			t.Errorf("Latest event after pause=%v: %v, wanted: %v", row.paused, e, row.expected)
+		}
+	}
+
+	n, err := db.Model(&MonitorLog{}).Where("monitor_id = ? AND event = ?",
+		2, MonitorPausedEvent).Count()
+	if err != nil || n != 1 {
+		t.Errorf("Pausing twice logged %d paused events (%v), wanted 1", n, err)
+	}
+
+	for _, id := range []string{"abc", "100"} {
+		params := httprouter.Params{{Key: "id", Value: id}}
+		page := pauseMonitorHandler(true)(postForm(t, url.Values{}), params)
+		assertMonitorNotFound(t, page, id)
+	}
+}
+
 func exportLogsAssertRecorder(t *testing.T, recorder *httptest.ResponseRecorder, code int, contentType, body string) {
 	if recorder.Code != code {
 		t.Errorf("Expected to record code: %v, got: %v", code, recorder.Code)
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/pg.v4"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// incidentsShown is the number of incidents shown on the page
+// of a monitor.
+const incidentsShown = 10
+
+var (
+	errIncidentNotFound = StatusError{
+		Status:  http.StatusNotFound,
+		Message: "Incident could not be found",
+	}
+
+	errEmptyNote = StatusError{
+		Status:  http.StatusBadRequest,
+		Message: "The note cannot be empty",
+	}
+
+	errInvalidAssignee = StatusError{
+		Status:  http.StatusBadRequest,
+		Message: "The incident can only be assigned to users",
+	}
+
+	errIncidentResolved = StatusError{
+		Status:  http.StatusConflict,
+		Message: "The incident has already been resolved",
+	}
+)
+
+// Incident is an outage of a monitor: it is opened when the monitor
+// goes down and resolved when it comes back up. Acknowledging an
+// incident stops the escalation of the outage.
+type Incident struct {
+	Id        int
+	MonitorId int
+	Started   time.Time
+
+	// Resolved is the zero time (NULL) while the monitor is down.
+	Resolved time.Time `sql:",null"`
+
+	// Reason is the reason of the down event.
+	Reason string
+
+	// Acknowledged is the zero time (NULL) until a user
+	// acknowledges the incident.
+	Acknowledged   time.Time `sql:",null"`
+	AcknowledgedBy string
+
+	// Assignee is the name of the user who is working on the
+	// incident (or empty).
+	Assignee string
+
+	// Resolution describes what caused the outage and how it
+	// has been fixed.
+	Resolution string
+
+	// Notes are ordered by date (oldest first).
+	Notes []IncidentNote
+}
+
+// IsResolved is true if the monitor is up again.
+func (i Incident) IsResolved() bool {
+	return !i.Resolved.IsZero()
+}
+
+// IsAcknowledged is true if a user has acknowledged the incident.
+func (i Incident) IsAcknowledged() bool {
+	return !i.Acknowledged.IsZero()
+}
+
+// Duration returns how long the monitor has been down (rounded to
+// seconds). It is zero while the incident is ongoing.
+func (i Incident) Duration() time.Duration {
+	if !i.IsResolved() {
+		return 0
+	}
+
+	return i.Resolved.Sub(i.Started).Round(time.Second)
+}
+
+// IncidentNote is an entry in the timeline of an incident.
+type IncidentNote struct {
+	Id         int
+	IncidentId int
+
+	// Author is the name of the user who wrote the note.
+	Author string
+	Date   time.Time
+	Text   string
+}
+
+// updateIncident opens an incident when the monitor goes down (unless
+// one is still open) and resolves it when the monitor comes back up.
+func updateIncident(tx *pg.Tx, entry MonitorLog) error {
+	switch entry.Event {
+	case MonitorDownEvent:
+		n, err := tx.Model(&Incident{}).
+			Where("monitor_id = ? AND resolved IS NULL", entry.MonitorId).Count()
+		if err != nil || n > 0 {
+			return err
+		}
+
+		return tx.Create(&Incident{
+			MonitorId: entry.MonitorId,
+			Started:   entry.Date,
+			Reason:    entry.Reason,
+		})
+	case MonitorUpEvent:
+		_, err := tx.Model(&Incident{}).Set("resolved = ?", entry.Date).
+			Where("monitor_id = ? AND resolved IS NULL", entry.MonitorId).Update()
+		return err
+	}
+
+	return nil
+}
+
+// outageAcknowledged is true if the incident of the outage of the
+// monitor that started at since has been acknowledged. Outages that
+// started before incidents were tracked have no incident, so one is
+// opened (which can then be acknowledged).
+func outageAcknowledged(monitorID int, since time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The monitor is locked like in recordCheckResult, so that it
+	// cannot come back up while the incident is opened.
+	_, err = tx.Exec("SELECT id FROM monitors WHERE id = ? FOR UPDATE", monitorID)
+	if err != nil {
+		return false, err
+	}
+
+	incident := Incident{}
+	err = tx.Model(&incident).
+		Where("monitor_id = ? AND resolved IS NULL AND started <= ?", monitorID, since).
+		Order("started DESC").Limit(1).Select()
+	if err == nil {
+		return incident.IsAcknowledged(), nil
+	} else if err != pg.ErrNoRows {
+		return false, err
+	}
+
+	last := MonitorLog{}
+	err = tx.Model(&last).Where("monitor_id = ?", monitorID).
+		Order("date DESC, id DESC").Limit(1).Select()
+	if err == pg.ErrNoRows || (err == nil && last.Event != MonitorDownEvent) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := updateIncident(tx, last); err != nil {
+		return false, err
+	}
+
+	return false, tx.Commit()
+}
+
+// loadIncidents loads the latest incidents of the monitor (the
+// latest first) along with their notes.
+func loadIncidents(q queryer, monitorID, limit int) ([]Incident, error) {
+	incidents := []Incident{}
+	err := q.Model(&incidents).Where("monitor_id = ?", monitorID).
+		Order("started DESC, id DESC").Limit(limit).Select()
+	if err != nil || len(incidents) == 0 {
+		return incidents, err
+	}
+
+	ids := make([]int, len(incidents))
+	for i, incident := range incidents {
+		ids[i] = incident.Id
+	}
+
+	notes := []IncidentNote{}
+	err = q.Model(&notes).Where("incident_id IN (?)", pg.In(ids)).
+		Order("date ASC, id ASC").Select()
+
+	for _, note := range notes {
+		for i := range incidents {
+			if incidents[i].Id == note.IncidentId {
+				incidents[i].Notes = append(incidents[i].Notes, note)
+			}
+		}
+	}
+
+	return incidents, err
+}
+
+// loadIncident loads the incident whose id is in params. The error
+// is errIncidentNotFound if there is no such incident.
+func loadIncident(params httprouter.Params) (Incident, HTTPError) {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return Incident{}, errIncidentNotFound
+	}
+
+	incident := Incident{Id: id}
+	if err := db.Select(&incident); err == pg.ErrNoRows {
+		return incident, errIncidentNotFound
+	} else if err != nil {
+		return incident, NewDatabaseError(err)
+	}
+
+	return incident, nil
+}
+
+// incidentRedirect redirects to the page of the incident's monitor.
+func incidentRedirect(r *http.Request, incident Incident) Page {
+	location := "/monitors/view/" + strconv.Itoa(incident.MonitorId) + "/"
+	return Redirect{Location: location, Request: r, Status: http.StatusSeeOther}
+}
+
+// userName returns the name of the user who is logged in.
+func userName(r *http.Request) string {
+	if user := UserFromRequest(r); user != nil {
+		return user.Name
+	}
+
+	return ""
+}
+
+// acknowledgeIncident acknowledges the incident on behalf of the
+// user. If no one has been assigned yet, the incident is assigned to
+// the user. Only the columns of the acknowledgement are updated, so
+// that the incident can be resolved (or assigned) at the same time.
+func acknowledgeIncident(incident Incident, user string) HTTPError {
+	if incident.IsResolved() {
+		return errIncidentResolved
+	} else if incident.IsAcknowledged() {
+		return nil
+	}
+
+	res, err := db.Model(&Incident{}).
+		Set("acknowledged = ?, acknowledged_by = ?, assignee = COALESCE(NULLIF(assignee, ''), ?)",
+			time.Now(), user, user).
+		Where("id = ? AND acknowledged IS NULL AND resolved IS NULL", incident.Id).
+		Update()
+	if err != nil {
+		return NewDatabaseError(err)
+	} else if res.Affected() > 0 {
+		return nil
+	}
+
+	// The incident has been acknowledged or resolved in the meantime.
+	if err := db.Select(&incident); err == pg.ErrNoRows {
+		return errIncidentNotFound
+	} else if err != nil {
+		return NewDatabaseError(err)
+	} else if incident.IsResolved() && !incident.IsAcknowledged() {
+		return errIncidentResolved
+	}
+
+	return nil
+}
+
+// acknowledgeIncidentHandler acknowledges the incident (see
+// acknowledgeIncident).
+func acknowledgeIncidentHandler(r *http.Request, params httprouter.Params) Page {
+	incident, httpErr := loadIncident(params)
+	if httpErr == nil {
+		httpErr = acknowledgeIncident(incident, userName(r))
+	}
+
+	if httpErr != nil {
+		return defaultTW.SetError(httpErr)
+	}
+
+	return incidentRedirect(r, incident)
+}
+
+// assignIncidentHandler assigns the incident to a user (or to no one
+// if the name is empty).
+func assignIncidentHandler(r *http.Request, params httprouter.Params) Page {
+	incident, httpErr := loadIncident(params)
+	if httpErr != nil {
+		return defaultTW.SetError(httpErr)
+	}
+
+	assignee := r.PostFormValue("assignee")
+	if assignee != "" {
+		n, err := db.Model(&User{}).Where("name = ?", assignee).Count()
+		if err != nil {
+			return defaultTW.SetError(NewDatabaseError(err))
+		} else if n == 0 {
+			return defaultTW.SetError(errInvalidAssignee)
+		}
+	}
+
+	_, err := db.Model(&Incident{}).Set("assignee = ?", assignee).
+		Where("id = ?", incident.Id).Update()
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	return incidentRedirect(r, incident)
+}
+
+// addIncidentNoteHandler adds a note to the timeline of the incident.
+func addIncidentNoteHandler(r *http.Request, params httprouter.Params) Page {
+	incident, httpErr := loadIncident(params)
+	if httpErr != nil {
+		return defaultTW.SetError(httpErr)
+	}
+
+	text := strings.TrimSpace(r.PostFormValue("text"))
+	if text == "" {
+		return defaultTW.SetError(errEmptyNote)
+	}
+
+	note := IncidentNote{
+		IncidentId: incident.Id,
+		Author:     userName(r),
+		Date:       time.Now(),
+		Text:       text,
+	}
+
+	if err := db.Create(&note); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	return incidentRedirect(r, incident)
+}
+
+// incidentResolutionHandler changes the resolution note of the
+// incident.
+func incidentResolutionHandler(r *http.Request, params httprouter.Params) Page {
+	incident, httpErr := loadIncident(params)
+	if httpErr != nil {
+		return defaultTW.SetError(httpErr)
+	}
+
+	resolution := strings.TrimSpace(r.PostFormValue("resolution"))
+	_, err := db.Model(&Incident{}).Set("resolution = ?", resolution).
+		Where("id = ?", incident.Id).Update()
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	return incidentRedirect(r, incident)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestIncident(t *testing.T) {
+	start := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	i := Incident{Started: start}
+	if i.IsResolved() || i.IsAcknowledged() || i.Duration() != 0 {
+		t.Errorf("Unexpected ongoing incident: resolved %v, acknowledged %v, duration %v",
+			i.IsResolved(), i.IsAcknowledged(), i.Duration())
+	}
+
+	i.Acknowledged = start.Add(time.Minute)
+	i.Resolved = start.Add(90*time.Minute + 400*time.Millisecond)
+	if !i.IsResolved() || !i.IsAcknowledged() || i.Duration() != 90*time.Minute {
+		t.Errorf("Unexpected resolved incident: resolved %v, acknowledged %v, duration %v",
+			i.IsResolved(), i.IsAcknowledged(), i.Duration())
+	}
+}
+
+func TestIncidentLifecycle(t *testing.T) {
+	defer InitTestConnection(t)()
+
+	monitor := Monitor{Name: "Incidents", Type: "http"}
+	if err := db.Create(&monitor); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := User{Name: "alice", Role: EditorRole, PasswordHash: "x", Created: time.Now()}
+	if err := db.Create(&alice); err != nil {
+		t.Fatal(err)
+	}
+
+	asAlice := func(r *http.Request) *http.Request {
+		return withUser(r, &alice)
+	}
+
+	if _, ok, err := recordCheckResult(monitor.Id, CheckResult{Up: false, Reason: "refused"}); !ok || err != nil {
+		t.Fatalf("The down event has not been logged: %v", err)
+	}
+
+	incidents, err := loadIncidents(db, monitor.Id, incidentsShown)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(incidents) != 1 || incidents[0].IsResolved() || incidents[0].Reason != "refused" {
+		t.Fatalf("Unexpected incidents: %#v", incidents)
+	}
+
+	incident := incidents[0]
+	if ack, err := outageAcknowledged(monitor.Id, incident.Started); ack || err != nil {
+		t.Errorf("outageAcknowledged() = %v, %v before acknowledging", ack, err)
+	}
+
+	params := httprouter.Params{{Key: "id", Value: strconv.Itoa(incident.Id)}}
+	location := "/monitors/view/" + strconv.Itoa(monitor.Id) + "/"
+	assertRedirect := func(page Page) {
+		if redirect, ok := page.(Redirect); !ok || redirect.Location != location {
+			t.Errorf("Wanted a redirect to the monitor, got: %#v", page)
+		}
+	}
+
+	assertRedirect(acknowledgeIncidentHandler(asAlice(MustRequest(t, "POST", "", nil)), params))
+	if ack, err := outageAcknowledged(monitor.Id, incident.Started); !ack || err != nil {
+		t.Errorf("outageAcknowledged() = %v, %v after acknowledging", ack, err)
+	}
+
+	form := url.Values{"text": {"Restarting the server"}}
+	assertRedirect(addIncidentNoteHandler(asAlice(postForm(t, form)), params))
+
+	form = url.Values{"text": {" "}}
+	tw := getTemplateWriter(t, addIncidentNoteHandler(asAlice(postForm(t, form)), params))
+	if tw.Err != errEmptyNote {
+		t.Errorf("Wanted errEmptyNote; got: %v", tw.Err)
+	}
+
+	form = url.Values{"assignee": {"bob"}}
+	tw = getTemplateWriter(t, assignIncidentHandler(asAlice(postForm(t, form)), params))
+	if tw.Err != errInvalidAssignee {
+		t.Errorf("Wanted errInvalidAssignee; got: %v", tw.Err)
+	}
+
+	form = url.Values{"resolution": {"The disk was full."}}
+	assertRedirect(incidentResolutionHandler(asAlice(postForm(t, form)), params))
+
+	if _, ok, err := recordCheckResult(monitor.Id, CheckResult{Up: true}); !ok || err != nil {
+		t.Fatalf("The up event has not been logged: %v", err)
+	}
+
+	incidents, err = loadIncidents(db, monitor.Id, incidentsShown)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(incidents) != 1 {
+		t.Fatalf("Loaded %d incidents, wanted: 1", len(incidents))
+	}
+
+	incident = incidents[0]
+	if !incident.IsResolved() || !incident.IsAcknowledged() || incident.AcknowledgedBy != "alice" ||
+		incident.Assignee != "alice" || incident.Resolution != "The disk was full." {
+		t.Errorf("Unexpected incident: %#v", incident)
+	}
+
+	if len(incident.Notes) != 1 || incident.Notes[0].Author != "alice" ||
+		incident.Notes[0].Text != "Restarting the server" {
+		t.Errorf("Unexpected notes: %#v", incident.Notes)
+	}
+
+	// The next outage opens a new incident.
+	recordCheckResult(monitor.Id, CheckResult{Up: false})
+	incidents, err = loadIncidents(db, monitor.Id, incidentsShown)
+	if err != nil || len(incidents) != 2 || incidents[0].IsResolved() || incidents[0].IsAcknowledged() {
+		t.Errorf("Unexpected incidents: %#v, %v", incidents, err)
+	}
+
+	tw = getTemplateWriter(t, acknowledgeIncidentHandler(MustRequest(t, "POST", "", nil),
+		httprouter.Params{{Key: "id", Value: "1000"}}))
+	if tw.Err != errIncidentNotFound {
+		t.Errorf("Wanted errIncidentNotFound; got: %v", tw.Err)
+	}
+}
+
+func TestAcknowledgeResolvedIncident(t *testing.T) {
+	defer InitTestConnection(t)()
+
+	monitor := Monitor{Name: "Incidents", Type: "http"}
+	if err := db.Create(&monitor); err != nil {
+		t.Fatal(err)
+	}
+
+	recordCheckResult(monitor.Id, CheckResult{Up: false, Reason: "refused"})
+	incidents, err := loadIncidents(db, monitor.Id, incidentsShown)
+	if err != nil || len(incidents) != 1 {
+		t.Fatalf("Unexpected incidents: %#v, %v", incidents, err)
+	}
+
+	// The monitor comes back up after the incident has been loaded.
+	recordCheckResult(monitor.Id, CheckResult{Up: true})
+	if httpErr := acknowledgeIncident(incidents[0], "alice"); httpErr != errIncidentResolved {
+		t.Errorf("Wanted errIncidentResolved; got: %v", httpErr)
+	}
+
+	incident := Incident{Id: incidents[0].Id}
+	if err := db.Select(&incident); err != nil {
+		t.Fatal(err)
+	} else if !incident.IsResolved() || incident.IsAcknowledged() || incident.Assignee != "" {
+		t.Errorf("Unexpected incident: %#v", incident)
+	}
+
+	recordCheckResult(monitor.Id, CheckResult{Up: false})
+	incidents, err = loadIncidents(db, monitor.Id, incidentsShown)
+	if err != nil || len(incidents) != 2 || incidents[0].IsResolved() {
+		t.Errorf("The next outage has not opened an incident: %#v, %v", incidents, err)
+	}
+}
+
+func TestOutageAcknowledgedWithoutIncident(t *testing.T) {
+	defer InitTestConnection(t)()
+
+	monitor := Monitor{Name: "Incidents", Type: "http"}
+	if err := db.Create(&monitor); err != nil {
+		t.Fatal(err)
+	}
+
+	// The monitor went down before incidents were tracked.
+	since := time.Now().Add(-time.Hour)
+	down := MonitorLog{MonitorId: monitor.Id, Event: MonitorDownEvent, Date: since, Reason: "timeout"}
+	if err := db.Create(&down); err != nil {
+		t.Fatal(err)
+	}
+
+	if ack, err := outageAcknowledged(monitor.Id, since); ack || err != nil {
+		t.Fatalf("outageAcknowledged() = %v, %v before acknowledging", ack, err)
+	}
+
+	incidents, err := loadIncidents(db, monitor.Id, incidentsShown)
+	if err != nil || len(incidents) != 1 || incidents[0].IsResolved() || incidents[0].Reason != "timeout" {
+		t.Fatalf("Unexpected incidents: %#v, %v", incidents, err)
+	}
+
+	if httpErr := acknowledgeIncident(incidents[0], "alice"); httpErr != nil {
+		t.Fatalf("Unexpected error: %v", httpErr)
+	}
+
+	if ack, err := outageAcknowledged(monitor.Id, since); !ack || err != nil {
+		t.Errorf("outageAcknowledged() = %v, %v after acknowledging", ack, err)
+	}
+}
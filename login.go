@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/pg.v4"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	loginTmpl = MustTemplate(NewBareboneTemplate("login.html"))
+	setupTmpl = MustTemplate(NewBareboneTemplate("setup.html"))
+)
+
+// errLoginFailed does not reveal whether the user exists.
+const errLoginFailed = "The name or password is incorrect."
+
+// dummyUser's password is checked if a user does not exist so
+// that failed logins take the same time either way.
+var dummyUser = func() User {
+	u := User{}
+	u.SetPassword("upchecker")
+	return u
+}()
+
+// CookiePage sets a cookie before executing the page.
+type CookiePage struct {
+	Page
+	Cookie *http.Cookie
+}
+
+// Execute sets the cookie and executes the page.
+func (p CookiePage) Execute(w http.ResponseWriter) bool {
+	http.SetCookie(w, p.Cookie)
+	return p.Page.Execute(w)
+}
+
+// LoginForm is passed to the login and setup templates.
+type LoginForm struct {
+	Name string
+	Next string
+	Err  string
+}
+
+func loginGetHandler(r *http.Request, _ httprouter.Params) Page {
+	form := LoginForm{Next: localRedirect(r.URL.Query().Get("next"), "/")}
+	return defaultTW.SetTemplate(loginTmpl).SetTmplArgs(form)
+}
+
+// loginPostHandler logs the user in and redirects to the page
+// in the form value "next".
+func loginPostHandler(r *http.Request, _ httprouter.Params) Page {
+	form := LoginForm{
+		Name: strings.TrimSpace(r.PostFormValue("name")),
+		Next: localRedirect(r.PostFormValue("next"), "/"),
+	}
+
+	user := User{}
+	err := db.Model(&user).Where("name = ?", form.Name).Select()
+	if err == pg.ErrNoRows {
+		dummyUser.CheckPassword(r.PostFormValue("password"))
+	} else if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	if err != nil || !user.CheckPassword(r.PostFormValue("password")) {
+		form.Err = errLoginFailed
+		return defaultTW.SetTemplate(loginTmpl).SetTmplArgs(form).
+			SetStatusCode(http.StatusUnauthorized)
+	}
+
+	return logIn(r, user, form.Next)
+}
+
+// logIn creates a session for the user and redirects to next.
+func logIn(r *http.Request, user User, next string) Page {
+	cookie, err := createSession(r, user)
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	return CookiePage{
+		Page:   Redirect{Location: next, Request: r, Status: http.StatusSeeOther},
+		Cookie: cookie,
+	}
+}
+
+// logoutHandler deletes the session and its cookie.
+func logoutHandler(r *http.Request, _ httprouter.Params) Page {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		_, err := db.Model(&Session{}).Where("hash = ?", hashToken(cookie.Value)).Delete()
+		if err != nil {
+			return defaultTW.SetError(NewDatabaseError(err))
+		}
+	}
+
+	return CookiePage{
+		Page:   Redirect{Location: "/login/", Request: r, Status: http.StatusSeeOther},
+		Cookie: sessionCookie(r, "", time.Time{}),
+	}
+}
+
+// setupGetHandler shows the form creating the first user. Once
+// there is a user, the login page is shown instead.
+func setupGetHandler(r *http.Request, _ httprouter.Params) Page {
+	if ok, err := hasUsers(); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if ok {
+		return Redirect{Location: "/login/", Request: r, Status: http.StatusSeeOther}
+	}
+
+	return defaultTW.SetTemplate(setupTmpl).SetTmplArgs(LoginForm{})
+}
+
+// setupPostHandler creates the first user (who is an admin)
+// and logs the user in.
+func setupPostHandler(r *http.Request, _ httprouter.Params) Page {
+	form := LoginForm{Name: strings.TrimSpace(r.PostFormValue("name"))}
+	password := r.PostFormValue("password")
+	if form.Name == "" {
+		form.Err = "A name is required."
+	} else if err := validatePassword(password, r.PostFormValue("confirmation")); err != nil {
+		form.Err = err.Error()
+	}
+
+	if form.Err != "" {
+		return defaultTW.SetTemplate(setupTmpl).SetTmplArgs(form)
+	}
+
+	user := User{Name: form.Name, Role: AdminRole, Created: time.Now()}
+	if err := user.SetPassword(password); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	created, err := createFirstUser(&user)
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if !created {
+		return Redirect{Location: "/login/", Request: r, Status: http.StatusSeeOther}
+	}
+
+	return logIn(r, user, "/")
+}
+
+// createFirstUser creates the user unless there already is one.
+// The table is locked so that concurrent requests to the setup
+// page cannot create more than one user.
+func createFirstUser(user *User) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("LOCK TABLE users IN EXCLUSIVE MODE"); err != nil {
+		return false, err
+	}
+
+	n, err := tx.Model(&User{}).Count()
+	if err != nil || n > 0 {
+		return false, err
+	}
+
+	if err := tx.Create(user); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCookiePage(t *testing.T) {
+	r := MustRequest(t, "POST", "/login/", nil)
+	page := CookiePage{
+		Page:   Redirect{Location: "/", Request: r, Status: http.StatusSeeOther},
+		Cookie: &http.Cookie{Name: sessionCookieName, Value: "token"},
+	}
+
+	recorder := httptest.NewRecorder()
+	page.Execute(recorder)
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/" {
+		t.Errorf("The page has not been executed: %v %v", recorder.Code, recorder.Header())
+	}
+
+	if c := recorder.Header().Get("Set-Cookie"); c != sessionCookieName+"=token" {
+		t.Errorf("Unexpected cookie: %q", c)
+	}
+}
+
+func TestLoginGetHandler(t *testing.T) {
+	r := MustRequest(t, "GET", "/login/?next=http://example.com/", nil)
+	tw := getTemplateWriter(t, loginGetHandler(r, nil))
+	if form := tw.TmplArgs.(LoginForm); form.Next != "/" {
+		t.Errorf("The login page must only redirect locally: %#v", form)
+	}
+}
+
+// assertLoggedIn checks that page logs the user in and
+// redirects to location.
+func assertLoggedIn(t *testing.T, page Page, location string) {
+	cookiePage, ok := page.(CookiePage)
+	if !ok {
+		t.Fatalf("Wanted a CookiePage; got: %#v", page)
+	}
+
+	if redirect, ok := cookiePage.Page.(Redirect); !ok || redirect.Location != location {
+		t.Errorf("Wanted a redirect to %q; got: %#v", location, cookiePage.Page)
+	}
+
+	if _, err := findSessionUser(hashToken(cookiePage.Cookie.Value)); err != nil {
+		t.Errorf("No session has been created: %v", err)
+	}
+}
+
+func TestSetupAndLoginHandlers(t *testing.T) {
+	defer InitTestConnection(t)()
+	r := MustRequest(t, "GET", "/setup/", nil)
+	if tw := getTemplateWriter(t, setupGetHandler(r, nil)); tw.Err != nil {
+		t.Fatalf("setupGetHandler returned an error: %v", tw.Err)
+	}
+
+	form := url.Values{"name": {"alice"}, "password": {"12345678"}, "confirmation": {"1234"}}
+	tw := getTemplateWriter(t, setupPostHandler(postForm(t, form), nil))
+	if err := tw.TmplArgs.(LoginForm).Err; err != "The passwords do not match." {
+		t.Errorf("Unexpected error: %q", err)
+	}
+
+	form.Set("confirmation", "12345678")
+	assertLoggedIn(t, setupPostHandler(postForm(t, form), nil), "/")
+
+	admin := User{}
+	if err := db.Model(&admin).Where("name = ?", "alice").Select(); err != nil || admin.Role != AdminRole {
+		t.Errorf("The first user needs to be an admin: %#v, %v", admin, err)
+	}
+
+	form.Set("name", "mallory")
+	page := setupPostHandler(postForm(t, form), nil)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/login/" {
+		t.Errorf("A second user has been created by the setup: %#v", page)
+	}
+
+	if redirect, ok := setupGetHandler(r, nil).(Redirect); !ok || redirect.Location != "/login/" {
+		t.Errorf("The setup page is still shown")
+	}
+
+	login := url.Values{"name": {"alice"}, "password": {"12345678"}, "next": {"/settings/users/"}}
+	assertLoggedIn(t, loginPostHandler(postForm(t, login), nil), "/settings/users/")
+
+	for _, row := range []url.Values{
+		{"name": {"alice"}, "password": {"wrong password"}},
+		{"name": {"mallory"}, "password": {"12345678"}},
+	} {
+		tw := getTemplateWriter(t, loginPostHandler(postForm(t, row), nil))
+		if tw.StatusCode != http.StatusUnauthorized || tw.TmplArgs.(LoginForm).Err != errLoginFailed {
+			t.Errorf("Logging in with %v did not fail: %#v", row, tw)
+		}
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	defer InitTestConnection(t)()
+	user := User{Name: "alice", Role: ViewerRole, PasswordHash: "x", Created: time.Now()}
+	if err := db.Create(&user); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie, err := createSession(MustRequest(t, "POST", "/login/", nil), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := MustRequest(t, "POST", "/logout/", nil)
+	r.AddCookie(cookie)
+	page, ok := logoutHandler(r, nil).(CookiePage)
+	if !ok || page.Cookie.MaxAge >= 0 {
+		t.Fatalf("The cookie has not been deleted: %#v", page)
+	}
+
+	if _, err := findSessionUser(hashToken(cookie.Value)); err == nil {
+		t.Errorf("The session has not been deleted")
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"gopkg.in/pg.v4"
 
@@ -11,9 +16,20 @@ import (
 
 var db *pg.DB
 
+// scheduler checks the monitors in the background. It is nil
+// if the scheduler is not running (such as in tests).
+var scheduler *Scheduler
+
 var Debug = true // TODO: Make dynamic.
 
 func main() {
+	publicStatus := flag.Bool("public-status", false,
+		"show the state of all monitors at /status/ without logging in")
+	baseURL := flag.String("base-url", "",
+		"address of the web interface used for links in notifications "+
+			"(such as https://upchecker.example.com)")
+	flag.Parse()
+
 	db = InitConnection()
 	defer func() {
 		log.Println(db.Close())
@@ -23,26 +39,132 @@ func main() {
 	mux := httprouter.New()
 	mux.ServeFiles("/static/*filepath", http.Dir("static"))
 
-	get := func(path string, h UptimeCheckerHandler) {
-		mux.GET(path, MainMiddleware(h))
+	// Every route requires a role (see RequireRole).
+	get := func(path string, role Role, h UptimeCheckerHandler) {
+		mux.GET(path, MainMiddleware(RequireRole(role, h)))
 	}
 
-	post := func(path string, h UptimeCheckerHandler) {
-		mux.POST(path, MainMiddleware(h))
+	post := func(path string, role Role, h UptimeCheckerHandler) {
+		mux.POST(path, MainMiddleware(RequireRole(role, h)))
 	}
 
 	// TODO: Add error 404 handler.
-	get("/", dashboardHandler)
-	get("/monitors/view/:id/", viewMonitorHandler)
-	get("/monitors/add/", addMonitorGetHandler)
-	post("/monitors/add/", addMonitorPostHandler)
+	get("/login/", Anyone, loginGetHandler)
+	post("/login/", Anyone, loginPostHandler)
+	post("/logout/", Anyone, logoutHandler)
+	get("/setup/", Anyone, setupGetHandler)
+	post("/setup/", Anyone, setupPostHandler)
+	get("/", ViewerRole, dashboardHandler)
+	get("/monitors/view/:id/", ViewerRole, viewMonitorHandler)
+	get("/monitors/add/", EditorRole, addMonitorGetHandler)
+	post("/monitors/add/", EditorRole, addMonitorPostHandler)
+	get("/monitors/edit/:id/", EditorRole, editMonitorGetHandler)
+	post("/monitors/edit/:id/", EditorRole, editMonitorPostHandler)
+	get("/monitors/delete/:id/", AdminRole, deleteMonitorGetHandler)
+	post("/monitors/delete/:id/", AdminRole, deleteMonitorPostHandler)
+	post("/monitors/pause/:id/", EditorRole, pauseMonitorHandler(true))
+	post("/monitors/resume/:id/", EditorRole, pauseMonitorHandler(false))
+	post("/incidents/ack/:id/", EditorRole, acknowledgeIncidentHandler)
+	post("/incidents/assign/:id/", EditorRole, assignIncidentHandler)
+	post("/incidents/notes/:id/", EditorRole, addIncidentNoteHandler)
+	post("/incidents/resolution/:id/", EditorRole, incidentResolutionHandler)
+	get("/settings/tokens/", AdminRole, tokenSettingsGetHandler)
+	post("/settings/tokens/", AdminRole, createTokenHandler)
+	post("/settings/tokens/revoke/:id/", AdminRole, revokeTokenHandler)
+	get("/settings/users/", AdminRole, userSettingsGetHandler)
+	post("/settings/users/", AdminRole, createUserHandler)
+	post("/settings/users/delete/:id/", AdminRole, deleteUserHandler)
+	post("/settings/users/role/:id/", AdminRole, changeRoleHandler)
+	get("/settings/channels/", AdminRole, notificationSettingsGetHandler)
+	post("/settings/channels/", AdminRole, createChannelHandler)
+	post("/settings/channels/test/:id/", AdminRole, testChannelHandler)
+	post("/settings/channels/delete/:id/", AdminRole, deleteChannelHandler)
+
+	// The JSON API (see api.go) and the export of the logs
+	// require an API token.
+	tokens := NewTokenAuthenticator()
+	api := func(method, path string, h UptimeCheckerHandler) {
+		mux.Handle(method, APIPrefix+path, tokens.Middleware(MainMiddleware(h)))
+	}
+
+	api("GET", "/status/", apiStatusHandler)
+	api("GET", "/monitors/", apiListMonitorsHandler)
+	api("POST", "/monitors/", apiCreateMonitorHandler)
+	api("GET", "/monitors/:id/", apiGetMonitorHandler)
+	api("PUT", "/monitors/:id/", apiUpdateMonitorHandler)
+	api("DELETE", "/monitors/:id/", apiDeleteMonitorHandler)
+	api("POST", "/monitors/:id/pause/", apiPauseMonitorHandler(true))
+	api("POST", "/monitors/:id/resume/", apiPauseMonitorHandler(false))
+	api("GET", "/monitors/:id/logs/", apiLogsHandler)
+	api("GET", "/monitors/:id/status/", apiMonitorStatusHandler)
+
+	// Every other page requires to log in. The export of the logs
+	// can be used with an API token, too.
+	public := []string{"/static/", "/login/", "/setup/", APIPrefix + "/", "/monitors/logs/"}
+	if *publicStatus {
+		get("/status/", Anyone, publicStatusHandler)
+		public = append(public, "/status/")
+	}
+
+	sessions := NewSessionAuthenticator(public...)
 
 	// Since exportLogsHandler has to do bulk writes,
 	// we need to expose the writer directly.
-	mux.GET("/monitors/logs/:id/export", exportLogsHandler)
+	mux.GET("/monitors/logs/:id/export", sessions.OrToken(tokens, exportLogsHandler))
+
+	// The scheduler needs to be stopped first so that the batcher
+	// can write the results of the last checks (and their
+	// notifications are sent).
+	checks := NewCheckBatcher()
+	checks.Start()
+	defer checks.Stop()
+
+	notifications := NewNotificationDispatcher(*baseURL)
+	notifications.Start()
+	defer notifications.Stop()
+
+	escalations := NewEscalator(notifications.Add)
+	escalations.Start()
+	defer escalations.Stop()
+
+	scheduler = NewScheduler()
+	scheduler.Store = checks.Add
+	scheduler.Notify = notifications.Add
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	server := &http.Server{Addr: ":8092", Handler: sessions.Protect(mux)}
+	shutdown := make(chan struct{})
+	go shutdownOnSignal(server, shutdown)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Printf("Couldn't open http server: %v.\n", err)
+		return
+	}
+
+	// ListenAndServe returns as soon as the shutdown starts; the
+	// running requests still need the database and the scheduler.
+	<-shutdown
+}
+
+// shutdownOnSignal gracefully shuts the server down once the
+// process receives SIGINT or SIGTERM. done is closed after all
+// running requests have finished.
+func shutdownOnSignal(server *http.Server, done chan<- struct{}) {
+	defer close(done)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	log.Println("Shutting down...")
+	if err := server.Shutdown(context.Background()); err != nil {
+		log.Printf("Error while shutting down the http server: %v", err)
+	}
+}
 
-	server := &http.Server{Addr: ":8092", Handler: mux}
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Couldn't open http server: %v.\n", err)
+// refreshScheduler makes the scheduler pick up changes to the
+// monitors immediately (if it is running).
+func refreshScheduler() {
+	if scheduler != nil {
+		scheduler.Refresh()
 	}
 }
@@ -1,6 +1,13 @@
 package main
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // EventType contains information about the server's
 // state (like monitioring has been stated, or that
@@ -48,6 +55,24 @@ func (e EventType) CSSColor() string {
 	}
 }
 
+// HexColor returns CSSColor as a hex color (such as "#FF0000") for
+// clients that do not understand color names (such as Slack).
+func (e EventType) HexColor() string {
+	color := e.CSSColor()
+	if hex, ok := cssColorHex[color]; ok {
+		return hex
+	}
+
+	return color
+}
+
+// cssColorHex contains the colors returned by CSSColor that
+// are not hex colors.
+var cssColorHex = map[string]string{
+	"red":   "#FF0000",
+	"green": "#008000",
+}
+
 var eventToString = [][]string{
 	{
 		"Monitor Created Event",
@@ -101,10 +126,115 @@ const (
 // being monitored such as the type, name and a reference
 // to all logs.
 type Monitor struct {
-	Id   int
-	Name string
-	Type string
-	Logs []MonitorLog
+	Id       int
+	Name     string
+	Type     string
+	Settings MonitorSettings
+	Logs     []MonitorLog
+}
+
+// Paused is true if the latest of m.Logs is a paused event. The
+// logs need to be ordered by date (newest first).
+func (m Monitor) Paused() bool {
+	return len(m.Logs) > 0 && m.Logs[0].Event == MonitorPausedEvent
+}
+
+// MonitorSettingsVersion is the version of MonitorSettings
+// written by this version of Upchecker.
+const MonitorSettingsVersion = 1
+
+// MonitorSettings contains the configuration of a monitor. It is
+// stored as JSON in the `settings` column of the `monitors` table.
+// Options contains the type-specific settings (see CheckerType).
+type MonitorSettings struct {
+	Version int    `json:"version"`
+	Target  string `json:"target"`
+
+	// Interval and Timeout are in seconds. Zero means that
+	// the default will be used.
+	Interval int `json:"interval,omitempty"`
+	Timeout  int `json:"timeout,omitempty"`
+
+	// Retries is the number of times a failed check is repeated
+	// before the monitor is considered to be down.
+	Retries int `json:"retries,omitempty"`
+
+	Options map[string]string `json:"options,omitempty"`
+
+	// ChannelIds are the ids of the notification channels that
+	// are notified about the monitor.
+	ChannelIds []int `json:"channel_ids,omitempty"`
+
+	// Escalation notifies further channels if the monitor stays
+	// down. It is nil if there is no escalation.
+	Escalation *EscalationPolicy `json:"escalation,omitempty"`
+}
+
+// IntervalDuration returns the time between two checks.
+func (s MonitorSettings) IntervalDuration() time.Duration {
+	if s.Interval <= 0 {
+		return DefaultCheckInterval
+	}
+
+	return time.Duration(s.Interval) * time.Second
+}
+
+// CheckerConfig returns the config for creating the checker.
+func (s MonitorSettings) CheckerConfig() CheckerConfig {
+	config := CheckerConfig{}
+	for key, value := range s.Options {
+		config[key] = value
+	}
+
+	config[ConfigTarget] = s.Target
+	if s.Timeout > 0 {
+		config[ConfigTimeout] = strconv.Itoa(s.Timeout)
+	}
+
+	return config
+}
+
+// Value encodes the settings as JSON.
+func (s MonitorSettings) Value() (driver.Value, error) {
+	s.Version = MonitorSettingsVersion
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan decodes the settings from JSON. Settings that have been
+// stored by an older version are upgraded.
+func (s *MonitorSettings) Scan(src interface{}) error {
+	*s = MonitorSettings{}
+
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		// Monitors created before settings existed.
+		s.Version = MonitorSettingsVersion
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("Cannot scan %T into MonitorSettings", src)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+
+	if s.Version > MonitorSettingsVersion {
+		return errors.New("Monitor settings have been written by a newer version")
+	}
+
+	// There have not been any incompatible changes, yet.
+	s.Version = MonitorSettingsVersion
+	return nil
 }
 
 // MonitorLog is a log entery for any EventType
@@ -115,20 +245,32 @@ type MonitorLog struct {
 	Date      time.Time
 	MonitorId int
 	Monitor   *Monitor
+
+	// Reason describes why the event occurred (such as
+	// the error that caused the server to be down).
+	Reason string
 }
 
-// SUpportedTypes is a slice with all monitoring
-// types such as pinging or checking for a word
-// in an http page.
-var SupportedTypes = []string{
-	"Socket", "http", "ping",
+// MonitorCheck is the result of a single check of a monitor. Unlike
+// MonitorLog, every check is stored (not only state changes).
+type MonitorCheck struct {
+	Id        int
+	MonitorId int
+
+	// Date is the time the check started.
+	Date     time.Time
+	Duration time.Duration
+	Up       bool
+
+	// Reason is the error (or summary) reported by the checker.
+	Reason string
 }
 
 func makeMonitors() []Monitor {
 	return []Monitor{
-		{0, "TCP/UDP Socket", "sock", []MonitorLog{}},
-		{1, "HTTP(s) Server", "http", []MonitorLog{}},
-		{2, "Main Server", "ping", []MonitorLog{}},
-		{3, "Down server", "ping", []MonitorLog{}},
+		{0, "TCP/UDP Socket", "socket", MonitorSettings{}, []MonitorLog{}},
+		{1, "HTTP(s) Server", "http", MonitorSettings{}, []MonitorLog{}},
+		{2, "Main Server", "ping", MonitorSettings{}, []MonitorLog{}},
+		{3, "Down server", "ping", MonitorSettings{}, []MonitorLog{}},
 	}
 }
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MinCheckInterval is the shortest interval that can be
+	// configured for a monitor.
+	MinCheckInterval = 10 * time.Second
+
+	// MaxCheckRetries is the maximum number of retries that
+	// can be configured for a monitor.
+	MaxCheckRetries = 5
+)
+
+// MonitorForm is passed to the template showing the form for
+// adding or editing a monitor. It contains the values entered
+// so far.
+type MonitorForm struct {
+	Types   []CheckerType
+	Monitor Monitor
+	Paused  bool
+	Err     string
+
+	// Channels are all notification channels that can be
+	// linked to the monitor (see loadChannelChoices).
+	Channels []NotificationChannel
+}
+
+// NewMonitorForm creates a form that shows m.
+func NewMonitorForm(m Monitor, paused bool, errMsg string) MonitorForm {
+	types := make([]CheckerType, 0, len(SupportedTypes))
+	for _, name := range SupportedTypes {
+		t, _ := LookupCheckerType(name)
+		types = append(types, t)
+	}
+
+	return MonitorForm{Types: types, Monitor: m, Paused: paused, Err: errMsg}
+}
+
+// loadChannelChoices loads all notification channels so that
+// they can be selected.
+func (f *MonitorForm) loadChannelChoices() error {
+	f.Channels = []NotificationChannel{}
+	return db.Model(&f.Channels).Order("name ASC").Select()
+}
+
+// HasEscalationChannel is true if the outages of the monitor are
+// escalated to the channel.
+func (f MonitorForm) HasEscalationChannel(id int) bool {
+	if p := f.Monitor.Settings.Escalation; p != nil {
+		for _, c := range p.ChannelIds {
+			if c == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// HasChannel is true if the channel is linked to the monitor.
+func (f MonitorForm) HasChannel(id int) bool {
+	for _, c := range f.Monitor.Settings.ChannelIds {
+		if c == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Editing is true if an existing monitor is edited.
+func (f MonitorForm) Editing() bool {
+	return f.Monitor.Id != 0
+}
+
+// Option returns the value of a type-specific field. If the monitor
+// is of a different type, the default of the field is returned.
+func (f MonitorForm) Option(typ string, field CheckerField) string {
+	if f.Monitor.Type == typ {
+		if value, ok := f.Monitor.Settings.Options[field.Name]; ok {
+			return value
+		}
+	}
+
+	if field.Kind == FieldSelect && len(field.Choices) > 0 {
+		return field.Choices[0]
+	}
+
+	return field.Default
+}
+
+// optionalSeconds parses the form value key. An empty value is 0.
+func optionalSeconds(values url.Values, key string) (int, error) {
+	value := strings.TrimSpace(values.Get(key))
+	if value == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, errors.New("Please enter a positive number of seconds.")
+	}
+
+	return i, nil
+}
+
+// parseMonitorForm reads the monitor from the submitted form and
+// validates its settings. The monitor is returned even if it is
+// invalid so that the form can show the values again. The error
+// message is meant to be shown to the user.
+func parseMonitorForm(r *http.Request) (m Monitor, paused bool, err error) {
+	if err := r.ParseForm(); err != nil {
+		return m, false, errors.New("Form data invaild. Please check input.")
+	}
+
+	return parseMonitorValues(r.PostForm)
+}
+
+// parseMonitorValues reads and validates the monitor from values
+// named like the fields of the form. It is shared by the form and
+// the JSON API (see apiMonitorInput) so that both accept exactly
+// the same monitors.
+func parseMonitorValues(values url.Values) (m Monitor, paused bool, err error) {
+	m.Name = strings.TrimSpace(values.Get("name"))
+	m.Type = values.Get("type")
+	paused = values.Get("paused") == "on"
+	m.Settings = MonitorSettings{
+		Version: MonitorSettingsVersion,
+		Target:  strings.TrimSpace(values.Get("target")),
+		Options: map[string]string{},
+	}
+
+	t, typeOK := LookupCheckerType(m.Type)
+	if typeOK {
+		m.Settings.Options = parseFieldValues(values, m.Type, t.Fields)
+	}
+
+	if m.Name == "" {
+		return m, paused, errors.New("A name for the monitor is required.")
+	}
+
+	if !typeOK {
+		return m, paused, errors.New("Please select a valid type.")
+	}
+
+	if m.Settings.Interval, err = optionalSeconds(values, "interval"); err != nil {
+		return m, paused, err
+	}
+
+	if m.Settings.Interval != 0 && m.Settings.IntervalDuration() < MinCheckInterval {
+		return m, paused, errors.New("The interval needs to be at least " +
+			MinCheckInterval.String() + ".")
+	}
+
+	if m.Settings.Timeout, err = optionalSeconds(values, "timeout"); err != nil {
+		return m, paused, err
+	}
+
+	if m.Settings.Retries, err = optionalSeconds(values, "retries"); err != nil {
+		return m, paused, errors.New("Please enter a valid number of retries.")
+	} else if m.Settings.Retries > MaxCheckRetries {
+		return m, paused, errors.New("A monitor can be retried at most " +
+			strconv.Itoa(MaxCheckRetries) + " times.")
+	}
+
+	if m.Settings.ChannelIds, err = parseChannelIds(values["channels"]); err != nil {
+		return m, paused, err
+	}
+
+	if m.Settings.Escalation, err = parseEscalation(values); err != nil {
+		return m, paused, err
+	}
+
+	if _, err := t.New(m.Settings.CheckerConfig()); err != nil {
+		return m, paused, err
+	}
+
+	return m, paused, nil
+}
+
+// parseEscalation returns the escalation policy of the form. It is
+// nil if no channels have been selected to escalate to.
+func parseEscalation(values url.Values) (*EscalationPolicy, error) {
+	ids, err := parseChannelIds(values["escalation_channels"])
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	p := &EscalationPolicy{ChannelIds: ids}
+	p.After, err = strconv.Atoi(strings.TrimSpace(values.Get("escalation_after")))
+	if err != nil || p.After < 1 {
+		return p, errors.New("Please enter after how many minutes the outage is escalated.")
+	}
+
+	if repeat := strings.TrimSpace(values.Get("escalation_repeat")); repeat != "" {
+		p.Repeat, err = strconv.Atoi(repeat)
+		if err != nil || p.Repeat < 0 {
+			return p, errors.New("Please enter a valid number of minutes between escalations.")
+		}
+	}
+
+	return p, nil
+}
+
+// parseFieldValues returns the values of the type-specific fields
+// (named "<type>.<field>"). Empty fields are left out and unchecked
+// checkboxes are "off".
+func parseFieldValues(values url.Values, typ string, fields []CheckerField) map[string]string {
+	options := map[string]string{}
+	for _, field := range fields {
+		value := values.Get(typ + "." + field.Name)
+		if field.Kind == FieldCheckbox {
+			if value != "on" {
+				value = "off"
+			}
+		} else if value == "" {
+			continue
+		}
+
+		options[field.Name] = value
+	}
+
+	return options
+}
+
+// parseChannelIds returns the ids of the selected notification
+// channels (without duplicates).
+func parseChannelIds(values []string) ([]int, error) {
+	var ids []int
+	seen := map[int]bool{}
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("Please select valid notification channels.")
+		} else if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func postForm(t *testing.T, form url.Values) *http.Request {
+	r := MustRequest(t, "POST", "", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", ContentTypeURLEncoded)
+	return r
+}
+
+func TestParseMonitorForm(t *testing.T) {
+	form := url.Values{}
+	form.Set("name", " Website ")
+	form.Set("type", "http-keyword")
+	form.Set("target", "https://example.com/")
+	form.Set("interval", "300")
+	form.Set("timeout", "5")
+	form.Set("retries", "2")
+	form.Set("paused", "on")
+	form.Set("http-keyword.keyword", " Welcome ")
+	form.Set("http-keyword.keyword_absent", "on")
+	form.Set("http-keyword.method", "")
+	form.Set("http.method", "POST")
+
+	m, paused, err := parseMonitorForm(postForm(t, form))
+	if err != nil {
+		t.Fatalf("parseMonitorForm returned an error: %v", err)
+	}
+
+	if m.Name != "Website" || m.Type != "http-keyword" || !paused {
+		t.Errorf("Unexpected monitor: %#v (paused: %v)", m, paused)
+	}
+
+	s := m.Settings
+	if s.Target != "https://example.com/" || s.Interval != 300 ||
+		s.Timeout != 5 || s.Retries != 2 {
+		t.Errorf("Unexpected settings: %#v", s)
+	}
+
+	expected := map[string]string{
+		"keyword":          " Welcome ",
+		"keyword_absent":   "on",
+		"keyword_regexp":   "off",
+		"follow_redirects": "off",
+	}
+
+	if len(s.Options) != len(expected) {
+		t.Errorf("Options: %v, wanted: %v", s.Options, expected)
+	}
+
+	for key, value := range expected {
+		if s.Options[key] != value {
+			t.Errorf("Option %q: %q, wanted: %q", key, s.Options[key], value)
+		}
+	}
+}
+
+func TestParseMonitorFormInvalid(t *testing.T) {
+	testcase := []struct {
+		form url.Values
+		err  string
+	}{
+		{url.Values{"type": {"ping"}, "target": {"localhost"}},
+			"A name for the monitor is required."},
+		{url.Values{"name": {"foo"}, "type": {"unknown"}},
+			"Please select a valid type."},
+		{url.Values{"name": {"foo"}, "type": {"ping"}},
+			`The setting "target" is required`},
+		{url.Values{"name": {"foo"}, "type": {"ping"}, "target": {"localhost"},
+			"interval": {"5"}}, "The interval needs to be at least 10s."},
+		{url.Values{"name": {"foo"}, "type": {"ping"}, "target": {"localhost"},
+			"timeout": {"-1"}}, "Please enter a positive number of seconds."},
+		{url.Values{"name": {"foo"}, "type": {"ping"}, "target": {"localhost"},
+			"retries": {"6"}}, "A monitor can be retried at most 5 times."},
+		{url.Values{"name": {"foo"}, "type": {"ping"}, "target": {"localhost"},
+			"ping.count": {"0"}}, "The number of packets needs to be between 1 and 100"},
+		{url.Values{"name": {"foo"}, "type": {"http-json"}, "target": {"http://localhost"}},
+			`The setting "json_assertions" is required`},
+	}
+
+	for _, row := range testcase {
+		m, _, err := parseMonitorForm(postForm(t, row.form))
+		if err == nil || err.Error() != row.err {
+			t.Errorf("parseMonitorForm(%v) => %v, wanted: %q", row.form, err, row.err)
+		}
+
+		if m.Name != strings.TrimSpace(row.form.Get("name")) {
+			t.Errorf("parseMonitorForm(%v) did not keep the name", row.form)
+		}
+	}
+}
+
+func TestParseMonitorFormChannels(t *testing.T) {
+	form := url.Values{"name": {"foo"}, "type": {"ping"}, "target": {"localhost"}}
+	m, _, err := parseMonitorForm(postForm(t, form))
+	if err != nil || m.Settings.ChannelIds != nil {
+		t.Errorf("Without channels: %v, %v", m.Settings.ChannelIds, err)
+	}
+
+	form["channels"] = []string{"2", "1", "2"}
+	m, _, err = parseMonitorForm(postForm(t, form))
+	if err != nil || !reflect.DeepEqual(m.Settings.ChannelIds, []int{2, 1}) {
+		t.Errorf("Unexpected channels: %v, %v", m.Settings.ChannelIds, err)
+	}
+
+	f := NewMonitorForm(m, false, "")
+	if !f.HasChannel(1) || f.HasChannel(3) {
+		t.Errorf("The selected channels are not shown as selected")
+	}
+
+	form["channels"] = []string{"1", "Ops"}
+	_, _, err = parseMonitorForm(postForm(t, form))
+	if err == nil || err.Error() != "Please select valid notification channels." {
+		t.Errorf("Unexpected error for an invalid channel: %v", err)
+	}
+}
+
+func TestParseMonitorFormEscalation(t *testing.T) {
+	form := url.Values{"name": {"foo"}, "type": {"ping"}, "target": {"localhost"},
+		"escalation_after": {"15"}}
+	m, _, err := parseMonitorForm(postForm(t, form))
+	if err != nil || m.Settings.Escalation != nil {
+		t.Errorf("Without channels: %#v, %v", m.Settings.Escalation, err)
+	}
+
+	form["escalation_channels"] = []string{"3"}
+	form.Set("escalation_repeat", "30")
+	m, _, err = parseMonitorForm(postForm(t, form))
+	expected := &EscalationPolicy{ChannelIds: []int{3}, After: 15, Repeat: 30}
+	if err != nil || !reflect.DeepEqual(m.Settings.Escalation, expected) {
+		t.Errorf("Unexpected escalation: %#v, %v", m.Settings.Escalation, err)
+	}
+
+	if f := NewMonitorForm(m, false, ""); !f.HasEscalationChannel(3) || f.HasEscalationChannel(1) {
+		t.Errorf("The escalation channels are not shown as selected")
+	}
+
+	testcase := []struct {
+		after, repeat string
+		err           string
+	}{
+		{"", "", "Please enter after how many minutes the outage is escalated."},
+		{"0", "", "Please enter after how many minutes the outage is escalated."},
+		{"5", "-1", "Please enter a valid number of minutes between escalations."},
+		{"5", "often", "Please enter a valid number of minutes between escalations."},
+	}
+
+	for _, row := range testcase {
+		form.Set("escalation_after", row.after)
+		form.Set("escalation_repeat", row.repeat)
+		_, _, err := parseMonitorForm(postForm(t, form))
+		if err == nil || err.Error() != row.err {
+			t.Errorf("After %q, repeat %q: wanted error %q, got: %v",
+				row.after, row.repeat, row.err, err)
+		}
+	}
+}
+
+func TestMonitorFormOption(t *testing.T) {
+	redirects := CheckerField{Name: "follow_redirects", Kind: FieldCheckbox, Default: "on"}
+	protocol := CheckerField{Name: "protocol", Kind: FieldSelect, Choices: []string{"tcp", "udp"}}
+	m := Monitor{Type: "http", Settings: MonitorSettings{
+		Options: map[string]string{"follow_redirects": "off"},
+	}}
+
+	form := NewMonitorForm(m, false, "")
+	testcase := []struct {
+		typ      string
+		field    CheckerField
+		expected string
+	}{
+		{"http", redirects, "off"},
+		{"http-json", redirects, "on"},
+		{"socket", protocol, "tcp"},
+	}
+
+	for _, row := range testcase {
+		if v := form.Option(row.typ, row.field); v != row.expected {
+			msg := "Option(%q, %q) => %q, wanted: %q"
+			t.Errorf(msg, row.typ, row.field.Name, v, row.expected)
+		}
+	}
+
+	if len(form.Types) != len(SupportedTypes) {
+		t.Errorf("The form shows %d types, wanted: %d", len(form.Types), len(SupportedTypes))
+	}
+}
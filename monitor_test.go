@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestEventTypeString(t *testing.T) {
 	testcase := []struct {
@@ -64,3 +67,83 @@ func TestEventTypeShortName(t *testing.T) {
 		}
 	}
 }
+
+func TestEventTypeHexColor(t *testing.T) {
+	testcase := []struct {
+		Event    EventType
+		Expected string
+	}{
+		{MonitorDownEvent, "#FF0000"},
+		{MonitorUpEvent, "#008000"},
+		{MonitorPausedEvent, "#FFC107"},
+	}
+
+	msg := "EventType(id=%d).HexColor() => %v, wanted %v"
+	for _, row := range testcase {
+		if row.Event.HexColor() != row.Expected {
+			t.Errorf(msg, row.Event, row.Event.HexColor(), row.Expected)
+		}
+	}
+}
+
+func TestMonitorSettingsValue(t *testing.T) {
+	s := MonitorSettings{Target: "example.com", Interval: 30,
+		Options: map[string]string{"count": "5"}}
+	value, err := s.Value()
+	if err != nil {
+		t.Fatalf("Value() returned an error: %v", err)
+	}
+
+	expected := `{"version":1,"target":"example.com","interval":30,"options":{"count":"5"}}`
+	if value != expected {
+		t.Errorf("Value() => %v, wanted: %v", value, expected)
+	}
+}
+
+func TestMonitorSettingsScan(t *testing.T) {
+	testcase := []struct {
+		src      interface{}
+		target   string
+		interval time.Duration
+	}{
+		{nil, "", DefaultCheckInterval},
+		{[]byte(`{"target": "localhost:22"}`), "localhost:22", DefaultCheckInterval},
+		{`{"version": 1, "target": "localhost", "interval": 300}`,
+			"localhost", 5 * time.Minute},
+	}
+
+	for _, row := range testcase {
+		s := MonitorSettings{}
+		if err := s.Scan(row.src); err != nil {
+			t.Errorf("Scan(%v) returned an error: %v", row.src, err)
+			continue
+		}
+
+		if s.Version != MonitorSettingsVersion || s.Target != row.target ||
+			s.IntervalDuration() != row.interval {
+			t.Errorf("Scan(%v) => %#v", row.src, s)
+		}
+	}
+
+	for _, src := range []interface{}{42, "{", `{"version": 2}`} {
+		if err := (&MonitorSettings{}).Scan(src); err == nil {
+			t.Errorf("Scan(%v) did not return an error", src)
+		}
+	}
+}
+
+func TestMonitorSettingsCheckerConfig(t *testing.T) {
+	s := MonitorSettings{Target: "localhost", Options: map[string]string{
+		"target": "ignored", "count": "2",
+	}}
+
+	config := s.CheckerConfig()
+	if len(config) != 2 || config["target"] != "localhost" || config["count"] != "2" {
+		t.Errorf("CheckerConfig() => %v", config)
+	}
+
+	s.Timeout = 3
+	if timeout, _ := s.CheckerConfig().Timeout(); timeout != 3*time.Second {
+		t.Errorf("Timeout of the config: %v, wanted: 3s", timeout)
+	}
+}
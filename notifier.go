@@ -0,0 +1,453 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/pg.v4"
+)
+
+// Notification describes a monitor that went down or came back
+// up (or that is still down, see EscalationPolicy). It is sent to
+// every notification channel.
+type Notification struct {
+	Monitor Monitor
+
+	// Event is either MonitorDownEvent or MonitorUpEvent.
+	Event EventType
+	Date  time.Time
+
+	// Reason is the error that made the monitor go down. For up
+	// events, it is the error of the outage that has just ended.
+	Reason string
+
+	// DownSince is the time the monitor went down (or the zero
+	// time if that is unknown).
+	DownSince time.Time
+
+	// URL is the page of the monitor. It is empty if the address
+	// of Upchecker is unknown.
+	URL string
+
+	// Escalation is the number of the escalation if the monitor
+	// is still down. It is zero if the monitor has just gone
+	// down or come back up.
+	Escalation int
+}
+
+// IsDown is true if the monitor went down.
+func (n Notification) IsDown() bool {
+	return n.Event == MonitorDownEvent
+}
+
+// IsEscalation is true if the monitor is still down.
+func (n Notification) IsEscalation() bool {
+	return n.IsDown() && n.Escalation > 0
+}
+
+// State returns "down", "still down" or "up".
+func (n Notification) State() string {
+	if n.IsEscalation() {
+		return "still down"
+	} else if n.IsDown() {
+		return "down"
+	}
+
+	return "up"
+}
+
+// Downtime returns how long the monitor has been down (rounded
+// to seconds). It is zero if that is unknown.
+func (n Notification) Downtime() time.Duration {
+	if n.DownSince.IsZero() || n.Date.Before(n.DownSince) {
+		return 0
+	}
+
+	return n.Date.Sub(n.DownSince).Round(time.Second)
+}
+
+// isNotified is true if a monitor whose latest event was last and
+// that has just logged event needs to be notified about. Coming up
+// is only reported if the monitor has been down before (and not
+// after it has been created or resumed).
+func isNotified(last, event EventType) bool {
+	return event == MonitorDownEvent ||
+		(event == MonitorUpEvent && last == MonitorDownEvent)
+}
+
+// A Notifier sends notifications through a channel (such as email).
+type Notifier interface {
+	Notify(Notification) error
+}
+
+// testNotificationTimeout is the time after which sending a test
+// notification fails.
+const testNotificationTimeout = 5 * time.Second
+
+// A TestNotifier can send a test notification quicker than regular
+// ones: it is sent only once and fails after testNotificationTimeout.
+type TestNotifier interface {
+	TestNotify(Notification) error
+}
+
+// sendTestNotification sends n with TestNotify if the notifier
+// implements TestNotifier (and with Notify otherwise).
+func sendTestNotification(notifier Notifier, n Notification) error {
+	if t, ok := notifier.(TestNotifier); ok {
+		return t.TestNotify(n)
+	}
+
+	return notifier.Notify(n)
+}
+
+// NotifierFactory creates a new Notifier from the settings of a
+// channel. They are parsed the same way as the settings of a monitor.
+// An error is returned if they are invalid.
+type NotifierFactory func(config CheckerConfig) (Notifier, error)
+
+// NotifierType describes a type of notification channels (such
+// as "email").
+type NotifierType struct {
+	// Name is the name of the type as it is stored in
+	// NotificationChannel.Type.
+	Name        string
+	Description string
+
+	// Fields are all settings of the type.
+	Fields []CheckerField
+
+	// New creates a notifier for a channel of this type.
+	New NotifierFactory
+}
+
+var notifierTypes = map[string]NotifierType{}
+
+// SupportedNotifierTypes is a sorted slice with the names of
+// all notification channel types.
+var SupportedNotifierTypes = []string{}
+
+// RegisterNotifierType makes a notification channel type available.
+// It is meant to be called from init and panics if a type with the
+// same name has already been registered.
+func RegisterNotifierType(t NotifierType) {
+	if _, dup := notifierTypes[t.Name]; dup {
+		panic("RegisterNotifierType called twice for type " + t.Name)
+	}
+
+	notifierTypes[t.Name] = t
+	SupportedNotifierTypes = append(SupportedNotifierTypes, t.Name)
+	sort.Strings(SupportedNotifierTypes)
+}
+
+// LookupNotifierType returns the type with the given name.
+func LookupNotifierType(name string) (NotifierType, bool) {
+	t, ok := notifierTypes[name]
+	return t, ok
+}
+
+// NotificationChannel is a destination for notifications (such as
+// the email addresses of a team). Monitors are linked to channels
+// by MonitorSettings.ChannelIds.
+type NotificationChannel struct {
+	Id       int
+	Name     string
+	Type     string
+	Settings ChannelSettings
+	Created  time.Time
+}
+
+// NewNotifier creates the notifier for c.
+func NewNotifier(c NotificationChannel) (Notifier, error) {
+	t, ok := LookupNotifierType(c.Type)
+	if !ok {
+		return nil, fmt.Errorf("Unknown notification channel type: %q", c.Type)
+	}
+
+	return t.New(CheckerConfig(c.Settings))
+}
+
+// ChannelSettings contains the type-specific settings of a channel.
+// It is stored as JSON in the `settings` column.
+type ChannelSettings map[string]string
+
+// Value encodes the settings as JSON.
+func (s ChannelSettings) Value() (driver.Value, error) {
+	if s == nil {
+		s = ChannelSettings{}
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan decodes the settings from JSON.
+func (s *ChannelSettings) Scan(src interface{}) error {
+	*s = ChannelSettings{}
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, s)
+	case string:
+		return json.Unmarshal([]byte(src), s)
+	default:
+		return fmt.Errorf("Cannot scan %T into ChannelSettings", src)
+	}
+}
+
+// loadChannels loads the channels with the ids (ordered by name).
+// Ids of channels that have been deleted are ignored.
+func loadChannels(q queryer, ids []int) ([]NotificationChannel, error) {
+	channels := []NotificationChannel{}
+	if len(ids) == 0 {
+		return channels, nil
+	}
+
+	err := q.Model(&channels).Where("id IN (?)", pg.In(ids)).Order("name ASC").Select()
+	return channels, err
+}
+
+// loadNotificationChannels loads the channels that are notified:
+// the channels linked to the monitor or, for escalations, the
+// channels of its escalation policy.
+func loadNotificationChannels(n Notification) ([]NotificationChannel, error) {
+	ids := n.Monitor.Settings.ChannelIds
+	if n.IsEscalation() {
+		ids = nil
+		if p := n.Monitor.Settings.Escalation; p != nil {
+			ids = p.ChannelIds
+		}
+	}
+
+	return loadChannels(db, ids)
+}
+
+// NotificationDelivery records whether a notification has been
+// sent to a channel (shown on the page of the monitor).
+type NotificationDelivery struct {
+	Id        int
+	MonitorId int
+	Channel   string
+	Type      string
+	Event     EventType
+	Date      time.Time
+
+	// Error is empty (NULL) if the notification has been
+	// delivered.
+	Error string `sql:",null"`
+}
+
+// Delivered is true if the notification has been sent.
+func (d NotificationDelivery) Delivered() bool {
+	return d.Error == ""
+}
+
+// storeNotificationDelivery inserts the delivery.
+func storeNotificationDelivery(d NotificationDelivery) error {
+	return db.Create(&d)
+}
+
+// loadLastDown returns the latest down event of the monitor that
+// has been logged before the date. If there is none, pg.ErrNoRows
+// is returned.
+func loadLastDown(monitorID int, before time.Time) (MonitorLog, error) {
+	entry := MonitorLog{}
+	err := db.Model(&entry).
+		Where("monitor_id = ? AND event = ? AND date <= ?", monitorID, MonitorDownEvent, before).
+		Order("date DESC, id DESC").Limit(1).Select()
+
+	return entry, err
+}
+
+// notificationQueueSize is the number of notifications that may be
+// waiting to be sent. Further notifications are dropped.
+const notificationQueueSize = 100
+
+// NotificationDispatcher sends notifications in the background so
+// that slow channels (such as SMTP servers) do not delay checks.
+// Every channel has its own queue, so a slow or failing channel
+// does not delay the others either.
+type NotificationDispatcher struct {
+	// Channels returns the channels that are notified.
+	Channels func(Notification) ([]NotificationChannel, error)
+
+	// New creates the notifier of a channel.
+	New func(NotificationChannel) (Notifier, error)
+
+	// LastDown returns the latest down event of the monitor that
+	// has been logged before the date (used to tell how long the
+	// monitor has been down). pg.ErrNoRows means that there is none.
+	LastDown func(monitorID int, before time.Time) (MonitorLog, error)
+
+	// Record stores whether a notification has been delivered to
+	// a channel. It may be nil.
+	Record func(NotificationDelivery) error
+
+	// BaseURL is the address of the web interface (such as
+	// https://upchecker.example.com). It is used to link to the
+	// monitor and may be empty.
+	BaseURL string
+
+	queue chan Notification
+	done  chan struct{}
+
+	// workers contains the queue of every channel that has been
+	// notified (by the id of the channel).
+	workers map[int]chan queuedNotification
+	wg      sync.WaitGroup
+}
+
+// queuedNotification is a notification waiting to be sent to the
+// channel (whose settings may have changed since the last one).
+type queuedNotification struct {
+	n       Notification
+	channel NotificationChannel
+}
+
+// NewNotificationDispatcher creates a dispatcher that sends the
+// notifications to the channels linked to the monitors.
+func NewNotificationDispatcher(baseURL string) *NotificationDispatcher {
+	return &NotificationDispatcher{
+		Channels: loadNotificationChannels,
+		New:      NewNotifier,
+		LastDown: loadLastDown,
+		Record:   storeNotificationDelivery,
+		BaseURL:  baseURL,
+	}
+}
+
+// Start starts sending notifications in the background.
+func (d *NotificationDispatcher) Start() {
+	d.queue = make(chan Notification, notificationQueueSize)
+	d.done = make(chan struct{})
+	go d.run()
+}
+
+// Stop sends the remaining notifications and waits until that
+// is done. Add must not be called afterwards.
+func (d *NotificationDispatcher) Stop() {
+	close(d.queue)
+	<-d.done
+}
+
+// Add queues a notification. It does not block; if too many
+// notifications are waiting to be sent, it is dropped.
+func (d *NotificationDispatcher) Add(n Notification) {
+	select {
+	case d.queue <- n:
+	default:
+		log.Printf("Notifications: queue is full, dropping notification for monitor %d",
+			n.Monitor.Id)
+	}
+}
+
+func (d *NotificationDispatcher) run() {
+	defer close(d.done)
+	d.workers = map[int]chan queuedNotification{}
+	for n := range d.queue {
+		d.send(n)
+	}
+
+	for _, worker := range d.workers {
+		close(worker)
+	}
+	d.wg.Wait()
+}
+
+// send completes the notification and queues it for every channel
+// of its monitor.
+func (d *NotificationDispatcher) send(n Notification) {
+	if d.BaseURL != "" {
+		n.URL = strings.TrimSuffix(d.BaseURL, "/") +
+			"/monitors/view/" + strconv.Itoa(n.Monitor.Id) + "/"
+	}
+
+	if n.IsDown() {
+		if n.DownSince.IsZero() {
+			n.DownSince = n.Date
+		}
+	} else if down, err := d.LastDown(n.Monitor.Id, n.Date); err == nil {
+		n.DownSince = down.Date
+		n.Reason = down.Reason
+	} else if err != pg.ErrNoRows {
+		log.Printf("Notifications: could not load outage of monitor %d: %v",
+			n.Monitor.Id, err)
+	}
+
+	channels, err := d.Channels(n)
+	if err != nil {
+		log.Printf("Notifications: could not load channels of monitor %d: %v",
+			n.Monitor.Id, err)
+		return
+	}
+
+	for _, channel := range channels {
+		worker, ok := d.workers[channel.Id]
+		if !ok {
+			worker = make(chan queuedNotification, notificationQueueSize)
+			d.workers[channel.Id] = worker
+			d.wg.Add(1)
+			go d.work(worker)
+		}
+
+		select {
+		case worker <- queuedNotification{n, channel}:
+		default:
+			log.Printf("Notifications: queue of %q is full, dropping notification for monitor %d",
+				channel.Name, n.Monitor.Id)
+		}
+	}
+}
+
+// work sends the notifications queued for a channel. Errors are
+// logged and recorded.
+func (d *NotificationDispatcher) work(queue <-chan queuedNotification) {
+	defer d.wg.Done()
+	for q := range queue {
+		n, channel := q.n, q.channel
+		notifier, err := d.New(channel)
+		if err == nil {
+			err = notifier.Notify(n)
+		}
+
+		if err != nil {
+			log.Printf("Notifications: could not notify %q about monitor %d: %v",
+				channel.Name, n.Monitor.Id, err)
+		}
+
+		d.record(n, channel, err)
+	}
+}
+
+// record stores the outcome of sending n to the channel.
+func (d *NotificationDispatcher) record(n Notification, channel NotificationChannel, sendErr error) {
+	if d.Record == nil {
+		return
+	}
+
+	delivery := NotificationDelivery{
+		MonitorId: n.Monitor.Id,
+		Channel:   channel.Name,
+		Type:      channel.Type,
+		Event:     n.Event,
+		Date:      time.Now(),
+	}
+	if sendErr != nil {
+		delivery.Error = sendErr.Error()
+	}
+
+	if err := d.Record(delivery); err != nil {
+		log.Printf("Notifications: could not record delivery to %q: %v", channel.Name, err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of the settings of chat channels.
+const (
+	ChatConfigURL      = "url"
+	ChatConfigUsername = "username"
+)
+
+// Formats of chat messages.
+const (
+	// SlackFormat is understood by Slack and Mattermost.
+	SlackFormat = "slack"
+
+	// DiscordFormat is understood by Discord.
+	DiscordFormat = "discord"
+)
+
+// chatTitle returns the first line of a chat message (such as
+// "Example is down").
+func chatTitle(n Notification) string {
+	if n.IsEscalation() {
+		return n.Monitor.Name + " is still down"
+	} else if n.IsDown() {
+		return n.Monitor.Name + " is down"
+	}
+
+	return n.Monitor.Name + " is up again"
+}
+
+// chatField is a name and a value shown in a chat message.
+type chatField struct {
+	Name, Value string
+}
+
+// chatFields returns the details shown in a chat message.
+func chatFields(n Notification) []chatField {
+	fields := []chatField{{"Target", n.Monitor.Settings.Target}}
+	if (!n.IsDown() || n.IsEscalation()) && n.Downtime() > 0 {
+		fields = append(fields, chatField{"Downtime", n.Downtime().String()})
+	}
+
+	return fields
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Fallback  string       `json:"fallback"`
+	Color     string       `json:"color"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []slackField `json:"fields"`
+	Ts        int64        `json:"ts"`
+}
+
+// slackMessage is the body of a Slack (or Mattermost) incoming
+// webhook. The message is an attachment so that it can be colored.
+type slackMessage struct {
+	Username    string            `json:"username,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+func newSlackMessage(n Notification, username string) slackMessage {
+	a := slackAttachment{
+		Fallback:  chatTitle(n),
+		Color:     n.Event.HexColor(),
+		Title:     chatTitle(n),
+		TitleLink: n.URL,
+		Text:      n.Reason,
+		Fields:    []slackField{},
+		Ts:        n.Date.Unix(),
+	}
+
+	for _, f := range chatFields(n) {
+		a.Fields = append(a.Fields, slackField{f.Name, f.Value, true})
+	}
+
+	return slackMessage{Username: username, Attachments: []slackAttachment{a}}
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Timestamp   string         `json:"timestamp"`
+	Fields      []discordField `json:"fields"`
+}
+
+// discordMessage is the body of a Discord webhook.
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+func newDiscordMessage(n Notification, username string) discordMessage {
+	// Discord expects the color as an integer.
+	color, _ := strconv.ParseInt(strings.TrimPrefix(n.Event.HexColor(), "#"), 16, 32)
+	e := discordEmbed{
+		Title:       chatTitle(n),
+		URL:         n.URL,
+		Description: n.Reason,
+		Color:       int(color),
+		Timestamp:   n.Date.UTC().Format(time.RFC3339),
+		Fields:      []discordField{},
+	}
+
+	for _, f := range chatFields(n) {
+		e.Fields = append(e.Fields, discordField{f.Name, f.Value, true})
+	}
+
+	return discordMessage{Username: username, Embeds: []discordEmbed{e}}
+}
+
+// ChatNotifier posts notifications to the incoming webhook of
+// a chat (such as Slack or Discord).
+type ChatNotifier struct {
+	URL string
+
+	// Format is either SlackFormat or DiscordFormat.
+	Format string
+
+	// Username overrides the name the message is posted as
+	// (if it is not empty).
+	Username string
+
+	// Retries and Timeout work like those of WebhookNotifier.
+	Retries int
+	Timeout time.Duration
+
+	// Transport is used for making the requests. If nil,
+	// http.DefaultTransport will be used.
+	Transport http.RoundTripper
+}
+
+// NewChatNotifier creates a ChatNotifier posting messages in
+// the format from the config.
+func NewChatNotifier(format string, config CheckerConfig) (*ChatNotifier, error) {
+	u, err := requiredHTTPURL(config, ChatConfigURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatNotifier{
+		URL:      u,
+		Format:   format,
+		Username: config.String(ChatConfigUsername, ""),
+		Retries:  defaultWebhookRetries,
+		Timeout:  defaultWebhookTimeout,
+	}, nil
+}
+
+// Message returns the body of the request.
+func (c *ChatNotifier) Message(n Notification) ([]byte, error) {
+	if c.Format == DiscordFormat {
+		return json.Marshal(newDiscordMessage(n, c.Username))
+	}
+
+	return json.Marshal(newSlackMessage(n, c.Username))
+}
+
+// Notify posts the message. Failed requests are repeated like
+// those of webhooks.
+func (c *ChatNotifier) Notify(n Notification) error {
+	body, err := c.Message(n)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Transport: c.Transport, Timeout: c.Timeout}
+	return postJSON(client, c.URL, body, nil, c.Retries)
+}
+
+// TestNotify posts the message once (see TestNotifier).
+func (c *ChatNotifier) TestNotify(n Notification) error {
+	once := *c
+	once.Retries, once.Timeout = 0, testNotificationTimeout
+	return once.Notify(n)
+}
+
+// registerChatNotifierType registers a chat notifier posting
+// messages in the format.
+func registerChatNotifierType(format, description, placeholder string) {
+	RegisterNotifierType(NotifierType{
+		Name:        format,
+		Description: description,
+		Fields: []CheckerField{
+			{Name: ChatConfigURL, Label: "Webhook URL", Kind: FieldText,
+				Placeholder: placeholder},
+			{Name: ChatConfigUsername, Label: "Username", Kind: FieldText,
+				Placeholder: "Upchecker",
+				Help:        "Leave empty to use the name of the webhook."},
+		},
+		New: func(config CheckerConfig) (Notifier, error) {
+			c, err := NewChatNotifier(format, config)
+			if err != nil {
+				return nil, err
+			}
+
+			return c, nil
+		},
+	})
+}
+
+func init() {
+	registerChatNotifierType(SlackFormat,
+		"Posts a message to an incoming webhook of Slack or Mattermost.",
+		"https://hooks.slack.com/services/...")
+	registerChatNotifierType(DiscordFormat,
+		"Posts a message to a webhook of a Discord channel.",
+		"https://discord.com/api/webhooks/...")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewChatNotifier(t *testing.T) {
+	c, err := NewChatNotifier(SlackFormat, CheckerConfig{
+		ChatConfigURL:      "https://hooks.slack.com/services/T0/B0/x",
+		ChatConfigUsername: " Upchecker ",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if c.Format != SlackFormat || c.Username != "Upchecker" {
+		t.Errorf("Unexpected notifier: %#v", c)
+	}
+
+	for _, u := range []string{"", "hooks.slack.com/services/x", "mailto:ops@example.com"} {
+		if _, err := NewChatNotifier(DiscordFormat, CheckerConfig{ChatConfigURL: u}); err == nil {
+			t.Errorf("No error for the URL %q", u)
+		}
+	}
+
+	for _, format := range []string{SlackFormat, DiscordFormat} {
+		if _, ok := LookupNotifierType(format); !ok {
+			t.Errorf("The %s type has not been registered", format)
+		}
+	}
+}
+
+func TestSlackMessage(t *testing.T) {
+	n := testNotification()
+	n.URL = "https://upchecker.example.com/monitors/view/3/"
+	msg := newSlackMessage(n, "bot")
+	if msg.Username != "bot" || len(msg.Attachments) != 1 {
+		t.Fatalf("Unexpected message: %#v", msg)
+	}
+
+	a := msg.Attachments[0]
+	if a.Title != "Example is up again" || a.TitleLink != n.URL ||
+		a.Color != "#008000" || a.Text != "connection refused" || a.Ts != n.Date.Unix() {
+		t.Errorf("Unexpected attachment: %#v", a)
+	}
+
+	if len(a.Fields) != 2 || a.Fields[1].Title != "Downtime" || a.Fields[1].Value != "1h30m0s" {
+		t.Errorf("Unexpected fields: %#v", a.Fields)
+	}
+
+	n.Event = MonitorDownEvent
+	n.URL = ""
+	a = newSlackMessage(n, "").Attachments[0]
+	if a.Title != "Example is down" || a.Color != "#FF0000" || len(a.Fields) != 1 {
+		t.Errorf("Unexpected attachment for down event: %#v", a)
+	}
+
+	n.Escalation = 1
+	n.DownSince = n.Date.Add(-time.Hour)
+	a = newSlackMessage(n, "").Attachments[0]
+	if a.Title != "Example is still down" || len(a.Fields) != 2 || a.Fields[1].Value != "1h0m0s" {
+		t.Errorf("Unexpected attachment for escalation: %#v", a)
+	}
+
+	body, _ := json.Marshal(newSlackMessage(n, ""))
+	decoded := map[string]interface{}{}
+	json.Unmarshal(body, &decoded)
+	if _, ok := decoded["username"]; ok {
+		t.Errorf("The username has been sent although it is empty: %s", body)
+	}
+}
+
+func TestDiscordMessage(t *testing.T) {
+	n := testNotification()
+	n.Event = MonitorDownEvent
+	n.URL = "https://upchecker.example.com/monitors/view/3/"
+	msg := newDiscordMessage(n, "")
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("Unexpected message: %#v", msg)
+	}
+
+	e := msg.Embeds[0]
+	if e.Title != "Example is down" || e.URL != n.URL || e.Color != 0xFF0000 ||
+		e.Description != "connection refused" || e.Timestamp != "2016-05-01T13:30:00Z" {
+		t.Errorf("Unexpected embed: %#v", e)
+	}
+
+	if len(e.Fields) != 1 || e.Fields[0].Name != "Target" ||
+		e.Fields[0].Value != "https://example.com/" {
+		t.Errorf("Unexpected fields: %#v", e.Fields)
+	}
+}
+
+func TestChatNotifierNotify(t *testing.T) {
+	server := newWebhookTestServer(http.StatusOK)
+	defer server.Close()
+
+	c, err := NewChatNotifier(DiscordFormat, CheckerConfig{ChatConfigURL: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := c.Notify(testNotification()); err != nil {
+		t.Fatalf("Could not post message: %v", err)
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	if len(server.requests) != 1 {
+		t.Fatalf("%d requests have been made, wanted: 1", len(server.requests))
+	}
+
+	msg := discordMessage{}
+	if err := json.Unmarshal(server.bodies[0], &msg); err != nil {
+		t.Fatalf("Invalid message: %v", err)
+	}
+
+	if len(msg.Embeds) != 1 || msg.Embeds[0].Title != "Example is up again" {
+		t.Errorf("Unexpected message: %s", server.bodies[0])
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Keys of the settings of email channels.
+const (
+	EmailConfigHost     = "host"
+	EmailConfigPort     = "port"
+	EmailConfigSecurity = "security"
+	EmailConfigUsername = "username"
+	EmailConfigPassword = "password"
+	EmailConfigFrom     = "from"
+	EmailConfigTo       = "to"
+	EmailConfigSubject  = "subject"
+	EmailConfigBody     = "body"
+)
+
+// Ways of securing the connection to the SMTP server.
+const (
+	// SMTPStartTLS upgrades the connection with STARTTLS (which
+	// the server has to support).
+	SMTPStartTLS = "starttls"
+
+	// SMTPTLS connects via TLS right away (usually port 465).
+	SMTPTLS = "tls"
+
+	// SMTPPlain does not encrypt the connection.
+	SMTPPlain = "none"
+)
+
+const (
+	// defaultSMTPPort is the submission port (used with STARTTLS).
+	defaultSMTPPort = 587
+
+	// smtpTimeout is the default time after which sending a
+	// mail fails.
+	smtpTimeout = 30 * time.Second
+)
+
+// DefaultEmailSubject and DefaultEmailBody are the templates used
+// if a channel does not specify its own (see Notification).
+const (
+	DefaultEmailSubject = `[Upchecker] {{.Monitor.Name}} is {{.State}}`
+
+	DefaultEmailBody = `{{if .IsEscalation}}{{.Monitor.Name}} is still down. It has been down for {{.Downtime}}.
+{{else if .IsDown}}{{.Monitor.Name}} went down on {{.Date.Format "2006-01-02 15:04:05 MST"}}.
+{{else}}{{.Monitor.Name}} is up again since {{.Date.Format "2006-01-02 15:04:05 MST"}}.
+{{if .Downtime}}It has been down for {{.Downtime}}.
+{{end}}{{end}}
+Target: {{.Monitor.Settings.Target}}
+{{if .Reason}}Error: {{.Reason}}
+{{end}}{{with .URL}}
+Details: {{.}}
+{{end}}`
+)
+
+// EmailNotifier sends notifications as email through an SMTP server.
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Security string
+
+	// Username and Password are used to authenticate (with
+	// AUTH PLAIN) unless Username is empty.
+	Username string
+	Password string
+
+	From string
+	To   []string
+
+	Subject *template.Template
+	Body    *template.Template
+
+	// TLSConfig is used for TLS connections. If it is nil, the
+	// certificate of the server is verified against Host.
+	TLSConfig *tls.Config
+
+	// Timeout is the time after which sending a mail fails.
+	Timeout time.Duration
+}
+
+// NewEmailNotifier creates an EmailNotifier from the config.
+func NewEmailNotifier(config CheckerConfig) (*EmailNotifier, error) {
+	var err error
+	e := &EmailNotifier{
+		Host:     config.String(EmailConfigHost, ""),
+		Security: config.String(EmailConfigSecurity, SMTPStartTLS),
+		Username: config.String(EmailConfigUsername, ""),
+		Password: config[EmailConfigPassword],
+		Timeout:  smtpTimeout,
+	}
+
+	if e.Host == "" {
+		return nil, errors.New("The SMTP server is required")
+	}
+
+	if e.Port, err = config.Int(EmailConfigPort, defaultSMTPPort); err != nil {
+		return nil, err
+	} else if e.Port <= 0 || e.Port > 65535 {
+		return nil, errors.New("The port needs to be between 1 and 65535")
+	}
+
+	switch e.Security {
+	case SMTPStartTLS, SMTPTLS, SMTPPlain:
+	default:
+		return nil, fmt.Errorf("Unknown security %q", e.Security)
+	}
+
+	from, err := mail.ParseAddress(config.String(EmailConfigFrom, ""))
+	if err != nil {
+		return nil, errors.New("The sender needs to be a valid email address")
+	}
+	e.From = from.Address
+
+	to, err := mail.ParseAddressList(config.String(EmailConfigTo, ""))
+	if err != nil {
+		return nil, errors.New("The recipients need to be valid email addresses")
+	}
+
+	for _, addr := range to {
+		e.To = append(e.To, addr.Address)
+	}
+
+	subject := config.String(EmailConfigSubject, DefaultEmailSubject)
+	if e.Subject, err = template.New("subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("Invalid subject: %v", err)
+	}
+
+	body := config.String(EmailConfigBody, DefaultEmailBody)
+	if e.Body, err = template.New("body").Parse(body); err != nil {
+		return nil, fmt.Errorf("Invalid body: %v", err)
+	}
+
+	return e, nil
+}
+
+// Message returns the email for the notification (including
+// its headers).
+func (e *EmailNotifier) Message(n Notification) ([]byte, error) {
+	subject := &bytes.Buffer{}
+	if err := e.Subject.Execute(subject, n); err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	if err := e.Body.Execute(body, n); err != nil {
+		return nil, err
+	}
+
+	// Line breaks would end the header.
+	oneLine := strings.Join(strings.Fields(subject.String()), " ")
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", oneLine))
+	fmt.Fprintf(msg, "Date: %s\r\n", n.Date.Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(msg, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// Notify sends the notification to every recipient.
+func (e *EmailNotifier) Notify(n Notification) error {
+	msg, err := e.Message(n)
+	if err != nil {
+		return err
+	}
+
+	c, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if e.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("The SMTP server does not support STARTTLS")
+		}
+
+		if err := c.StartTLS(e.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(e.From); err != nil {
+		return err
+	}
+
+	for _, to := range e.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// TestNotify sends the notification within testNotificationTimeout
+// (see TestNotifier).
+func (e *EmailNotifier) TestNotify(n Notification) error {
+	quick := *e
+	quick.Timeout = testNotificationTimeout
+	return quick.Notify(n)
+}
+
+// dial connects to the SMTP server. The whole conversation
+// has to finish within e.Timeout.
+func (e *EmailNotifier) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	dialer := &net.Dialer{Timeout: e.Timeout}
+
+	var conn net.Conn
+	var err error
+	if e.Security == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, e.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(e.Timeout))
+	c, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (e *EmailNotifier) tlsConfig() *tls.Config {
+	if e.TLSConfig != nil {
+		return e.TLSConfig
+	}
+
+	return &tls.Config{ServerName: e.Host}
+}
+
+func init() {
+	RegisterNotifierType(NotifierType{
+		Name:        "email",
+		Description: "Sends an email through an SMTP server.",
+		Fields: []CheckerField{
+			{Name: EmailConfigHost, Label: "SMTP server", Kind: FieldText,
+				Placeholder: "smtp.example.com"},
+			{Name: EmailConfigPort, Label: "Port", Kind: FieldText,
+				Placeholder: strconv.Itoa(defaultSMTPPort)},
+			{Name: EmailConfigSecurity, Label: "Security", Kind: FieldSelect,
+				Choices: []string{SMTPStartTLS, SMTPTLS, SMTPPlain}},
+			{Name: EmailConfigUsername, Label: "Username", Kind: FieldText,
+				Help: "Leave empty if the server does not require to log in."},
+			{Name: EmailConfigPassword, Label: "Password", Kind: FieldPassword},
+			{Name: EmailConfigFrom, Label: "From", Kind: FieldText,
+				Placeholder: "upchecker@example.com"},
+			{Name: EmailConfigTo, Label: "To", Kind: FieldText,
+				Placeholder: "ops@example.com, oncall@example.com",
+				Help:        "Separate multiple addresses with commas."},
+			{Name: EmailConfigSubject, Label: "Subject", Kind: FieldText,
+				Placeholder: DefaultEmailSubject},
+			{Name: EmailConfigBody, Label: "Body", Kind: FieldTextarea,
+				Help: "A Go template like the subject. Leave empty for the default."},
+		},
+		New: func(config CheckerConfig) (Notifier, error) {
+			e, err := NewEmailNotifier(config)
+			if err != nil {
+				return nil, err
+			}
+
+			return e, nil
+		},
+	})
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer speaks just enough SMTP to receive mail from
+// net/smtp. It supports STARTTLS if tlsConfig is set.
+type fakeSMTPServer struct {
+	sync.Mutex
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	// Everything the clients sent.
+	auth     string
+	from     string
+	to       []string
+	data     string
+	startTLS bool
+}
+
+func newFakeSMTPServer(t *testing.T, tlsConfig *tls.Config) *fakeSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	s := &fakeSMTPServer{listener: l, tlsConfig: tlsConfig}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeSMTPServer) port() string {
+	return strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	secure := false
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP fake")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			text.PrintfLine("250-localhost")
+			if s.tlsConfig != nil && !secure {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+
+			s.Lock()
+			s.startTLS = true
+			s.Unlock()
+			secure = true
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+
+		case "AUTH":
+			decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			s.Lock()
+			s.auth = string(decoded)
+			s.Unlock()
+			text.PrintfLine("235 Authenticated")
+
+		case "MAIL":
+			s.Lock()
+			s.from = arg
+			s.Unlock()
+			text.PrintfLine("250 OK")
+
+		case "RCPT":
+			s.Lock()
+			s.to = append(s.to, arg)
+			s.Unlock()
+			text.PrintfLine("250 OK")
+
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+
+			s.Lock()
+			s.data = string(data)
+			s.Unlock()
+			text.PrintfLine("250 Queued")
+
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) Close() {
+	s.listener.Close()
+}
+
+func testNotification() Notification {
+	down := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	return Notification{
+		Monitor: Monitor{
+			Id:       3,
+			Name:     "Example",
+			Type:     "http",
+			Settings: MonitorSettings{Target: "https://example.com/"},
+		},
+		Event:     MonitorUpEvent,
+		Date:      down.Add(90 * time.Minute),
+		Reason:    "connection refused",
+		DownSince: down,
+	}
+}
+
+func TestNewEmailNotifier(t *testing.T) {
+	valid := CheckerConfig{
+		EmailConfigHost: "smtp.example.com",
+		EmailConfigFrom: "Upchecker <upchecker@example.com>",
+		EmailConfigTo:   "a@example.com, B <b@example.com>",
+	}
+
+	e, err := NewEmailNotifier(valid)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if e.Port != defaultSMTPPort || e.Security != SMTPStartTLS {
+		t.Errorf("Unexpected defaults: port %d, security %q", e.Port, e.Security)
+	}
+
+	if e.From != "upchecker@example.com" {
+		t.Errorf("Unexpected sender: %q", e.From)
+	}
+
+	if strings.Join(e.To, ",") != "a@example.com,b@example.com" {
+		t.Errorf("Unexpected recipients: %q", e.To)
+	}
+
+	invalid := []CheckerConfig{
+		{EmailConfigHost: ""},
+		{EmailConfigPort: "smtp"},
+		{EmailConfigPort: "70000"},
+		{EmailConfigSecurity: "ssl"},
+		{EmailConfigFrom: "upchecker"},
+		{EmailConfigTo: ""},
+		{EmailConfigSubject: "{{.Monitor.Name"},
+		{EmailConfigBody: "{{end}}"},
+	}
+
+	for _, changes := range invalid {
+		config := CheckerConfig{}
+		for key, value := range valid {
+			config[key] = value
+		}
+		for key, value := range changes {
+			config[key] = value
+		}
+
+		if _, err := NewEmailNotifier(config); err == nil {
+			t.Errorf("No error for invalid config %v", changes)
+		}
+	}
+}
+
+func TestEmailNotifierMessage(t *testing.T) {
+	e, err := NewEmailNotifier(CheckerConfig{
+		EmailConfigHost: "smtp.example.com",
+		EmailConfigFrom: "upchecker@example.com",
+		EmailConfigTo:   "ops@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	msg, err := e.Message(testNotification())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"Subject: [Upchecker] Example is up\r\n",
+		"To: ops@example.com\r\n",
+		"Example is up again since 2016-05-01 13:30:00 UTC.\n",
+		"It has been down for 1h30m0s.\n",
+		"Target: https://example.com/\n",
+		"Error: connection refused\n",
+	}
+
+	for _, s := range expected {
+		if !strings.Contains(string(msg), s) {
+			t.Errorf("Message does not contain %q:\n%s", s, msg)
+		}
+	}
+
+	if strings.Contains(string(msg), "Details:") {
+		t.Errorf("Message links to the monitor without a URL:\n%s", msg)
+	}
+
+	n := testNotification()
+	n.Event, n.Date = MonitorDownEvent, n.DownSince
+	n.URL = "https://upchecker.example.com/monitors/view/3/"
+	msg, _ = e.Message(n)
+	if !strings.Contains(string(msg), "Details: "+n.URL+"\n") {
+		t.Errorf("Message does not link to the monitor:\n%s", msg)
+	}
+
+	if !strings.Contains(string(msg), "Example went down on 2016-05-01 12:00:00 UTC.") {
+		t.Errorf("Unexpected message for down event:\n%s", msg)
+	} else if strings.Contains(string(msg), "down for") {
+		t.Errorf("Message for down event contains downtime:\n%s", msg)
+	}
+
+	n = testNotification()
+	n.Event, n.Escalation = MonitorDownEvent, 2
+	msg, _ = e.Message(n)
+	if !strings.Contains(string(msg), "Subject: [Upchecker] Example is still down\r\n") ||
+		!strings.Contains(string(msg), "Example is still down. It has been down for 1h30m0s.\n") {
+		t.Errorf("Unexpected message for escalation:\n%s", msg)
+	}
+
+	e.Subject.Parse("Ümlaut\n{{.Monitor.Name}}")
+	msg, _ = e.Message(n)
+	if !strings.Contains(string(msg), "Subject: =?utf-8?q?=C3=9Cmlaut_Example?=\r\n") {
+		t.Errorf("Subject has not been encoded:\n%s", msg)
+	}
+}
+
+func TestEmailNotifierNotify(t *testing.T) {
+	server := newFakeSMTPServer(t, nil)
+	defer server.Close()
+
+	e, err := NewEmailNotifier(CheckerConfig{
+		EmailConfigHost:     "127.0.0.1",
+		EmailConfigPort:     server.port(),
+		EmailConfigSecurity: SMTPPlain,
+		EmailConfigUsername: "user",
+		EmailConfigPassword: "secret",
+		EmailConfigFrom:     "upchecker@example.com",
+		EmailConfigTo:       "a@example.com, b@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := e.Notify(testNotification()); err != nil {
+		t.Fatalf("Could not send mail: %v", err)
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	if server.auth != "\x00user\x00secret" {
+		t.Errorf("Unexpected authentication: %q", server.auth)
+	}
+
+	if server.from != "FROM:<upchecker@example.com>" {
+		t.Errorf("Unexpected sender: %q", server.from)
+	}
+
+	if len(server.to) != 2 || server.to[1] != "TO:<b@example.com>" {
+		t.Errorf("Unexpected recipients: %q", server.to)
+	}
+
+	if !strings.Contains(server.data, "Subject: [Upchecker] Example is up") {
+		t.Errorf("Unexpected mail:\n%s", server.data)
+	}
+}
+
+func TestEmailNotifierStartTLS(t *testing.T) {
+	// The certificate of httptest is valid for 127.0.0.1.
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+
+	server := newFakeSMTPServer(t, &tls.Config{Certificates: https.TLS.Certificates})
+	defer server.Close()
+
+	config := CheckerConfig{
+		EmailConfigHost:     "127.0.0.1",
+		EmailConfigPort:     server.port(),
+		EmailConfigUsername: "user",
+		EmailConfigPassword: "secret",
+		EmailConfigFrom:     "upchecker@example.com",
+		EmailConfigTo:       "ops@example.com",
+	}
+
+	e, err := NewEmailNotifier(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The certificate is not trusted.
+	if err := e.Notify(testNotification()); err == nil {
+		t.Errorf("No error for an untrusted certificate")
+	}
+
+	e.TLSConfig = https.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	e.TLSConfig.ServerName = "127.0.0.1"
+	if err := e.Notify(testNotification()); err != nil {
+		t.Fatalf("Could not send mail: %v", err)
+	}
+
+	server.Lock()
+	if !server.startTLS || server.auth != "\x00user\x00secret" {
+		t.Errorf("Mail has not been sent via STARTTLS (auth: %q)", server.auth)
+	}
+	server.Unlock()
+
+	plain := newFakeSMTPServer(t, nil)
+	defer plain.Close()
+	config[EmailConfigPort] = plain.port()
+	e, _ = NewEmailNotifier(config)
+	if err := e.Notify(testNotification()); err == nil {
+		t.Errorf("No error for a server without STARTTLS")
+	}
+}
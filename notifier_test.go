@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/pg.v4"
+)
+
+func TestNotification(t *testing.T) {
+	n := testNotification()
+	if n.IsDown() || n.State() != "up" {
+		t.Errorf("Up notification: IsDown() = %v, State() = %q", n.IsDown(), n.State())
+	}
+
+	if d := n.Downtime(); d != 90*time.Minute {
+		t.Errorf("Downtime() = %v, wanted: 1h30m", d)
+	}
+
+	n.DownSince = time.Time{}
+	if d := n.Downtime(); d != 0 {
+		t.Errorf("Downtime() = %v without DownSince, wanted: 0", d)
+	}
+
+	n.Event = MonitorDownEvent
+	if !n.IsDown() || n.IsEscalation() || n.State() != "down" {
+		t.Errorf("Down notification: IsDown() = %v, State() = %q", n.IsDown(), n.State())
+	}
+
+	n.Escalation = 1
+	if !n.IsEscalation() || n.State() != "still down" {
+		t.Errorf("Escalation: IsEscalation() = %v, State() = %q", n.IsEscalation(), n.State())
+	}
+}
+
+func TestIsNotified(t *testing.T) {
+	testcase := []struct {
+		last, event EventType
+		expected    bool
+	}{
+		{MonitorCreatedEvent, MonitorDownEvent, true},
+		{MonitorUpEvent, MonitorDownEvent, true},
+		{MonitorDownEvent, MonitorUpEvent, true},
+		{MonitorCreatedEvent, MonitorUpEvent, false},
+		{MonitorStartedEvent, MonitorUpEvent, false},
+	}
+
+	for _, row := range testcase {
+		if ok := isNotified(row.last, row.event); ok != row.expected {
+			t.Errorf("isNotified(%v, %v) = %v, wanted: %v",
+				row.last, row.event, ok, row.expected)
+		}
+	}
+}
+
+func TestNewNotifier(t *testing.T) {
+	if _, ok := LookupNotifierType("email"); !ok {
+		t.Errorf("The email type has not been registered")
+	}
+
+	_, err := NewNotifier(NotificationChannel{Name: "Pager", Type: "pager"})
+	if err == nil {
+		t.Errorf("No error for an unknown type")
+	}
+
+	_, err = NewNotifier(NotificationChannel{Type: "email", Settings: map[string]string{
+		EmailConfigHost: "smtp.example.com",
+		EmailConfigFrom: "upchecker@example.com",
+		EmailConfigTo:   "ops@example.com",
+	}})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoadNotificationChannels(t *testing.T) {
+	defer InitTestConnection(t)()
+
+	channels := []NotificationChannel{
+		{Name: "c", Type: "webhook", Created: time.Now()},
+		{Name: "a", Type: "email", Created: time.Now()},
+		{Name: "b", Type: "slack", Created: time.Now()},
+	}
+	if err := db.Create(&channels); err != nil {
+		t.Fatal(err)
+	}
+
+	escalation := &EscalationPolicy{ChannelIds: []int{channels[2].Id}, After: 5}
+	testcase := []struct {
+		settings   MonitorSettings
+		escalation int
+		expected   string
+	}{
+		{MonitorSettings{}, 0, ""},
+		{MonitorSettings{ChannelIds: []int{channels[0].Id, channels[1].Id}}, 0, "a,c"},
+		{MonitorSettings{ChannelIds: []int{channels[2].Id, 1000}}, 0, "b"},
+		{MonitorSettings{ChannelIds: []int{channels[0].Id}, Escalation: escalation}, 0, "c"},
+		{MonitorSettings{ChannelIds: []int{channels[0].Id}, Escalation: escalation}, 1, "b"},
+		{MonitorSettings{ChannelIds: []int{channels[0].Id}}, 1, ""},
+	}
+
+	for _, row := range testcase {
+		n := Notification{
+			Monitor:    Monitor{Settings: row.settings},
+			Event:      MonitorDownEvent,
+			Escalation: row.escalation,
+		}
+		loaded, err := loadNotificationChannels(n)
+		names := []string{}
+		for _, c := range loaded {
+			names = append(names, c.Name)
+		}
+
+		if err != nil || strings.Join(names, ",") != row.expected {
+			t.Errorf("loadNotificationChannels(%v, %d) => %v, %v, wanted: %s",
+				row.settings.ChannelIds, row.escalation, names, err, row.expected)
+		}
+	}
+}
+
+// notifierFunc lets functions be used as Notifiers.
+type notifierFunc func(Notification) error
+
+func (f notifierFunc) Notify(n Notification) error {
+	return f(n)
+}
+
+func TestNotificationDispatcher(t *testing.T) {
+	defer shutupLog()()
+
+	var mu sync.Mutex
+	sent := map[string][]Notification{}
+	deliveries := []NotificationDelivery{}
+	down := MonitorLog{Event: MonitorDownEvent, Date: time.Now().Add(-time.Hour), Reason: "timeout"}
+
+	d := &NotificationDispatcher{
+		Channels: func(n Notification) ([]NotificationChannel, error) {
+			if n.Monitor.Id == 3 {
+				return nil, errors.New("database is down")
+			}
+
+			return []NotificationChannel{{Id: 1, Name: "a"}, {Id: 2, Name: "broken"},
+				{Id: 3, Name: "b"}}, nil
+		},
+		New: func(c NotificationChannel) (Notifier, error) {
+			if c.Name == "broken" {
+				return nil, errors.New("invalid channel")
+			}
+
+			return notifierFunc(func(n Notification) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sent[c.Name] = append(sent[c.Name], n)
+				return nil
+			}), nil
+		},
+		LastDown: func(monitorID int, before time.Time) (MonitorLog, error) {
+			if monitorID == 2 {
+				return MonitorLog{}, pg.ErrNoRows
+			}
+
+			return down, nil
+		},
+		Record: func(delivery NotificationDelivery) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deliveries = append(deliveries, delivery)
+			return nil
+		},
+		BaseURL: "https://upchecker.example.com/",
+	}
+
+	now := time.Now()
+	d.Start()
+	d.Add(Notification{Monitor: Monitor{Id: 1}, Event: MonitorDownEvent, Date: now, Reason: "refused"})
+	d.Add(Notification{Monitor: Monitor{Id: 1}, Event: MonitorUpEvent, Date: now, Reason: "200 OK"})
+	d.Add(Notification{Monitor: Monitor{Id: 2}, Event: MonitorUpEvent, Date: now})
+	d.Add(Notification{Monitor: Monitor{Id: 3}, Event: MonitorDownEvent, Date: now})
+	d.Add(Notification{Monitor: Monitor{Id: 4}, Event: MonitorDownEvent, Date: now,
+		DownSince: down.Date, Escalation: 1})
+	d.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent["a"]) != 4 || len(sent["b"]) != 4 {
+		t.Fatalf("Sent %d and %d notifications, wanted: 4 each", len(sent["a"]), len(sent["b"]))
+	}
+
+	if n := sent["a"][0]; !n.DownSince.Equal(now) || n.Reason != "refused" ||
+		n.URL != "https://upchecker.example.com/monitors/view/1/" {
+		t.Errorf("Unexpected down notification: %#v", n)
+	}
+
+	if n := sent["a"][1]; !n.DownSince.Equal(down.Date) || n.Reason != "timeout" {
+		t.Errorf("Up notification does not describe the outage: %#v", n)
+	}
+
+	if n := sent["b"][2]; !n.DownSince.IsZero() {
+		t.Errorf("Unexpected start of the outage: %v", n.DownSince)
+	}
+
+	if n := sent["a"][3]; !n.DownSince.Equal(down.Date) || n.Escalation != 1 {
+		t.Errorf("Escalation does not keep the start of the outage: %#v", n)
+	}
+
+	// Monitor 3 has no channels, so nothing is delivered.
+	if len(deliveries) != 12 {
+		t.Fatalf("Recorded %d deliveries, wanted: 12", len(deliveries))
+	}
+
+	for i, delivery := range deliveries {
+		if failed := delivery.Channel == "broken"; delivery.Delivered() == failed {
+			t.Errorf("Delivery %d to %q: unexpected error %q", i, delivery.Channel, delivery.Error)
+		}
+	}
+
+	// The channels are notified concurrently, but in order.
+	for _, d := range deliveries {
+		if d.Channel == "broken" {
+			if d.MonitorId != 1 || d.Event != MonitorDownEvent || d.Date.IsZero() {
+				t.Errorf("Unexpected delivery: %#v", d)
+			}
+			break
+		}
+	}
+}
+
+func TestNotificationDispatcherHangingChannel(t *testing.T) {
+	defer shutupLog()()
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hanging.Close()
+
+	sent := make(chan Notification, 2)
+	d := &NotificationDispatcher{
+		Channels: func(n Notification) ([]NotificationChannel, error) {
+			return []NotificationChannel{{Id: 1, Name: "hanging"}, {Id: 2, Name: "working"}}, nil
+		},
+		New: func(c NotificationChannel) (Notifier, error) {
+			if c.Name == "hanging" {
+				return &WebhookNotifier{URL: hanging.URL, Retries: 3, Timeout: time.Minute}, nil
+			}
+
+			return notifierFunc(func(n Notification) error {
+				sent <- n
+				return nil
+			}), nil
+		},
+		LastDown: func(int, time.Time) (MonitorLog, error) {
+			return MonitorLog{}, pg.ErrNoRows
+		},
+	}
+
+	d.Start()
+	defer d.Stop()
+	defer close(release)
+	d.Add(Notification{Monitor: Monitor{Id: 1}, Event: MonitorDownEvent, Date: time.Now()})
+	d.Add(Notification{Monitor: Monitor{Id: 2}, Event: MonitorDownEvent, Date: time.Now()})
+
+	for _, id := range []int{1, 2} {
+		select {
+		case n := <-sent:
+			if n.Monitor.Id != id {
+				t.Errorf("Monitor %d notified, wanted: %d", n.Monitor.Id, id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The hanging webhook blocked the notification of monitor %d", id)
+		}
+	}
+}
+
+func TestLoadLastDown(t *testing.T) {
+	defer InitTestConnection(t)()
+
+	monitor := Monitor{Name: "Notified", Type: "http"}
+	if err := db.Create(&monitor); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	logs := []MonitorLog{
+		{Event: MonitorDownEvent, Date: start, MonitorId: monitor.Id, Reason: "first"},
+		{Event: MonitorUpEvent, Date: start.Add(time.Minute), MonitorId: monitor.Id},
+		{Event: MonitorDownEvent, Date: start.Add(2 * time.Minute), MonitorId: monitor.Id, Reason: "second"},
+	}
+	if err := db.Create(&logs); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := loadLastDown(monitor.Id, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if entry.Reason != "second" {
+		t.Errorf("Loaded the down event %q, wanted: second", entry.Reason)
+	}
+
+	entry, err = loadLastDown(monitor.Id, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	} else if entry.Reason != "first" {
+		t.Errorf("Loaded the down event %q, wanted: first", entry.Reason)
+	}
+
+	if _, err := loadLastDown(monitor.Id, start.Add(-time.Minute)); err != pg.ErrNoRows {
+		t.Errorf("Wanted pg.ErrNoRows, got: %v", err)
+	}
+}
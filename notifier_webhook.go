@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Keys of the settings of webhook channels.
+const (
+	WebhookConfigURL     = "url"
+	WebhookConfigSecret  = "secret"
+	WebhookConfigRetries = "retries"
+	WebhookConfigTimeout = "timeout"
+)
+
+// WebhookSignatureHeader contains the HMAC-SHA256 of the body
+// (keyed with the secret of the channel) as "sha256=<hex>".
+const WebhookSignatureHeader = "X-Upchecker-Signature"
+
+const (
+	// defaultWebhookRetries is the number of times a failed
+	// delivery is repeated.
+	defaultWebhookRetries = 3
+
+	// maxWebhookRetries limits the retries, so that a failing
+	// channel waits at most 31s (see webhookRetryDelay) before
+	// the next notification is sent to it.
+	maxWebhookRetries = 5
+
+	// defaultWebhookTimeout is the time after which a single
+	// attempt fails.
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// webhookRetryDelay is the time to wait before the first retry of
+// a failed delivery. It is doubled for every further retry.
+var webhookRetryDelay = time.Second
+
+// webhookMonitor is the monitor as sent to webhooks.
+type webhookMonitor struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// webhookPayload is the body of a webhook request. Event is either
+// "down" or "up" (see apiEventName).
+type webhookPayload struct {
+	Monitor webhookMonitor `json:"monitor"`
+	Event   string         `json:"event"`
+	Date    time.Time      `json:"date"`
+	Reason  string         `json:"reason"`
+
+	// URL is the page of the monitor (see Notification.URL).
+	URL string `json:"url,omitempty"`
+
+	// DownSince and DowntimeSeconds are omitted if it is unknown
+	// since when the monitor has been down.
+	DownSince       *time.Time `json:"down_since,omitempty"`
+	DowntimeSeconds int64      `json:"downtime_seconds,omitempty"`
+
+	// Escalation is set if the monitor is still down (see
+	// Notification.Escalation).
+	Escalation int `json:"escalation,omitempty"`
+}
+
+func newWebhookPayload(n Notification) webhookPayload {
+	p := webhookPayload{
+		Monitor: webhookMonitor{
+			Id:     n.Monitor.Id,
+			Name:   n.Monitor.Name,
+			Type:   n.Monitor.Type,
+			Target: n.Monitor.Settings.Target,
+		},
+		Event:      apiEventName(n.Event),
+		Date:       n.Date,
+		Reason:     n.Reason,
+		URL:        n.URL,
+		Escalation: n.Escalation,
+	}
+
+	if !n.DownSince.IsZero() {
+		p.DownSince = &n.DownSince
+		p.DowntimeSeconds = int64(n.Downtime() / time.Second)
+	}
+
+	return p
+}
+
+// signWebhook returns the value of WebhookSignatureHeader.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookNotifier posts notifications as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+
+	// Retries is the number of times a failed delivery is
+	// repeated (waiting longer each time).
+	Retries int
+	Timeout time.Duration
+
+	// Transport is used for making the requests. If nil,
+	// http.DefaultTransport will be used.
+	Transport http.RoundTripper
+}
+
+// requiredHTTPURL returns the value for key if it is an http(s) URL.
+func requiredHTTPURL(config CheckerConfig, key string) (string, error) {
+	rawURL, err := config.Required(key)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("Invalid http(s) URL: %q", rawURL)
+	}
+
+	return u.String(), nil
+}
+
+// NewWebhookNotifier creates a WebhookNotifier from the config.
+func NewWebhookNotifier(config CheckerConfig) (*WebhookNotifier, error) {
+	u, err := requiredHTTPURL(config, WebhookConfigURL)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WebhookNotifier{URL: u}
+	if w.Secret, err = config.Required(WebhookConfigSecret); err != nil {
+		return nil, err
+	}
+
+	w.Retries, err = config.Int(WebhookConfigRetries, defaultWebhookRetries)
+	if err != nil {
+		return nil, err
+	} else if w.Retries < 0 || w.Retries > maxWebhookRetries {
+		return nil, fmt.Errorf("The number of retries needs to be between 0 and %d",
+			maxWebhookRetries)
+	}
+
+	w.Timeout, err = config.Duration(WebhookConfigTimeout, defaultWebhookTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Notify posts the notification. Failed deliveries (such as
+// connection errors or server errors) are repeated up to
+// w.Retries times.
+func (w *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(newWebhookPayload(n))
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("X-Upchecker-Event", apiEventName(n.Event))
+	header.Set(WebhookSignatureHeader, signWebhook(w.Secret, body))
+
+	client := &http.Client{Transport: w.Transport, Timeout: w.Timeout}
+	return postJSON(client, w.URL, body, header, w.Retries)
+}
+
+// TestNotify posts the notification once (see TestNotifier).
+func (w *WebhookNotifier) TestNotify(n Notification) error {
+	once := *w
+	once.Retries, once.Timeout = 0, testNotificationTimeout
+	return once.Notify(n)
+}
+
+// postJSON posts the JSON body to the URL. Failed requests are
+// repeated up to retries times (waiting twice as long each time)
+// if another attempt might succeed.
+func postJSON(client *http.Client, url string, body []byte, header http.Header, retries int) error {
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := postJSONOnce(client, url, body, header)
+		if err == nil {
+			return nil
+		} else if !retry || attempt >= retries {
+			return fmt.Errorf("%v (after %d attempts)", err, attempt+1)
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postJSONOnce makes a single attempt to post the body. If it
+// failed, retry tells whether another attempt might succeed.
+func postJSONOnce(client *http.Client, url string, body []byte, header http.Header) (retry bool, err error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", jsonContent)
+	req.Header.Set("User-Agent", "Upchecker")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, errors.New("Server returned " + resp.Status)
+	default:
+		return false, errors.New("Server returned " + resp.Status)
+	}
+}
+
+func init() {
+	RegisterNotifierType(NotifierType{
+		Name:        "webhook",
+		Description: "Posts a JSON payload signed with HMAC-SHA256 to a URL.",
+		Fields: []CheckerField{
+			{Name: WebhookConfigURL, Label: "URL", Kind: FieldText,
+				Placeholder: "https://example.com/hooks/upchecker"},
+			{Name: WebhookConfigSecret, Label: "Secret", Kind: FieldPassword,
+				Help: "The " + WebhookSignatureHeader + " header contains the " +
+					"HMAC-SHA256 of the body keyed with the secret."},
+			{Name: WebhookConfigRetries, Label: "Retries", Kind: FieldText,
+				Placeholder: strconv.Itoa(defaultWebhookRetries),
+				Help:        "At most " + strconv.Itoa(maxWebhookRetries) + "."},
+			{Name: WebhookConfigTimeout, Label: "Timeout", Kind: FieldText,
+				Placeholder: defaultWebhookTimeout.String()},
+		},
+		New: func(config CheckerConfig) (Notifier, error) {
+			w, err := NewWebhookNotifier(config)
+			if err != nil {
+				return nil, err
+			}
+
+			return w, nil
+		},
+	})
+}
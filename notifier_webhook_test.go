@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewWebhookNotifier(t *testing.T) {
+	w, err := NewWebhookNotifier(CheckerConfig{
+		WebhookConfigURL:    "https://example.com/hook",
+		WebhookConfigSecret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if w.Retries != defaultWebhookRetries || w.Timeout != defaultWebhookTimeout {
+		t.Errorf("Unexpected defaults: %d retries, timeout %v", w.Retries, w.Timeout)
+	}
+
+	invalid := []CheckerConfig{
+		{WebhookConfigSecret: "secret"},
+		{WebhookConfigURL: "ftp://example.com/", WebhookConfigSecret: "secret"},
+		{WebhookConfigURL: "https://example.com/"},
+		{WebhookConfigURL: "https://example.com/", WebhookConfigSecret: "s",
+			WebhookConfigRetries: "-1"},
+		{WebhookConfigURL: "https://example.com/", WebhookConfigSecret: "s",
+			WebhookConfigRetries: "20"},
+		{WebhookConfigURL: "https://example.com/", WebhookConfigSecret: "s",
+			WebhookConfigTimeout: "never"},
+	}
+
+	for _, config := range invalid {
+		if _, err := NewWebhookNotifier(config); err == nil {
+			t.Errorf("No error for invalid config %v", config)
+		}
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '{}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+	if sig := signWebhook("secret", []byte("{}")); sig != expected {
+		t.Errorf("signWebhook() = %q, wanted: %q", sig, expected)
+	}
+}
+
+// webhookTestServer answers with the given status codes (one per
+// request, the last one is repeated) and records every request.
+type webhookTestServer struct {
+	sync.Mutex
+	*httptest.Server
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookTestServer(statuses ...int) *webhookTestServer {
+	s := &webhookTestServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.Lock()
+		defer s.Unlock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+
+		status := s.statuses[len(s.statuses)-1]
+		if len(s.requests) <= len(s.statuses) {
+			status = s.statuses[len(s.requests)-1]
+		}
+
+		w.WriteHeader(status)
+	}))
+
+	return s
+}
+
+func newTestWebhookNotifier(t *testing.T, url string) *WebhookNotifier {
+	w, err := NewWebhookNotifier(CheckerConfig{
+		WebhookConfigURL:     url,
+		WebhookConfigSecret:  "secret",
+		WebhookConfigRetries: "2",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return w
+}
+
+func TestWebhookNotifierNotify(t *testing.T) {
+	server := newWebhookTestServer(http.StatusNoContent)
+	defer server.Close()
+
+	w := newTestWebhookNotifier(t, server.URL)
+	if err := w.Notify(testNotification()); err != nil {
+		t.Fatalf("Could not deliver webhook: %v", err)
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	if len(server.requests) != 1 {
+		t.Fatalf("%d requests have been made, wanted: 1", len(server.requests))
+	}
+
+	r, body := server.requests[0], server.bodies[0]
+	if r.Method != "POST" || r.Header.Get("Content-Type") != jsonContent {
+		t.Errorf("Unexpected request: %s (%s)", r.Method, r.Header.Get("Content-Type"))
+	}
+
+	if sig := r.Header.Get(WebhookSignatureHeader); sig != signWebhook("secret", body) {
+		t.Errorf("Unexpected signature: %q", sig)
+	}
+
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Invalid payload: %v", err)
+	}
+
+	monitor, _ := payload["monitor"].(map[string]interface{})
+	if monitor["name"] != "Example" || monitor["target"] != "https://example.com/" {
+		t.Errorf("Unexpected monitor: %v", payload["monitor"])
+	}
+
+	expected := map[string]interface{}{
+		"event":            "up",
+		"reason":           "connection refused",
+		"date":             "2016-05-01T13:30:00Z",
+		"down_since":       "2016-05-01T12:00:00Z",
+		"downtime_seconds": float64(90 * 60),
+	}
+
+	for key, value := range expected {
+		if payload[key] != value {
+			t.Errorf("%s = %v, wanted: %v", key, payload[key], value)
+		}
+	}
+}
+
+func TestWebhookNotifierRetry(t *testing.T) {
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	testcase := []struct {
+		statuses []int
+		requests int
+		ok       bool
+	}{
+		{[]int{http.StatusBadGateway, http.StatusOK}, 2, true},
+		{[]int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}, 3, true},
+		{[]int{http.StatusInternalServerError}, 3, false},
+		{[]int{http.StatusNotFound, http.StatusOK}, 1, false},
+	}
+
+	for _, row := range testcase {
+		server := newWebhookTestServer(row.statuses...)
+		err := newTestWebhookNotifier(t, server.URL).Notify(testNotification())
+		server.Close()
+
+		if (err == nil) != row.ok {
+			t.Errorf("Statuses %v: unexpected error: %v", row.statuses, err)
+		}
+
+		if n := len(server.requests); n != row.requests {
+			t.Errorf("Statuses %v: %d requests, wanted: %d", row.statuses, n, row.requests)
+		}
+	}
+
+	// Connection errors are repeated, too.
+	server := newWebhookTestServer(http.StatusOK)
+	server.Close()
+	err := newTestWebhookNotifier(t, server.URL).Notify(testNotification())
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestWebhookNotifierTestNotify(t *testing.T) {
+	server := newWebhookTestServer(http.StatusInternalServerError)
+	defer server.Close()
+
+	w := newTestWebhookNotifier(t, server.URL)
+	if err := sendTestNotification(w, testNotification()); err == nil {
+		t.Errorf("sendTestNotification did not return an error")
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	if len(server.requests) != 1 {
+		t.Errorf("%d requests have been made, wanted: 1", len(server.requests))
+	}
+
+	if w.Retries != 2 || w.Timeout != defaultWebhookTimeout {
+		t.Errorf("The settings of the notifier have been changed: %#v", w)
+	}
+}
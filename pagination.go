@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Pagination splits a list into pages. Pages are numbered
+// starting with 1.
+type Pagination struct {
+	Page     int
+	PageSize int
+	Total    int
+}
+
+// NewPagination returns the page selected by the query parameter
+// "page". Invalid pages are replaced by the nearest valid one.
+func NewPagination(query url.Values, pageSize, total int) Pagination {
+	p := Pagination{Page: 1, PageSize: pageSize, Total: total}
+	if page, err := strconv.Atoi(query.Get("page")); err == nil {
+		p.Page = page
+	}
+
+	if p.Page > p.Pages() {
+		p.Page = p.Pages()
+	}
+
+	if p.Page < 1 {
+		p.Page = 1
+	}
+
+	return p
+}
+
+// Pages returns the number of pages (at least 1).
+func (p Pagination) Pages() int {
+	if p.Total <= 0 {
+		return 1
+	}
+
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+// Offset returns the index of the first item on the page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// HasPrev is true if there is a previous page.
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+// HasNext is true if there is a next page.
+func (p Pagination) HasNext() bool {
+	return p.Page < p.Pages()
+}
+
+// Prev returns the number of the previous page.
+func (p Pagination) Prev() int {
+	return p.Page - 1
+}
+
+// Next returns the number of the next page.
+func (p Pagination) Next() int {
+	return p.Page + 1
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNewPagination(t *testing.T) {
+	testcase := []struct {
+		page             string
+		total            int
+		expected, pages  int
+		offset           int
+		hasPrev, hasNext bool
+	}{
+		{"", 0, 1, 1, 0, false, false},
+		{"", 120, 1, 3, 0, false, true},
+		{"2", 120, 2, 3, 50, true, true},
+		{"3", 120, 3, 3, 100, true, false},
+		{"4", 120, 3, 3, 100, true, false},
+		{"0", 120, 1, 3, 0, false, true},
+		{"-5", 120, 1, 3, 0, false, true},
+		{"abc", 120, 1, 3, 0, false, true},
+		{"2", 100, 2, 2, 50, true, false},
+	}
+
+	for _, row := range testcase {
+		p := NewPagination(url.Values{"page": {row.page}}, 50, row.total)
+		if p.Page != row.expected || p.Pages() != row.pages || p.Offset() != row.offset ||
+			p.HasPrev() != row.hasPrev || p.HasNext() != row.hasNext {
+			t.Errorf("NewPagination(page=%q, total=%d) => %+v", row.page, row.total, p)
+		}
+	}
+}
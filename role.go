@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Role determines what a user is allowed to do. Every role
+// includes the permissions of the roles before it.
+type Role string
+
+const (
+	// Anyone does not require a role (such as the login page).
+	// Whether users need to be logged in is determined by the
+	// path (see SessionAuthenticator).
+	Anyone Role = ""
+
+	// ViewerRole can see the monitors and their logs.
+	ViewerRole Role = "viewer"
+
+	// EditorRole can add, edit, pause and resume monitors and
+	// work on their incidents.
+	EditorRole Role = "editor"
+
+	// AdminRole can delete monitors and manage the users,
+	// API tokens and notification channels.
+	AdminRole Role = "admin"
+)
+
+// Roles are all roles that can be assigned to a user (ordered
+// by their permissions).
+var Roles = []Role{ViewerRole, EditorRole, AdminRole}
+
+var errForbidden = StatusError{
+	Status:  http.StatusForbidden,
+	Message: "You are not allowed to do that",
+}
+
+// level returns the position of r in Roles (or -1 if r
+// is not a valid role).
+func (r Role) level() int {
+	for i, role := range Roles {
+		if r == role {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Valid is true if r is one of Roles.
+func (r Role) Valid() bool {
+	return r.level() >= 0
+}
+
+// Includes is true if r has all permissions of required.
+func (r Role) Includes(required Role) bool {
+	return required == Anyone || (r.Valid() && r.level() >= required.level())
+}
+
+// RequireRole wraps h so that it is only called if the user who
+// made the request has the role (or a role including it).
+// Everyone else gets errForbidden.
+func RequireRole(role Role, h UptimeCheckerHandler) UptimeCheckerHandler {
+	if role == Anyone {
+		return h
+	}
+
+	return func(r *http.Request, p httprouter.Params) Page {
+		user := UserFromRequest(r)
+		if user == nil || !user.Role.Includes(role) {
+			return defaultTW.SetError(errForbidden)
+		}
+
+		return h(r, p)
+	}
+}
+
+// Permissions are passed to the templates, so that they only show
+// the actions the user who is logged in may perform.
+type Permissions struct {
+	Role Role
+}
+
+// permissionsOf returns the permissions of the user who has made
+// the request.
+func permissionsOf(r *http.Request) Permissions {
+	if user := UserFromRequest(r); user != nil {
+		return Permissions{Role: user.Role}
+	}
+
+	return Permissions{}
+}
+
+// CanEdit is true if the user may add, edit, pause and resume
+// monitors and work on their incidents.
+func (p Permissions) CanEdit() bool {
+	return p.Role.Includes(EditorRole)
+}
+
+// CanDelete is true if the user may delete monitors.
+func (p Permissions) CanDelete() bool {
+	return p.Role.Includes(AdminRole)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	testcase := []struct {
+		role, required Role
+		included       bool
+	}{
+		{ViewerRole, ViewerRole, true},
+		{ViewerRole, EditorRole, false},
+		{ViewerRole, AdminRole, false},
+		{EditorRole, ViewerRole, true},
+		{EditorRole, EditorRole, true},
+		{EditorRole, AdminRole, false},
+		{AdminRole, ViewerRole, true},
+		{AdminRole, AdminRole, true},
+		{Role("root"), ViewerRole, false},
+		{Role(""), ViewerRole, false},
+		{Role(""), Anyone, true},
+	}
+
+	for _, row := range testcase {
+		if i := row.role.Includes(row.required); i != row.included {
+			t.Errorf("%q.Includes(%q) => %v, wanted: %v", row.role, row.required, i, row.included)
+		}
+	}
+
+	if Anyone.Valid() || Role("root").Valid() || !EditorRole.Valid() {
+		t.Errorf("Role.Valid does not match Roles")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	called := false
+	handler := RequireRole(EditorRole, func(_ *http.Request, _ httprouter.Params) Page {
+		called = true
+		return nil
+	})
+
+	testcase := []struct {
+		user    *User
+		allowed bool
+	}{
+		{nil, false},
+		{&User{Role: ViewerRole}, false},
+		{&User{Role: EditorRole}, true},
+		{&User{Role: AdminRole}, true},
+	}
+
+	for _, row := range testcase {
+		called = false
+		r := MustRequest(t, "POST", "/monitors/pause/1/", nil)
+		if row.user != nil {
+			r = withUser(r, row.user)
+		}
+
+		page := handler(r, nil)
+		if called != row.allowed {
+			t.Errorf("User %#v: handler called: %v, wanted: %v", row.user, called, row.allowed)
+		}
+
+		if !row.allowed {
+			tw := getTemplateWriter(t, page)
+			if tw.Err != errForbidden || tw.StatusCode != http.StatusForbidden {
+				t.Errorf("User %#v: wanted errForbidden; got: %#v", row.user, tw)
+			}
+		}
+	}
+}
+
+func TestRequireRoleAnyone(t *testing.T) {
+	page := RequireRole(Anyone, func(_ *http.Request, _ httprouter.Params) Page {
+		return Redirect{Location: "/"}
+	})(MustRequest(t, "GET", "/login/", nil), nil)
+
+	if _, ok := page.(Redirect); !ok {
+		t.Errorf("Anyone needs to be allowed without logging in; got: %#v", page)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	testcase := []struct {
+		user               *User
+		canEdit, canDelete bool
+	}{
+		{nil, false, false},
+		{&User{Role: ViewerRole}, false, false},
+		{&User{Role: EditorRole}, true, false},
+		{&User{Role: AdminRole}, true, true},
+	}
+
+	for _, row := range testcase {
+		r := MustRequest(t, "GET", "/", nil)
+		if row.user != nil {
+			r = withUser(r, row.user)
+		}
+
+		p := permissionsOf(r)
+		if p.CanEdit() != row.canEdit || p.CanDelete() != row.canDelete {
+			t.Errorf("User %#v: CanEdit() = %v, CanDelete() = %v, wanted: %v, %v",
+				row.user, p.CanEdit(), p.CanDelete(), row.canEdit, row.canDelete)
+		}
+	}
+}
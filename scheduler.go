@@ -0,0 +1,404 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"gopkg.in/pg.v4"
+)
+
+const (
+	// DefaultCheckInterval is the time between two checks
+	// of the same monitor.
+	DefaultCheckInterval = 60 * time.Second
+
+	// DefaultMaxConcurrentChecks is the maximum number of checks
+	// that may run at the same time.
+	DefaultMaxConcurrentChecks = 10
+
+	// DefaultRefreshInterval is the interval in which the
+	// scheduler reloads all monitors from the database.
+	DefaultRefreshInterval = 30 * time.Second
+
+	// schedulerTick is the resolution of the scheduler.
+	schedulerTick = time.Second
+)
+
+// MonitorStatus is a monitor along with the latest event
+// that has been logged for it.
+type MonitorStatus struct {
+	Id       int
+	Name     string
+	Type     string
+	Event    EventType
+	Settings MonitorSettings
+}
+
+// Monitor returns the monitor the status belongs to.
+func (s MonitorStatus) Monitor() Monitor {
+	return Monitor{Id: s.Id, Name: s.Name, Type: s.Type, Settings: s.Settings}
+}
+
+// Paused is true if the monitor should not be checked.
+func (s MonitorStatus) Paused() bool {
+	return s.Event == MonitorPausedEvent
+}
+
+// transitionEvent returns the event that needs to be logged if a
+// check with the given result finishes while last is the latest
+// event of the monitor. If nothing needs to be logged (because
+// the state did not change or the monitor has been paused in the
+// meantime), ok is false.
+func transitionEvent(last EventType, result CheckResult) (e EventType, ok bool) {
+	e = result.Event()
+	return e, last != MonitorPausedEvent && last != e
+}
+
+// checkInterval returns the time between two checks of m.
+func checkInterval(m Monitor) time.Duration {
+	return m.Settings.IntervalDuration()
+}
+
+// loadMonitorStatuses loads every monitor with its latest event.
+func loadMonitorStatuses() ([]MonitorStatus, error) {
+	statuses := []MonitorStatus{}
+	err := joinLatestLog(db.Model(&Monitor{}).Alias("m").
+		Column("m.name", "m.type", "m.id", "m.settings", "l1.event")).
+		Order("m.id ASC").
+		Select(&statuses)
+
+	return statuses, err
+}
+
+// recordCheckResult logs the result if (and only if) the state of the
+// monitor changed. The monitor's row is locked while doing so, so that
+// pausing the monitor at the same time cannot get lost.
+func recordCheckResult(monitorID int, result CheckResult) (EventType, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("SELECT id FROM monitors WHERE id = ? FOR UPDATE", monitorID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	last := MonitorLog{}
+	err = tx.Model(&last).Where("monitor_id = ?", monitorID).
+		Order("date DESC, id DESC").Limit(1).Select()
+	if err != nil && err != pg.ErrNoRows {
+		return 0, false, err
+	}
+
+	event, ok := transitionEvent(last.Event, result)
+	if !ok {
+		return event, false, nil
+	}
+
+	entry := MonitorLog{
+		Event:     event,
+		Date:      time.Now(),
+		MonitorId: monitorID,
+		Reason:    result.Reason,
+	}
+	if err := tx.Create(&entry); err != nil {
+		return event, false, err
+	}
+
+	if err := updateIncident(tx, entry); err != nil {
+		return event, false, err
+	}
+
+	return event, true, tx.Commit()
+}
+
+// setMonitorPaused logs a paused event (or a started event if paused
+// is false) unless the monitor already is in that state. ok is false
+// if nothing has been logged. If the monitor does not exist,
+// pg.ErrNoRows is returned.
+func setMonitorPaused(monitorID int, paused bool) (ok bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecOne("SELECT id FROM monitors WHERE id = ? FOR UPDATE", monitorID)
+	if err != nil {
+		return false, err
+	}
+
+	last := MonitorLog{}
+	err = tx.Model(&last).Where("monitor_id = ?", monitorID).
+		Order("date DESC, id DESC").Limit(1).Select()
+	if err != nil && err != pg.ErrNoRows {
+		return false, err
+	}
+
+	event := MonitorStartedEvent
+	if paused {
+		event = MonitorPausedEvent
+	}
+
+	if (last.Event == MonitorPausedEvent) == paused {
+		return false, nil
+	}
+
+	entry := MonitorLog{Event: event, Date: time.Now(), MonitorId: monitorID}
+	if err := tx.Create(&entry); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Scheduler periodically checks every monitor that has not been
+// paused and logs an event whenever a monitor changes its state.
+type Scheduler struct {
+	// Check runs a single check. An error means that the check
+	// could not be run at all (not that the server is down).
+	Check func(Monitor) (CheckResult, error)
+
+	// Load returns all monitors along with their latest event.
+	Load func() ([]MonitorStatus, error)
+
+	// Record logs the result if the monitor changed its state.
+	// It returns the logged event and whether one has been logged.
+	Record func(monitorID int, result CheckResult) (EventType, bool, error)
+
+	// Store is called with the result of every check (whether
+	// the state changed or not). It may be nil.
+	Store func(MonitorCheck)
+
+	// Notify is called whenever a monitor went down or came back
+	// up after being down (see isNotified). It may be nil.
+	Notify func(Notification)
+
+	// MaxConcurrent is the maximum number of checks that may
+	// run at the same time.
+	MaxConcurrent int
+
+	// RefreshInterval is the interval in which monitors are
+	// reloaded (to pick up new and paused monitors).
+	RefreshInterval time.Duration
+
+	// Tick is the resolution of the scheduler.
+	Tick time.Duration
+
+	stop   chan struct{}
+	done   chan struct{}
+	reload chan struct{}
+}
+
+// NewScheduler creates a scheduler that checks the monitors
+// stored in the database.
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		Check:           checkMonitor,
+		Load:            loadMonitorStatuses,
+		Record:          recordCheckResult,
+		MaxConcurrent:   DefaultMaxConcurrentChecks,
+		RefreshInterval: DefaultRefreshInterval,
+		Tick:            schedulerTick,
+	}
+}
+
+// scheduledMonitor is the state the scheduler keeps for
+// every monitor.
+type scheduledMonitor struct {
+	status MonitorStatus
+	next   time.Time
+}
+
+// checkOutcome is sent back to the scheduler after a
+// check has finished.
+type checkOutcome struct {
+	status  MonitorStatus
+	started time.Time
+	result  CheckResult
+	err     error
+}
+
+// Start starts checking monitors in the background.
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.reload = make(chan struct{}, 1)
+	go s.run()
+}
+
+// Refresh makes the scheduler reload the monitors right away
+// instead of waiting for RefreshInterval. It does not block.
+func (s *Scheduler) Refresh() {
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops the scheduler and waits until all running
+// checks have finished.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+
+	monitors := map[int]*scheduledMonitor{}
+	outcomes := make(chan checkOutcome)
+	slots := make(chan struct{}, s.MaxConcurrent)
+
+	// running contains the ids of the monitors that are being
+	// checked. It is kept across refreshes, so a monitor that is
+	// removed and added again during its check isn't checked twice.
+	running := map[int]bool{}
+
+	ticker := time.NewTicker(s.Tick)
+	defer ticker.Stop()
+
+	s.refresh(monitors, time.Now())
+	lastRefresh := time.Now()
+	s.dispatch(monitors, slots, outcomes, running, time.Now())
+
+	for {
+		select {
+		case <-s.stop:
+			for len(running) > 0 {
+				s.handle(monitors, running, <-outcomes)
+			}
+			return
+
+		case outcome := <-outcomes:
+			s.handle(monitors, running, outcome)
+
+		case <-s.reload:
+			now := time.Now()
+			s.refresh(monitors, now)
+			lastRefresh = now
+			s.dispatch(monitors, slots, outcomes, running, now)
+
+		case now := <-ticker.C:
+			if now.Sub(lastRefresh) >= s.RefreshInterval {
+				s.refresh(monitors, now)
+				lastRefresh = now
+			}
+
+			s.dispatch(monitors, slots, outcomes, running, now)
+		}
+	}
+}
+
+// refresh reloads the monitors. New monitors are checked right away,
+// paused or deleted monitors are removed.
+func (s *Scheduler) refresh(monitors map[int]*scheduledMonitor, now time.Time) {
+	statuses, err := s.Load()
+	if err != nil {
+		log.Printf("Scheduler: could not load monitors: %v", err)
+		return
+	}
+
+	seen := map[int]bool{}
+	for _, status := range statuses {
+		if status.Paused() {
+			continue
+		}
+
+		seen[status.Id] = true
+		if m, ok := monitors[status.Id]; ok {
+			m.status = status
+		} else {
+			monitors[status.Id] = &scheduledMonitor{status: status, next: now}
+		}
+	}
+
+	for id := range monitors {
+		if !seen[id] {
+			delete(monitors, id)
+		}
+	}
+}
+
+// dispatch starts a check for every monitor that is due as long as
+// there is a free slot. Monitors that could not be started will be
+// started with one of the next ticks.
+func (s *Scheduler) dispatch(monitors map[int]*scheduledMonitor, slots chan struct{}, outcomes chan<- checkOutcome, running map[int]bool, now time.Time) {
+	for id, m := range monitors {
+		if running[id] || now.Before(m.next) {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			return
+		}
+
+		running[id] = true
+		go func(status MonitorStatus) {
+			defer func() { <-slots }()
+			started := time.Now()
+			result, err := s.Check(status.Monitor())
+			outcomes <- checkOutcome{status, started, result, err}
+		}(m.status)
+	}
+}
+
+// handle records the outcome of a check and schedules the next one.
+func (s *Scheduler) handle(monitors map[int]*scheduledMonitor, running map[int]bool, outcome checkOutcome) {
+	status := outcome.status
+	delete(running, status.Id)
+	m, ok := monitors[status.Id]
+	if ok {
+		m.next = time.Now().Add(checkInterval(status.Monitor()))
+	}
+
+	if outcome.err != nil {
+		log.Printf("Scheduler: could not check monitor %d (%q): %v",
+			status.Id, status.Name, outcome.err)
+		return
+	}
+
+	// The monitor has been paused or deleted while it was checked.
+	if !ok {
+		return
+	}
+
+	if s.Store != nil {
+		s.Store(MonitorCheck{
+			MonitorId: status.Id,
+			Date:      outcome.started,
+			Duration:  outcome.result.Duration,
+			Up:        outcome.result.Up,
+			Reason:    outcome.result.Reason,
+		})
+	}
+
+	event, logged, err := s.Record(status.Id, outcome.result)
+	if err != nil {
+		log.Printf("Scheduler: could not record result of monitor %d: %v",
+			status.Id, err)
+		return
+	}
+
+	if !logged {
+		return
+	}
+
+	last := m.status.Event
+	m.status.Event = event
+	log.Printf("Scheduler: monitor %d (%q): %v (%v)",
+		status.Id, status.Name, event.FullName(), outcome.result.Reason)
+
+	if s.Notify != nil && isNotified(last, event) {
+		s.Notify(Notification{
+			Monitor: status.Monitor(),
+			Event:   event,
+			Date:    time.Now(),
+			Reason:  outcome.result.Reason,
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransitionEvent(t *testing.T) {
+	testcase := []struct {
+		last     EventType
+		up       bool
+		expected EventType
+		ok       bool
+	}{
+		{MonitorCreatedEvent, true, MonitorUpEvent, true},
+		{MonitorStartedEvent, false, MonitorDownEvent, true},
+		{MonitorUpEvent, true, MonitorUpEvent, false},
+		{MonitorUpEvent, false, MonitorDownEvent, true},
+		{MonitorDownEvent, false, MonitorDownEvent, false},
+		{MonitorDownEvent, true, MonitorUpEvent, true},
+		{MonitorPausedEvent, true, MonitorUpEvent, false},
+		{MonitorPausedEvent, false, MonitorDownEvent, false},
+	}
+
+	msg := "transitionEvent(%v, up=%v) => (%v, %v), wanted: (%v, %v)"
+	for _, row := range testcase {
+		e, ok := transitionEvent(row.last, CheckResult{Up: row.up})
+		if e != row.expected || ok != row.ok {
+			t.Errorf(msg, row.last, row.up, e, ok, row.expected, row.ok)
+		}
+	}
+}
+
+// fakeScheduler records every call made by a Scheduler.
+type fakeScheduler struct {
+	sync.Mutex
+	statuses []MonitorStatus
+	checked  map[int]int
+	recorded map[int]CheckResult
+	stored   []MonitorCheck
+	notified []Notification
+	running  int
+	maxSeen  int
+}
+
+func newFakeScheduler(statuses ...MonitorStatus) (*fakeScheduler, *Scheduler) {
+	f := &fakeScheduler{
+		statuses: statuses,
+		checked:  map[int]int{},
+		recorded: map[int]CheckResult{},
+	}
+
+	s := &Scheduler{
+		Check:           f.check,
+		Load:            f.load,
+		Record:          f.record,
+		Store:           f.store,
+		Notify:          f.notify,
+		MaxConcurrent:   2,
+		RefreshInterval: time.Hour,
+		Tick:            time.Millisecond,
+	}
+
+	return f, s
+}
+
+func (f *fakeScheduler) load() ([]MonitorStatus, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.statuses, nil
+}
+
+func (f *fakeScheduler) check(m Monitor) (CheckResult, error) {
+	f.Lock()
+	f.running++
+	if f.running > f.maxSeen {
+		f.maxSeen = f.running
+	}
+	f.checked[m.Id]++
+	f.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	f.Lock()
+	f.running--
+	f.Unlock()
+
+	if m.Id == 4 {
+		return CheckResult{}, errors.New("no checker")
+	}
+
+	return CheckResult{Up: m.Id%2 == 0, Reason: m.Name}, nil
+}
+
+func (f *fakeScheduler) record(id int, r CheckResult) (EventType, bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.recorded[id] = r
+	return r.Event(), true, nil
+}
+
+func (f *fakeScheduler) store(check MonitorCheck) {
+	f.Lock()
+	defer f.Unlock()
+	f.stored = append(f.stored, check)
+}
+
+func (f *fakeScheduler) notify(n Notification) {
+	f.Lock()
+	defer f.Unlock()
+	f.notified = append(f.notified, n)
+}
+
+func TestScheduler(t *testing.T) {
+	defer shutupLog()()
+	f, s := newFakeScheduler(
+		MonitorStatus{1, "one", "ping", MonitorUpEvent, MonitorSettings{}},
+		MonitorStatus{2, "two", "http", MonitorDownEvent, MonitorSettings{}},
+		MonitorStatus{3, "three", "http", MonitorPausedEvent, MonitorSettings{}},
+		MonitorStatus{4, "four", "ping", MonitorStartedEvent, MonitorSettings{}},
+		MonitorStatus{5, "five", "socket", MonitorCreatedEvent, MonitorSettings{}},
+	)
+
+	s.Start()
+	time.Sleep(50 * time.Millisecond)
+	s.Stop()
+
+	f.Lock()
+	defer f.Unlock()
+
+	for _, id := range []int{1, 2, 4, 5} {
+		if f.checked[id] != 1 {
+			t.Errorf("Monitor %d checked %d times, wanted: 1", id, f.checked[id])
+		}
+	}
+
+	if n := f.checked[3]; n != 0 {
+		t.Errorf("Paused monitor has been checked %d times", n)
+	}
+
+	if f.maxSeen > s.MaxConcurrent {
+		msg := "%d checks were running at the same time, wanted at most %d"
+		t.Errorf(msg, f.maxSeen, s.MaxConcurrent)
+	}
+
+	if _, ok := f.recorded[4]; ok {
+		t.Errorf("Result of a failed check has been recorded")
+	}
+
+	if len(f.stored) != 3 {
+		t.Errorf("%d checks have been stored, wanted: 3", len(f.stored))
+	}
+
+	for _, check := range f.stored {
+		if check.Date.IsZero() || check.Up != f.recorded[check.MonitorId].Up {
+			t.Errorf("Unexpected check has been stored: %#v", check)
+		}
+	}
+
+	expected := map[int]bool{1: false, 2: true, 5: false}
+	for id, up := range expected {
+		r, ok := f.recorded[id]
+		if !ok {
+			t.Errorf("Result of monitor %d has not been recorded", id)
+		} else if r.Up != up {
+			t.Errorf("Monitor %d recorded as up=%v, wanted: %v", id, r.Up, up)
+		}
+	}
+}
+
+func TestSchedulerStopWaitsForChecks(t *testing.T) {
+	defer shutupLog()()
+	f, s := newFakeScheduler(MonitorStatus{2, "two", "http", MonitorUpEvent, MonitorSettings{}})
+	s.Start()
+
+	// Wait until the check is running.
+	for i := 0; i < 100; i++ {
+		f.Lock()
+		n := f.checked[2]
+		f.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	s.Stop()
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.recorded[2]; !ok {
+		t.Errorf("Stop returned before the running check has been recorded")
+	}
+}
+
+func TestSchedulerRefresh(t *testing.T) {
+	_, s := newFakeScheduler(
+		MonitorStatus{1, "one", "ping", MonitorUpEvent, MonitorSettings{}},
+		MonitorStatus{2, "two", "ping", MonitorPausedEvent, MonitorSettings{}},
+	)
+
+	monitors := map[int]*scheduledMonitor{
+		2: {status: MonitorStatus{2, "two", "ping", MonitorUpEvent, MonitorSettings{}}},
+		3: {status: MonitorStatus{3, "three", "ping", MonitorUpEvent, MonitorSettings{}}},
+	}
+
+	now := time.Now()
+	s.refresh(monitors, now)
+	if len(monitors) != 1 {
+		t.Fatalf("Wanted 1 monitor to be scheduled, got: %d", len(monitors))
+	}
+
+	m, ok := monitors[1]
+	if !ok {
+		t.Fatalf("Monitor 1 has not been scheduled")
+	}
+
+	if !m.next.Equal(now) {
+		t.Errorf("New monitor scheduled for %v, wanted: %v", m.next, now)
+	}
+}
+
+func TestSchedulerRefreshWhileChecking(t *testing.T) {
+	defer shutupLog()()
+	f, s := newFakeScheduler(MonitorStatus{1, "one", "ping", MonitorUpEvent, MonitorSettings{}})
+	release := make(chan struct{})
+	s.Check = func(Monitor) (CheckResult, error) {
+		<-release
+		return CheckResult{Up: true}, nil
+	}
+
+	monitors := map[int]*scheduledMonitor{}
+	running := map[int]bool{}
+	slots := make(chan struct{}, s.MaxConcurrent)
+	outcomes := make(chan checkOutcome)
+
+	now := time.Now()
+	s.refresh(monitors, now)
+	s.dispatch(monitors, slots, outcomes, running, now)
+
+	// The monitor is paused and resumed while it is checked.
+	f.statuses = []MonitorStatus{{1, "one", "ping", MonitorPausedEvent, MonitorSettings{}}}
+	s.refresh(monitors, now)
+	f.statuses = []MonitorStatus{{1, "one", "ping", MonitorStartedEvent, MonitorSettings{}}}
+	s.refresh(monitors, now)
+	s.dispatch(monitors, slots, outcomes, running, now)
+
+	if n := len(slots); n != 1 {
+		t.Errorf("%d checks are running, wanted: 1", n)
+	}
+
+	close(release)
+	for len(running) > 0 {
+		s.handle(monitors, running, <-outcomes)
+	}
+
+	if m := monitors[1]; !m.next.After(now) {
+		t.Errorf("Next check scheduled for %v, wanted after %v", m.next, now)
+	}
+}
+
+func TestSchedulerNotify(t *testing.T) {
+	defer shutupLog()()
+	f, s := newFakeScheduler(
+		MonitorStatus{1, "one", "ping", MonitorUpEvent, MonitorSettings{}},
+		MonitorStatus{2, "two", "http", MonitorDownEvent, MonitorSettings{}},
+		MonitorStatus{6, "six", "http", MonitorStartedEvent, MonitorSettings{}},
+	)
+
+	s.Start()
+	time.Sleep(50 * time.Millisecond)
+	s.Stop()
+
+	f.Lock()
+	defer f.Unlock()
+
+	// Monitor 6 came up after being resumed, which is not notified.
+	if len(f.notified) != 2 {
+		t.Fatalf("%d notifications have been sent, wanted: 2", len(f.notified))
+	}
+
+	expected := map[int]EventType{1: MonitorDownEvent, 2: MonitorUpEvent}
+	for _, n := range f.notified {
+		if n.Event != expected[n.Monitor.Id] {
+			t.Errorf("Monitor %d notified about %v, wanted: %v",
+				n.Monitor.Id, n.Event, expected[n.Monitor.Id])
+		}
+
+		if n.Date.IsZero() || n.Reason != n.Monitor.Name {
+			t.Errorf("Unexpected notification: %#v", n)
+		}
+	}
+}
+
+func TestSchedulerRefreshNow(t *testing.T) {
+	defer shutupLog()()
+	f, s := newFakeScheduler(
+		MonitorStatus{1, "one", "ping", MonitorPausedEvent, MonitorSettings{}},
+	)
+
+	s.Start()
+	defer s.Stop()
+	time.Sleep(10 * time.Millisecond)
+
+	f.Lock()
+	f.statuses = []MonitorStatus{
+		{1, "one", "ping", MonitorStartedEvent, MonitorSettings{}},
+	}
+	f.Unlock()
+
+	// RefreshInterval is an hour, so the monitor is only
+	// checked if Refresh reloads the monitors.
+	s.Refresh()
+	for i := 0; i < 100; i++ {
+		f.Lock()
+		n := f.checked[1]
+		f.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Errorf("The resumed monitor has not been checked after Refresh")
+}
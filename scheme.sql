@@ -2,25 +2,125 @@ BEGIN;
 
 DROP TABLE IF EXISTS monitors CASCADE;
 DROP TABLE IF EXISTS monitor_logs CASCADE;
+DROP TABLE IF EXISTS monitor_checks CASCADE;
+DROP TABLE IF EXISTS api_tokens CASCADE;
+DROP TABLE IF EXISTS users CASCADE;
+DROP TABLE IF EXISTS sessions CASCADE;
+DROP TABLE IF EXISTS notification_deliveries CASCADE;
+DROP TABLE IF EXISTS notification_channels CASCADE;
+DROP TABLE IF EXISTS incidents CASCADE;
+DROP TABLE IF EXISTS incident_notes CASCADE;
 
 CREATE TABLE monitors (
     id serial PRIMARY KEY,
     name text NOT NULL,
-    type text NOT NULL
+    type text NOT NULL,
+    settings jsonb
 );
 
 CREATE TABLE monitor_logs (
     id serial PRIMARY KEY,
     date timestamp with time zone NOT NULL,
     event smallint NOT NULL,
-	monitor_id integer  REFERENCES monitors(id) ON DELETE CASCADE
+	monitor_id integer  REFERENCES monitors(id) ON DELETE CASCADE,
+	reason text
 );
 
-INSERT INTO monitors (name, type) VALUES 
-	('TCP/UDP Socket', 'socket'),
-	('HTTP(s) Server', 'http'),
-	('Main Server', 'ping'),
-	('Down server', 'ping');
+-- Every single check. duration is in nanoseconds.
+CREATE TABLE monitor_checks (
+    id bigserial PRIMARY KEY,
+    monitor_id integer NOT NULL REFERENCES monitors(id) ON DELETE CASCADE,
+    date timestamp with time zone NOT NULL,
+    duration bigint NOT NULL,
+    up boolean NOT NULL,
+    reason text
+);
+
+CREATE INDEX monitor_checks_monitor_id_date ON monitor_checks (monitor_id, date);
+
+-- Tokens of the JSON API. hash is the hex encoded SHA-256 of the token.
+-- last_used is NULL if the token has never been used.
+CREATE TABLE api_tokens (
+    id serial PRIMARY KEY,
+    name text NOT NULL,
+    hash text NOT NULL UNIQUE,
+    scope text NOT NULL CHECK (scope IN ('read-only', 'read-write')),
+    created timestamp with time zone NOT NULL,
+    last_used timestamp with time zone
+);
+
+-- Accounts of the web interface. password_hash is a bcrypt hash.
+CREATE TABLE users (
+    id serial PRIMARY KEY,
+    name text NOT NULL UNIQUE,
+    role text NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+    password_hash text NOT NULL,
+    created timestamp with time zone NOT NULL
+);
+
+-- hash is the hex encoded SHA-256 of the token in the cookie.
+CREATE TABLE sessions (
+    id serial PRIMARY KEY,
+    hash text NOT NULL UNIQUE,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created timestamp with time zone NOT NULL,
+    expires timestamp with time zone NOT NULL
+);
+
+-- settings are the type-specific settings (see NotifierType).
+-- Monitors link to channels by the channel_ids in their settings.
+CREATE TABLE notification_channels (
+    id serial PRIMARY KEY,
+    name text NOT NULL UNIQUE,
+    type text NOT NULL,
+    settings jsonb NOT NULL,
+    created timestamp with time zone NOT NULL
+);
+
+-- Every notification sent to a channel. error is NULL if it
+-- has been delivered.
+CREATE TABLE notification_deliveries (
+    id bigserial PRIMARY KEY,
+    monitor_id integer NOT NULL REFERENCES monitors(id) ON DELETE CASCADE,
+    channel text NOT NULL,
+    type text NOT NULL,
+    event smallint NOT NULL,
+    date timestamp with time zone NOT NULL,
+    error text
+);
+
+CREATE INDEX notification_deliveries_monitor_id_date ON notification_deliveries (monitor_id, date);
+
+-- An incident is opened when a monitor goes down. resolved is NULL
+-- while the monitor is down; acknowledged is NULL until someone
+-- acknowledges the incident.
+CREATE TABLE incidents (
+    id serial PRIMARY KEY,
+    monitor_id integer NOT NULL REFERENCES monitors(id) ON DELETE CASCADE,
+    started timestamp with time zone NOT NULL,
+    resolved timestamp with time zone,
+    reason text,
+    acknowledged timestamp with time zone,
+    acknowledged_by text,
+    assignee text,
+    resolution text
+);
+
+CREATE INDEX incidents_monitor_id_started ON incidents (monitor_id, started);
+
+CREATE TABLE incident_notes (
+    id serial PRIMARY KEY,
+    incident_id integer NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    author text,
+    date timestamp with time zone NOT NULL,
+    text text NOT NULL
+);
+
+INSERT INTO monitors (name, type, settings) VALUES 
+	('TCP/UDP Socket', 'socket', '{"version": 1, "target": "localhost:22"}'),
+	('HTTP(s) Server', 'http', '{"version": 1, "target": "http://localhost:8092/"}'),
+	('Main Server', 'ping', '{"version": 1, "target": "127.0.0.1"}'),
+	('Down server', 'ping', '{"version": 1, "target": "192.0.2.1"}');
 
 INSERT INTO monitor_logs (date, event, monitor_id) VALUES
 	('2016-05-21 21:23:12 Europe/Berlin', 0, 1),
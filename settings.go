@@ -0,0 +1,408 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/pg.v4"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	tokenSettingsTmpl = MustTemplate(NewTemplate("settings/tokens.html"))
+
+	errTokenNotFound = StatusError{
+		Status:  http.StatusNotFound,
+		Message: "API token could not be found",
+	}
+)
+
+// TokenSettings is passed to the template managing the API tokens.
+type TokenSettings struct {
+	Tokens []APIToken
+	Scopes []TokenScope
+
+	// NewToken is the token that has just been created. It is
+	// shown only once since only its hash is stored.
+	NewToken string
+
+	// Name, Scope and Err belong to the form creating a token.
+	Name  string
+	Scope TokenScope
+	Err   string
+}
+
+// tokenSettingsPage loads all tokens and shows them along with
+// the form in settings.
+func tokenSettingsPage(settings TokenSettings) Page {
+	settings.Tokens = []APIToken{}
+	settings.Scopes = TokenScopes
+	if settings.Scope == "" {
+		settings.Scope = ReadOnlyScope
+	}
+
+	err := db.Model(&settings.Tokens).Order("created ASC, id ASC").Select()
+	return defaultTW.SetTemplate(tokenSettingsTmpl).SetTmplArgs(settings).
+		SetError(NewDatabaseError(err))
+}
+
+func tokenSettingsGetHandler(_ *http.Request, _ httprouter.Params) Page {
+	return tokenSettingsPage(TokenSettings{})
+}
+
+// createTokenHandler creates a token and shows it (it cannot be
+// shown again later, so the user is not redirected).
+func createTokenHandler(r *http.Request, _ httprouter.Params) Page {
+	settings := TokenSettings{
+		Name:  strings.TrimSpace(r.PostFormValue("name")),
+		Scope: TokenScope(r.PostFormValue("scope")),
+	}
+
+	if settings.Name == "" {
+		settings.Err = "A name for the token is required."
+		return tokenSettingsPage(settings)
+	} else if !settings.Scope.Valid() {
+		settings.Err = "Please select a valid scope."
+		return tokenSettingsPage(settings)
+	}
+
+	token, plain, err := NewAPIToken(settings.Name, settings.Scope)
+	if err == nil {
+		err = db.Create(&token)
+	}
+
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	return tokenSettingsPage(TokenSettings{NewToken: plain})
+}
+
+// revokeTokenHandler deletes the token. Requests using it are
+// rejected immediately.
+func revokeTokenHandler(r *http.Request, params httprouter.Params) Page {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return defaultTW.SetError(errTokenNotFound)
+	}
+
+	res, err := db.Model(&APIToken{}).Where("id = ?", id).Delete()
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if res.Affected() == 0 {
+		return defaultTW.SetError(errTokenNotFound)
+	}
+
+	return Redirect{Location: "/settings/tokens/", Request: r, Status: http.StatusSeeOther}
+}
+
+var (
+	userSettingsTmpl = MustTemplate(NewTemplate("settings/users.html"))
+
+	errUserNotFound = StatusError{
+		Status:  http.StatusNotFound,
+		Message: "User could not be found",
+	}
+)
+
+// UserSettings is passed to the template managing the users.
+type UserSettings struct {
+	Users []User
+	Roles []Role
+
+	// CurrentUser is the user who is logged in (who cannot
+	// delete their own account or change their own role).
+	CurrentUser *User
+
+	// Name, Role and Err belong to the form creating a user.
+	Name string
+	Role Role
+	Err  string
+}
+
+// IsCurrentUser is true if u is the user who is logged in.
+func (s UserSettings) IsCurrentUser(u User) bool {
+	return s.CurrentUser != nil && s.CurrentUser.Id == u.Id
+}
+
+func userSettingsPage(r *http.Request, settings UserSettings) Page {
+	settings.Users = []User{}
+	settings.Roles = Roles
+	settings.CurrentUser = UserFromRequest(r)
+	if settings.Role == "" {
+		settings.Role = ViewerRole
+	}
+
+	err := db.Model(&settings.Users).Order("name ASC").Select()
+	return defaultTW.SetTemplate(userSettingsTmpl).SetTmplArgs(settings).
+		SetError(NewDatabaseError(err))
+}
+
+func userSettingsGetHandler(r *http.Request, _ httprouter.Params) Page {
+	return userSettingsPage(r, UserSettings{})
+}
+
+func createUserHandler(r *http.Request, _ httprouter.Params) Page {
+	settings := UserSettings{
+		Name: strings.TrimSpace(r.PostFormValue("name")),
+		Role: Role(r.PostFormValue("role")),
+	}
+
+	password := r.PostFormValue("password")
+	if settings.Name == "" {
+		settings.Err = "A name is required."
+	} else if !settings.Role.Valid() {
+		settings.Err = "Please select a valid role."
+	} else if err := validatePassword(password, r.PostFormValue("confirmation")); err != nil {
+		settings.Err = err.Error()
+	} else if n, err := db.Model(&User{}).Where("name = ?", settings.Name).Count(); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if n > 0 {
+		settings.Err = "There already is a user with that name."
+	}
+
+	if settings.Err != "" {
+		return userSettingsPage(r, settings)
+	}
+
+	user := User{Name: settings.Name, Role: settings.Role, Created: time.Now()}
+	err := user.SetPassword(password)
+	if err == nil {
+		err = db.Create(&user)
+	}
+
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	return Redirect{Location: "/settings/users/", Request: r, Status: http.StatusSeeOther}
+}
+
+// deleteUserHandler deletes the user (along with the user's
+// sessions). Users cannot delete themselves so that there
+// always is at least one user.
+func deleteUserHandler(r *http.Request, params httprouter.Params) Page {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return defaultTW.SetError(errUserNotFound)
+	}
+
+	if current := UserFromRequest(r); current != nil && current.Id == id {
+		return userSettingsPage(r, UserSettings{Err: "You cannot delete yourself."})
+	}
+
+	res, err := db.Model(&User{}).Where("id = ?", id).Delete()
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if res.Affected() == 0 {
+		return defaultTW.SetError(errUserNotFound)
+	}
+
+	return Redirect{Location: "/settings/users/", Request: r, Status: http.StatusSeeOther}
+}
+
+// changeRoleHandler changes the role of a user. Users cannot change
+// their own role so that there always is at least one admin.
+func changeRoleHandler(r *http.Request, params httprouter.Params) Page {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return defaultTW.SetError(errUserNotFound)
+	}
+
+	role := Role(r.PostFormValue("role"))
+	if current := UserFromRequest(r); current != nil && current.Id == id {
+		return userSettingsPage(r, UserSettings{Err: "You cannot change your own role."})
+	} else if !role.Valid() {
+		return userSettingsPage(r, UserSettings{Err: "Please select a valid role."})
+	}
+
+	res, err := db.Model(&User{}).Set("role = ?", role).Where("id = ?", id).Update()
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if res.Affected() == 0 {
+		return defaultTW.SetError(errUserNotFound)
+	}
+
+	return Redirect{Location: "/settings/users/", Request: r, Status: http.StatusSeeOther}
+}
+
+var (
+	notificationSettingsTmpl = MustTemplate(NewTemplate("settings/channels.html"))
+
+	errChannelNotFound = StatusError{
+		Status:  http.StatusNotFound,
+		Message: "Notification channel could not be found",
+	}
+)
+
+// NotificationSettings is passed to the template managing the
+// notification channels.
+type NotificationSettings struct {
+	Channels []NotificationChannel
+	Types    []NotifierType
+
+	// Message is shown after a test notification has been sent.
+	Message string
+
+	// Name, Type, Options and Err belong to the form creating
+	// a channel.
+	Name    string
+	Type    string
+	Options ChannelSettings
+	Err     string
+}
+
+// Option returns the value of the field of the type that is shown
+// in the form.
+func (s NotificationSettings) Option(typ string, field CheckerField) string {
+	if s.Type == typ {
+		if value, ok := s.Options[field.Name]; ok {
+			return value
+		}
+	}
+
+	if field.Kind == FieldSelect && len(field.Choices) > 0 {
+		return field.Choices[0]
+	}
+
+	return field.Default
+}
+
+func notificationSettingsPage(settings NotificationSettings) Page {
+	settings.Channels = []NotificationChannel{}
+	settings.Types = []NotifierType{}
+	for _, name := range SupportedNotifierTypes {
+		t, _ := LookupNotifierType(name)
+		settings.Types = append(settings.Types, t)
+	}
+
+	err := db.Model(&settings.Channels).Order("name ASC").Select()
+	return defaultTW.SetTemplate(notificationSettingsTmpl).SetTmplArgs(settings).
+		SetError(NewDatabaseError(err))
+}
+
+func notificationSettingsGetHandler(_ *http.Request, _ httprouter.Params) Page {
+	return notificationSettingsPage(NotificationSettings{})
+}
+
+// createChannelHandler creates a channel if its settings are valid.
+func createChannelHandler(r *http.Request, _ httprouter.Params) Page {
+	r.ParseForm()
+	settings := NotificationSettings{
+		Name: strings.TrimSpace(r.PostFormValue("name")),
+		Type: r.PostFormValue("type"),
+	}
+
+	t, typeOK := LookupNotifierType(settings.Type)
+	if typeOK {
+		settings.Options = parseFieldValues(r.PostForm, t.Name, t.Fields)
+	}
+
+	if settings.Name == "" {
+		settings.Err = "A name for the channel is required."
+	} else if !typeOK {
+		settings.Err = "Please select a valid type."
+	} else if _, err := t.New(CheckerConfig(settings.Options)); err != nil {
+		settings.Err = err.Error()
+	} else if n, err := db.Model(&NotificationChannel{}).Where("name = ?", settings.Name).Count(); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if n > 0 {
+		settings.Err = "There already is a channel with that name."
+	}
+
+	if settings.Err != "" {
+		return notificationSettingsPage(settings)
+	}
+
+	channel := NotificationChannel{
+		Name:     settings.Name,
+		Type:     settings.Type,
+		Settings: settings.Options,
+		Created:  time.Now(),
+	}
+
+	if err := db.Create(&channel); err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	}
+
+	return Redirect{Location: "/settings/channels/", Request: r, Status: http.StatusSeeOther}
+}
+
+// loadChannel loads the channel whose id is in params. The error
+// is errChannelNotFound if there is no such channel.
+func loadChannel(params httprouter.Params) (NotificationChannel, HTTPError) {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return NotificationChannel{}, errChannelNotFound
+	}
+
+	channel := NotificationChannel{Id: id}
+	if err := db.Select(&channel); err == pg.ErrNoRows {
+		return channel, errChannelNotFound
+	} else if err != nil {
+		return channel, NewDatabaseError(err)
+	}
+
+	return channel, nil
+}
+
+// newTestNotification returns the notification sent by
+// testChannelHandler.
+func newTestNotification() Notification {
+	return Notification{
+		Monitor: Monitor{
+			Name:     "Test",
+			Type:     "http",
+			Settings: MonitorSettings{Target: "https://example.com/"},
+		},
+		Event:  MonitorDownEvent,
+		Date:   time.Now(),
+		Reason: "This is a test notification.",
+	}
+}
+
+// testChannelHandler sends a test notification to the channel
+// (waiting for it to be delivered) and shows whether it has
+// been delivered. The notification is sent only once.
+func testChannelHandler(_ *http.Request, params httprouter.Params) Page {
+	channel, httpErr := loadChannel(params)
+	if httpErr != nil {
+		return defaultTW.SetError(httpErr)
+	}
+
+	notifier, err := NewNotifier(channel)
+	if err == nil {
+		err = sendTestNotification(notifier, newTestNotification())
+	}
+
+	if err != nil {
+		return notificationSettingsPage(NotificationSettings{
+			Err: "The test notification could not be sent to " + channel.Name + ": " + err.Error(),
+		})
+	}
+
+	return notificationSettingsPage(NotificationSettings{
+		Message: "A test notification has been sent to " + channel.Name + ".",
+	})
+}
+
+// deleteChannelHandler deletes the channel. Monitors linked to it
+// simply no longer notify it.
+func deleteChannelHandler(r *http.Request, params httprouter.Params) Page {
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return defaultTW.SetError(errChannelNotFound)
+	}
+
+	res, err := db.Model(&NotificationChannel{}).Where("id = ?", id).Delete()
+	if err != nil {
+		return defaultTW.SetError(NewDatabaseError(err))
+	} else if res.Affected() == 0 {
+		return defaultTW.SetError(errChannelNotFound)
+	}
+
+	return Redirect{Location: "/settings/channels/", Request: r, Status: http.StatusSeeOther}
+}
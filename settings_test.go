@@ -0,0 +1,230 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestCreateTokenHandlerErrors(t *testing.T) {
+	defer InitTestConnection(t)()
+	testcase := []struct {
+		form url.Values
+		err  string
+	}{
+		{url.Values{"name": {" "}, "scope": {"read-only"}}, "A name for the token is required."},
+		{url.Values{"name": {"CI"}, "scope": {"admin"}}, "Please select a valid scope."},
+	}
+
+	for _, row := range testcase {
+		tw := getTemplateWriter(t, createTokenHandler(postForm(t, row.form), nil))
+		settings := tw.TmplArgs.(TokenSettings)
+		if settings.Err != row.err || settings.NewToken != "" {
+			t.Errorf("Wanted error %q; got: %#v", row.err, settings)
+		}
+	}
+}
+
+func TestTokenSettingsHandlers(t *testing.T) {
+	defer InitTestConnection(t)()
+	form := url.Values{"name": {"CI"}, "scope": {"read-write"}}
+	tw := getTemplateWriter(t, createTokenHandler(postForm(t, form), nil))
+	if tw.Err != nil {
+		t.Fatalf("createTokenHandler returned an error: %v", tw.Err)
+	}
+
+	settings := tw.TmplArgs.(TokenSettings)
+	if len(settings.Tokens) != 1 || settings.NewToken == "" {
+		t.Fatalf("The token has not been created: %#v", settings)
+	}
+
+	token := settings.Tokens[0]
+	if token.Name != "CI" || token.Scope != ReadWriteScope ||
+		token.Hash != hashToken(settings.NewToken) {
+		t.Errorf("Unexpected token: %#v", token)
+	}
+
+	tw = getTemplateWriter(t, tokenSettingsGetHandler(nil, nil))
+	if s := tw.TmplArgs.(TokenSettings); len(s.Tokens) != 1 || s.NewToken != "" {
+		t.Errorf("Unexpected settings: %#v", s)
+	}
+
+	params := httprouter.Params{{Key: "id", Value: "1"}}
+	page := revokeTokenHandler(MustRequest(t, "POST", "", nil), params)
+	redirect, ok := page.(Redirect)
+	if !ok || redirect.Location != "/settings/tokens/" || redirect.Status != http.StatusSeeOther {
+		t.Errorf("Wanted a redirect to the settings, got: %#v", page)
+	}
+
+	tw = getTemplateWriter(t, revokeTokenHandler(MustRequest(t, "POST", "", nil), params))
+	if tw.Err != errTokenNotFound {
+		t.Errorf("Wanted errTokenNotFound; got: %v", tw.Err)
+	}
+}
+
+func TestUserSettingsHandlers(t *testing.T) {
+	defer InitTestConnection(t)()
+	alice := User{Name: "alice", Role: AdminRole, PasswordHash: "x", Created: time.Now()}
+	if err := db.Create(&alice); err != nil {
+		t.Fatal(err)
+	}
+
+	asAlice := func(r *http.Request) *http.Request {
+		return withUser(r, &alice)
+	}
+
+	testcase := []struct {
+		form url.Values
+		err  string
+	}{
+		{url.Values{"name": {""}}, "A name is required."},
+		{url.Values{"name": {"bob"}, "role": {"root"}}, "Please select a valid role."},
+		{url.Values{"name": {"bob"}, "role": {"editor"}, "password": {"1234"}, "confirmation": {"1234"}},
+			"The password needs to be at least 8 characters long."},
+		{url.Values{"name": {"alice"}, "role": {"editor"}, "password": {"12345678"}, "confirmation": {"12345678"}},
+			"There already is a user with that name."},
+	}
+
+	for _, row := range testcase {
+		tw := getTemplateWriter(t, createUserHandler(asAlice(postForm(t, row.form)), nil))
+		if s := tw.TmplArgs.(UserSettings); s.Err != row.err {
+			t.Errorf("Wanted error %q; got: %q", row.err, s.Err)
+		}
+	}
+
+	form := url.Values{"name": {"bob"}, "role": {"editor"}, "password": {"12345678"}, "confirmation": {"12345678"}}
+	page := createUserHandler(asAlice(postForm(t, form)), nil)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/settings/users/" {
+		t.Fatalf("Wanted a redirect to the settings, got: %#v", page)
+	}
+
+	bob := User{}
+	if err := db.Model(&bob).Where("name = ?", "bob").Select(); err != nil {
+		t.Fatalf("The user has not been created: %v", err)
+	} else if !bob.CheckPassword("12345678") || bob.Role != EditorRole {
+		t.Errorf("Unexpected user: %#v", bob)
+	}
+
+	tw := getTemplateWriter(t, userSettingsGetHandler(asAlice(MustRequest(t, "GET", "/", nil)), nil))
+	settings := tw.TmplArgs.(UserSettings)
+	if len(settings.Users) != 2 || !settings.IsCurrentUser(alice) || settings.IsCurrentUser(bob) {
+		t.Errorf("Unexpected settings: %#v", settings)
+	}
+
+	params := httprouter.Params{{Key: "id", Value: strconv.Itoa(alice.Id)}}
+	roleForm := url.Values{"role": {"viewer"}}
+	tw = getTemplateWriter(t, changeRoleHandler(asAlice(postForm(t, roleForm)), params))
+	if s := tw.TmplArgs.(UserSettings); s.Err != "You cannot change your own role." {
+		t.Errorf("Unexpected error: %q", s.Err)
+	}
+
+	tw = getTemplateWriter(t, deleteUserHandler(asAlice(MustRequest(t, "POST", "", nil)), params))
+	if s := tw.TmplArgs.(UserSettings); s.Err != "You cannot delete yourself." {
+		t.Errorf("Unexpected error: %q", s.Err)
+	}
+
+	params = httprouter.Params{{Key: "id", Value: strconv.Itoa(bob.Id)}}
+	page = changeRoleHandler(asAlice(postForm(t, roleForm)), params)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/settings/users/" {
+		t.Errorf("Wanted a redirect to the settings, got: %#v", page)
+	}
+
+	if err := db.Select(&bob); err != nil || bob.Role != ViewerRole {
+		t.Errorf("The role has not been changed: %#v, %v", bob, err)
+	}
+
+	roleForm.Set("role", "root")
+	tw = getTemplateWriter(t, changeRoleHandler(asAlice(postForm(t, roleForm)), params))
+	if s := tw.TmplArgs.(UserSettings); s.Err != "Please select a valid role." {
+		t.Errorf("Unexpected error: %q", s.Err)
+	}
+
+	page = deleteUserHandler(asAlice(MustRequest(t, "POST", "", nil)), params)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/settings/users/" {
+		t.Errorf("Wanted a redirect to the settings, got: %#v", page)
+	}
+
+	tw = getTemplateWriter(t, deleteUserHandler(asAlice(MustRequest(t, "POST", "", nil)), params))
+	if tw.Err != errUserNotFound {
+		t.Errorf("Wanted errUserNotFound; got: %v", tw.Err)
+	}
+}
+
+func TestNotificationSettingsHandlers(t *testing.T) {
+	defer InitTestConnection(t)()
+	testcase := []struct {
+		form url.Values
+		err  string
+	}{
+		{url.Values{"name": {" "}, "type": {"webhook"}}, "A name for the channel is required."},
+		{url.Values{"name": {"Ops"}, "type": {"pager"}}, "Please select a valid type."},
+		{url.Values{"name": {"Ops"}, "type": {"webhook"}, "webhook.url": {"https://example.com/"}},
+			`The setting "secret" is required`},
+	}
+
+	for _, row := range testcase {
+		tw := getTemplateWriter(t, createChannelHandler(postForm(t, row.form), nil))
+		if s := tw.TmplArgs.(NotificationSettings); s.Err != row.err {
+			t.Errorf("Wanted error %q; got: %q", row.err, s.Err)
+		}
+	}
+
+	server := newWebhookTestServer(http.StatusNoContent)
+	defer server.Close()
+
+	form := url.Values{
+		"name":           {"Ops"},
+		"type":           {"webhook"},
+		"webhook.url":    {server.URL},
+		"webhook.secret": {"secret"},
+		"email.host":     {"ignored"},
+	}
+	page := createChannelHandler(postForm(t, form), nil)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/settings/channels/" {
+		t.Fatalf("Wanted a redirect to the settings, got: %#v", page)
+	}
+
+	tw := getTemplateWriter(t, createChannelHandler(postForm(t, form), nil))
+	if s := tw.TmplArgs.(NotificationSettings); s.Err != "There already is a channel with that name." {
+		t.Errorf("Unexpected error: %q", s.Err)
+	}
+
+	tw = getTemplateWriter(t, notificationSettingsGetHandler(nil, nil))
+	settings := tw.TmplArgs.(NotificationSettings)
+	if len(settings.Channels) != 1 || len(settings.Types) != len(SupportedNotifierTypes) {
+		t.Fatalf("Unexpected settings: %#v", settings)
+	}
+
+	channel := settings.Channels[0]
+	expected := ChannelSettings{WebhookConfigURL: server.URL, WebhookConfigSecret: "secret"}
+	if channel.Type != "webhook" || !reflect.DeepEqual(channel.Settings, expected) {
+		t.Errorf("Unexpected channel: %#v", channel)
+	}
+
+	params := httprouter.Params{{Key: "id", Value: strconv.Itoa(channel.Id)}}
+	tw = getTemplateWriter(t, testChannelHandler(MustRequest(t, "POST", "", nil), params))
+	if s := tw.TmplArgs.(NotificationSettings); s.Err != "" || s.Message == "" {
+		t.Errorf("The test notification has not been sent: %#v", s)
+	}
+
+	server.Lock()
+	if len(server.requests) != 1 {
+		t.Errorf("%d requests have been made, wanted: 1", len(server.requests))
+	}
+	server.Unlock()
+
+	page = deleteChannelHandler(MustRequest(t, "POST", "", nil), params)
+	if redirect, ok := page.(Redirect); !ok || redirect.Location != "/settings/channels/" {
+		t.Errorf("Wanted a redirect to the settings, got: %#v", page)
+	}
+
+	tw = getTemplateWriter(t, testChannelHandler(MustRequest(t, "POST", "", nil), params))
+	if tw.Err != errChannelNotFound {
+		t.Errorf("Wanted errChannelNotFound; got: %v", tw.Err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/pg.v4"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// TokenScope limits what can be done with an API token.
+type TokenScope string
+
+const (
+	// ReadOnlyScope only allows safe requests (GET and HEAD).
+	ReadOnlyScope TokenScope = "read-only"
+
+	// ReadWriteScope allows every request.
+	ReadWriteScope TokenScope = "read-write"
+)
+
+// TokenScopes are all scopes that can be selected.
+var TokenScopes = []TokenScope{ReadOnlyScope, ReadWriteScope}
+
+// Valid is true if s is one of TokenScopes.
+func (s TokenScope) Valid() bool {
+	for _, scope := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows is true if requests with the method may be
+// made with the scope.
+func (s TokenScope) Allows(method string) bool {
+	switch s {
+	case ReadWriteScope:
+		return true
+	case ReadOnlyScope:
+		return method == "GET" || method == "HEAD"
+	default:
+		return false
+	}
+}
+
+// apiTokenPrefix is prepended to every token so that they are
+// easy to recognize (such as by secret scanners).
+const apiTokenPrefix = "upc_"
+
+// APIToken grants access to the API. Only the SHA-256 hash of the
+// token is stored, the token itself is shown once after creating it.
+type APIToken struct {
+	Id      int
+	Name    string
+	Hash    string
+	Scope   TokenScope
+	Created time.Time
+
+	// LastUsed is the zero time (NULL) if the token has never
+	// been used.
+	LastUsed time.Time `sql:",null"`
+}
+
+// hashToken returns the hash of a token (or a session) as stored
+// in the database.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns 32 random bytes encoded as base64 (and
+// prefixed by prefix).
+func randomToken(prefix string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return prefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// NewAPIToken generates a random token. The returned APIToken only
+// contains its hash, the token itself is returned separately.
+func NewAPIToken(name string, scope TokenScope) (APIToken, string, error) {
+	token, err := randomToken(apiTokenPrefix)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+
+	return APIToken{
+		Name:    name,
+		Hash:    hashToken(token),
+		Scope:   scope,
+		Created: time.Now(),
+	}, token, nil
+}
+
+// bearerToken returns the token of the Authorization header
+// ("Bearer <token>") or an empty string.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+// findAPIToken looks up the token by its hash and records that
+// it has been used.
+func findAPIToken(hash string) (APIToken, error) {
+	token := APIToken{}
+	if err := db.Model(&token).Where("hash = ?", hash).Select(); err != nil {
+		return token, err
+	}
+
+	_, err := db.Model(&APIToken{}).Set("last_used = ?", time.Now()).
+		Where("id = ?", token.Id).Update()
+	if err != nil {
+		log.Printf("Could not update last use of token %d: %v", token.Id, err)
+	}
+
+	return token, nil
+}
+
+var (
+	errTokenMissing = NewAPIError(http.StatusUnauthorized,
+		"An API token is required (Authorization: Bearer <token>).")
+	errTokenInvalid = NewAPIError(http.StatusUnauthorized,
+		"The API token is invalid or has been revoked.")
+	errTokenScope = NewAPIError(http.StatusForbidden,
+		"The API token is read-only.")
+)
+
+// TokenFromRequest returns the API token the request has been
+// authenticated with (or nil if it has none).
+func TokenFromRequest(r *http.Request) *APIToken {
+	token, _ := r.Context().Value(tokenContextKey).(*APIToken)
+	return token
+}
+
+// withToken returns a copy of r authenticated with token.
+func withToken(r *http.Request, token *APIToken) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), tokenContextKey, token))
+}
+
+// TokenAuthenticator only lets requests with a valid API token
+// through (see Middleware).
+type TokenAuthenticator struct {
+	// Find returns the token with the hash. pg.ErrNoRows means
+	// that there is no such token.
+	Find func(hash string) (APIToken, error)
+}
+
+// NewTokenAuthenticator returns an authenticator that looks
+// up the tokens in the database.
+func NewTokenAuthenticator() TokenAuthenticator {
+	return TokenAuthenticator{Find: findAPIToken}
+}
+
+// Middleware wraps h so that it is only called if the request has
+// a valid token whose scope allows the request's method.
+func (a TokenAuthenticator) Middleware(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		var errPage JSONPage
+		if plain := bearerToken(r); plain == "" {
+			errPage = errTokenMissing
+		} else if token, err := a.Find(hashToken(plain)); err == pg.ErrNoRows {
+			errPage = errTokenInvalid
+		} else if err != nil {
+			errPage = apiErrorPage(NewDatabaseError(err))
+		} else if !token.Scope.Allows(r.Method) {
+			errPage = errTokenScope
+		} else {
+			h(w, withToken(r, &token), p)
+			return
+		}
+
+		if errPage.Status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Upchecker"`)
+		}
+
+		errPage.Execute(w)
+	}
+}
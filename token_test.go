@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/pg.v4"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestTokenScope(t *testing.T) {
+	testcase := []struct {
+		scope   TokenScope
+		method  string
+		allowed bool
+	}{
+		{ReadOnlyScope, "GET", true},
+		{ReadOnlyScope, "HEAD", true},
+		{ReadOnlyScope, "POST", false},
+		{ReadOnlyScope, "DELETE", false},
+		{ReadWriteScope, "GET", true},
+		{ReadWriteScope, "PUT", true},
+		{TokenScope("admin"), "GET", false},
+	}
+
+	for _, row := range testcase {
+		if a := row.scope.Allows(row.method); a != row.allowed {
+			t.Errorf("%v.Allows(%v) => %v, wanted: %v", row.scope, row.method, a, row.allowed)
+		}
+	}
+
+	if !ReadOnlyScope.Valid() || !ReadWriteScope.Valid() || TokenScope("").Valid() {
+		t.Errorf("TokenScope.Valid does not match TokenScopes")
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	token, plain, err := NewAPIToken("Deployment", ReadWriteScope)
+	if err != nil {
+		t.Fatalf("NewAPIToken returned an error: %v", err)
+	}
+
+	if !strings.HasPrefix(plain, apiTokenPrefix) || len(plain) < 40 {
+		t.Errorf("Unexpected token: %q", plain)
+	}
+
+	if token.Hash != hashToken(plain) || strings.Contains(token.Hash, plain) {
+		t.Errorf("The token's hash does not match: %q", token.Hash)
+	}
+
+	if token.Name != "Deployment" || token.Scope != ReadWriteScope || token.Created.IsZero() {
+		t.Errorf("Unexpected token: %#v", token)
+	}
+
+	_, other, _ := NewAPIToken("Deployment", ReadWriteScope)
+	if other == plain {
+		t.Errorf("NewAPIToken returned the same token twice")
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	testcase := []struct {
+		header, expected string
+	}{
+		{"Bearer abc", "abc"},
+		{"bearer  abc ", "abc"},
+		{"Bearer ", ""},
+		{"Basic YWJjOmRlZg==", ""},
+		{"", ""},
+	}
+
+	for _, row := range testcase {
+		r := MustRequest(t, "GET", "/", nil)
+		r.Header.Set("Authorization", row.header)
+		if token := bearerToken(r); token != row.expected {
+			t.Errorf("bearerToken(%q) => %q, wanted: %q", row.header, token, row.expected)
+		}
+	}
+}
+
+func TestTokenAuthenticatorMiddleware(t *testing.T) {
+	tokens := map[string]APIToken{
+		hashToken("read"):  {Id: 1, Scope: ReadOnlyScope},
+		hashToken("write"): {Id: 2, Scope: ReadWriteScope},
+	}
+
+	auth := TokenAuthenticator{Find: func(hash string) (APIToken, error) {
+		if hash == hashToken("broken") {
+			return APIToken{}, errors.New("connection refused")
+		}
+
+		if token, ok := tokens[hash]; ok {
+			return token, nil
+		}
+
+		return APIToken{}, pg.ErrNoRows
+	}}
+
+	handle := auth.Middleware(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if token := TokenFromRequest(r); token == nil || !token.Scope.Valid() {
+			t.Errorf("The handler got the token %#v", token)
+		}
+
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	testcase := []struct {
+		method, token string
+		code          int
+	}{
+		{"GET", "", http.StatusUnauthorized},
+		{"GET", "unknown", http.StatusUnauthorized},
+		{"GET", "broken", http.StatusInternalServerError},
+		{"GET", "read", http.StatusTeapot},
+		{"POST", "read", http.StatusForbidden},
+		{"GET", "write", http.StatusTeapot},
+		{"DELETE", "write", http.StatusTeapot},
+	}
+
+	defer shutupLog()()
+	for _, row := range testcase {
+		r := MustRequest(t, row.method, "/api/v1/monitors/", nil)
+		if row.token != "" {
+			r.Header.Set("Authorization", "Bearer "+row.token)
+		}
+
+		recorder := httptest.NewRecorder()
+		handle(recorder, r, nil)
+		if recorder.Code != row.code {
+			t.Errorf("%v with token %q => %v, wanted: %v", row.method, row.token,
+				recorder.Code, row.code)
+		}
+
+		challenge := recorder.Header().Get("WWW-Authenticate") != ""
+		if challenge != (row.code == http.StatusUnauthorized) {
+			t.Errorf("%v with token %q: unexpected WWW-Authenticate header: %q",
+				row.method, row.token, recorder.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestFindAPIToken(t *testing.T) {
+	defer InitTestConnection(t)()
+	token, plain, err := NewAPIToken("Test", ReadOnlyScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Create(&token); err != nil {
+		t.Fatalf("Could not create token: %v", err)
+	}
+
+	n, err := db.Model(&APIToken{}).Where("last_used IS NULL").Count()
+	if err != nil || n != 1 {
+		t.Errorf("Unused tokens need to be stored with last_used NULL: %d, %v", n, err)
+	}
+
+	found, err := findAPIToken(hashToken(plain))
+	if err != nil || found.Id != token.Id || found.Scope != ReadOnlyScope {
+		t.Errorf("findAPIToken => %#v, %v", found, err)
+	}
+
+	if err := db.Select(&found); err != nil || found.LastUsed.IsZero() {
+		t.Errorf("The last use has not been recorded: %#v, %v", found, err)
+	}
+
+	if _, err := findAPIToken(hashToken("unknown")); err != pg.ErrNoRows {
+		t.Errorf("Wanted pg.ErrNoRows for an unknown token; got: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"time"
+
+	"gopkg.in/pg.v4"
+)
+
+// UptimeReport summarizes how reliable a monitor has been within
+// a time range. Periods in which the monitor has been paused (or
+// has not been checked yet) are not taken into account.
+type UptimeReport struct {
+	Range TimeRange
+
+	// Uptime and Downtime are the time the server has been up
+	// and down respectively.
+	Uptime   time.Duration
+	Downtime time.Duration
+
+	// Outages is the number of times the server went down (an
+	// outage that started before the range is counted, too).
+	Outages int
+
+	// MTTR (mean time to recovery) is the average duration of
+	// an outage, MTBF (mean time between failures) is the average
+	// time the server has been up between two outages. Both are
+	// zero if there have not been any outages.
+	MTTR time.Duration
+	MTBF time.Duration
+}
+
+// Monitored returns the time the monitor has been checked.
+func (r UptimeReport) Monitored() time.Duration {
+	return r.Uptime + r.Downtime
+}
+
+// HasData is false if the monitor has not been checked at all
+// within the range.
+func (r UptimeReport) HasData() bool {
+	return r.Monitored() > 0
+}
+
+// Percentage returns the percentage of the monitored time the
+// server has been up (100 if there is no data).
+func (r UptimeReport) Percentage() float64 {
+	if !r.HasData() {
+		return 100
+	}
+
+	return float64(r.Uptime) * 100 / float64(r.Monitored())
+}
+
+// CalculateUptime walks through the state changes of a monitor
+// within the range. initial is the latest event before the range
+// begins (or nil if there is none). logs need to be ordered by
+// date (oldest first). All durations are rounded to seconds.
+func CalculateUptime(r TimeRange, initial *MonitorLog, logs []MonitorLog) UptimeReport {
+	report := UptimeReport{Range: r}
+	state := MonitorCreatedEvent
+	since := r.From
+	if initial != nil {
+		state = initial.Event
+		if state == MonitorDownEvent {
+			report.Outages++
+		}
+	}
+
+	advance := func(until time.Time) {
+		if until.After(r.To) {
+			until = r.To
+		}
+
+		if !until.After(since) {
+			return
+		}
+
+		switch state {
+		case MonitorUpEvent:
+			report.Uptime += until.Sub(since)
+		case MonitorDownEvent:
+			report.Downtime += until.Sub(since)
+		}
+
+		since = until
+	}
+
+	for _, l := range logs {
+		if l.Date.After(r.To) {
+			break
+		}
+
+		advance(l.Date)
+		if l.Event == MonitorDownEvent && state != MonitorDownEvent {
+			report.Outages++
+		}
+		state = l.Event
+	}
+
+	advance(r.To)
+	report.Uptime = roundSeconds(report.Uptime)
+	report.Downtime = roundSeconds(report.Downtime)
+	if report.Outages > 0 {
+		report.MTTR = roundSeconds(report.Downtime / time.Duration(report.Outages))
+		report.MTBF = roundSeconds(report.Uptime / time.Duration(report.Outages))
+	}
+
+	return report
+}
+
+// roundSeconds rounds d to whole seconds (so that it can be
+// shown without fractions).
+func roundSeconds(d time.Duration) time.Duration {
+	return (d + time.Second/2) / time.Second * time.Second
+}
+
+// loadUptimeReports calculates the reports of the given monitors.
+func loadUptimeReports(q queryer, monitorIDs []int, r TimeRange) (map[int]UptimeReport, error) {
+	reports := map[int]UptimeReport{}
+	if len(monitorIDs) == 0 {
+		return reports, nil
+	}
+
+	initial := []MonitorLog{}
+	_, err := q.Query(&initial, `SELECT DISTINCT ON (monitor_id) *
+		FROM monitor_logs WHERE monitor_id IN (?) AND date < ?
+		ORDER BY monitor_id, date DESC, id DESC`, pg.In(monitorIDs), r.From)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []MonitorLog{}
+	err = q.Model(&logs).
+		Where("monitor_id IN (?) AND date >= ? AND date <= ?", pg.In(monitorIDs), r.From, r.To).
+		Order("monitor_id ASC, date ASC, id ASC").Select()
+	if err != nil {
+		return nil, err
+	}
+
+	initialByID := map[int]*MonitorLog{}
+	for i := range initial {
+		initialByID[initial[i].MonitorId] = &initial[i]
+	}
+
+	logsByID := map[int][]MonitorLog{}
+	for _, l := range logs {
+		logsByID[l.MonitorId] = append(logsByID[l.MonitorId], l)
+	}
+
+	for _, id := range monitorIDs {
+		reports[id] = CalculateUptime(r, initialByID[id], logsByID[id])
+	}
+
+	return reports, nil
+}
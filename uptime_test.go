@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCalculateUptime(t *testing.T) {
+	now := time.Date(2016, 5, 22, 12, 0, 0, 0, time.UTC)
+	r, _ := NewTimeRange("24h", now)
+	at := func(hours int) time.Time {
+		return r.From.Add(time.Duration(hours) * time.Hour)
+	}
+
+	testcase := []struct {
+		name     string
+		initial  *MonitorLog
+		logs     []MonitorLog
+		expected UptimeReport
+	}{
+		{"no data", nil, nil, UptimeReport{}},
+		{"always up", &MonitorLog{Event: MonitorUpEvent}, nil,
+			UptimeReport{Uptime: 24 * time.Hour}},
+		{"down before range", &MonitorLog{Event: MonitorDownEvent}, []MonitorLog{
+			{Event: MonitorUpEvent, Date: at(2)},
+		}, UptimeReport{Uptime: 22 * time.Hour, Downtime: 2 * time.Hour,
+			Outages: 1, MTTR: 2 * time.Hour, MTBF: 22 * time.Hour}},
+		{"two outages", &MonitorLog{Event: MonitorUpEvent}, []MonitorLog{
+			{Event: MonitorDownEvent, Date: at(4)},
+			{Event: MonitorUpEvent, Date: at(5)},
+			{Event: MonitorDownEvent, Date: at(10)},
+			{Event: MonitorUpEvent, Date: at(13)},
+		}, UptimeReport{Uptime: 20 * time.Hour, Downtime: 4 * time.Hour,
+			Outages: 2, MTTR: 2 * time.Hour, MTBF: 10 * time.Hour}},
+		{"paused periods are excluded", nil, []MonitorLog{
+			{Event: MonitorCreatedEvent, Date: at(1)},
+			{Event: MonitorStartedEvent, Date: at(1)},
+			{Event: MonitorUpEvent, Date: at(2)},
+			{Event: MonitorDownEvent, Date: at(6)},
+			{Event: MonitorPausedEvent, Date: at(8)},
+			{Event: MonitorStartedEvent, Date: at(20)},
+			{Event: MonitorDownEvent, Date: at(21)},
+			{Event: MonitorUpEvent, Date: at(22)},
+		}, UptimeReport{Uptime: 6 * time.Hour, Downtime: 3 * time.Hour,
+			Outages: 2, MTTR: 90 * time.Minute, MTBF: 3 * time.Hour}},
+		{"logs after the range are ignored", &MonitorLog{Event: MonitorUpEvent},
+			[]MonitorLog{{Event: MonitorDownEvent, Date: at(25)}},
+			UptimeReport{Uptime: 24 * time.Hour}},
+	}
+
+	for _, row := range testcase {
+		report := CalculateUptime(r, row.initial, row.logs)
+		row.expected.Range = r
+		if report != row.expected {
+			t.Errorf("%v: CalculateUptime => %+v, wanted: %+v", row.name, report, row.expected)
+		}
+	}
+}
+
+func TestUptimeReportPercentage(t *testing.T) {
+	testcase := []struct {
+		report   UptimeReport
+		hasData  bool
+		expected float64
+	}{
+		{UptimeReport{}, false, 100},
+		{UptimeReport{Uptime: time.Hour}, true, 100},
+		{UptimeReport{Uptime: 3 * time.Hour, Downtime: time.Hour}, true, 75},
+		{UptimeReport{Downtime: time.Hour}, true, 0},
+	}
+
+	for _, row := range testcase {
+		if p := row.report.Percentage(); p != row.expected || row.report.HasData() != row.hasData {
+			t.Errorf("%+v: Percentage() => %v, wanted: %v", row.report, p, row.expected)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	now := time.Date(2016, 5, 22, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2016, 5, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	testcase := []struct {
+		query    string
+		from, to time.Time
+	}{
+		{"", now.Add(-24 * time.Hour), now},
+		{"range=7d", now.Add(-7 * 24 * time.Hour), now},
+		{"range=custom&from=2016-05-01&to=2016-05-02", day(1), day(3)},
+		{"range=custom&from=2016-05-20&to=2016-05-30", day(20), now},
+	}
+
+	for _, row := range testcase {
+		query, _ := url.ParseQuery(row.query)
+		r, err := ParseTimeRange(query, now)
+		if err != nil || !r.From.Equal(row.from) || !r.To.Equal(row.to) {
+			t.Errorf("ParseTimeRange(%q) => %v, %v", row.query, r, err)
+		}
+	}
+
+	for _, invalid := range []string{
+		"range=custom",
+		"range=custom&from=2016-05-01",
+		"range=custom&from=2016-05-01&to=01.05.2016",
+		"range=custom&from=2016-05-02&to=2016-05-01",
+		"range=custom&from=2016-05-23&to=2016-05-24",
+		"range=custom&from=2015-01-01&to=2016-05-01",
+	} {
+		query, _ := url.ParseQuery(invalid)
+		if r, err := ParseTimeRange(query, now); err == nil {
+			t.Errorf("ParseTimeRange(%q) => %v, wanted an error", invalid, r)
+		}
+	}
+}
+
+func TestLoadUptimeReports(t *testing.T) {
+	defer InitTestConnection(t)()
+	from := time.Date(2016, 5, 21, 0, 0, 0, 0, time.UTC)
+	r := TimeRange{CustomTimeRange, from, from.Add(48 * time.Hour)}
+	reports, err := loadUptimeReports(db, []int{1, 4, 100}, r)
+	if err != nil {
+		t.Fatalf("loadUptimeReports returned an error: %v", err)
+	}
+
+	if len(reports) != 3 {
+		t.Errorf("Wanted 3 reports, got: %v", reports)
+	}
+
+	if report := reports[1]; report.Outages != 1 || !report.HasData() {
+		t.Errorf("Unexpected report of monitor 1: %+v", report)
+	}
+
+	if report := reports[4]; report.Percentage() != 0 || report.Outages != 1 {
+		t.Errorf("Unexpected report of monitor 4: %+v", report)
+	}
+
+	if report := reports[100]; report.HasData() {
+		t.Errorf("Monitor 100 does not exist but has data: %+v", report)
+	}
+}
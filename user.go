@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/pg.v4"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// sessionCookieName is the name of the cookie containing
+	// the session token.
+	sessionCookieName = "upchecker_session"
+
+	// sessionDuration is the time after which users need to
+	// log in again.
+	sessionDuration = 14 * 24 * time.Hour
+
+	// MinPasswordLength is the minimum length of a password.
+	MinPasswordLength = 8
+
+	// maxPasswordLength is the maximum length (in bytes) of a
+	// password that bcrypt supports.
+	maxPasswordLength = 72
+)
+
+// User is an account that can log in to the web interface.
+type User struct {
+	Id   int
+	Name string
+	Role Role
+
+	// PasswordHash is the bcrypt hash of the password.
+	PasswordHash string
+	Created      time.Time
+}
+
+// SetPassword hashes the password (which needs to be validated
+// with validatePassword first).
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword is true if password is the user's password.
+func (u User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// validatePassword returns an error (meant to be shown to the user)
+// if the password is too weak or does not match the confirmation.
+func validatePassword(password, confirmation string) error {
+	if len(password) < MinPasswordLength {
+		return errors.New("The password needs to be at least " +
+			strconv.Itoa(MinPasswordLength) + " characters long.")
+	} else if len(password) > maxPasswordLength {
+		return errors.New("The password cannot be longer than " +
+			strconv.Itoa(maxPasswordLength) + " bytes.")
+	} else if password != confirmation {
+		return errors.New("The passwords do not match.")
+	}
+
+	return nil
+}
+
+// Session is created when a user logs in. The cookie contains the
+// session token, only its hash is stored (see hashToken).
+type Session struct {
+	Id      int
+	Hash    string
+	UserId  int
+	Created time.Time
+	Expires time.Time
+}
+
+// createSession stores a new session for the user and returns the
+// cookie containing its token. Expired sessions are deleted.
+func createSession(r *http.Request, user User) (*http.Cookie, error) {
+	token, err := randomToken("")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := Session{
+		Hash:    hashToken(token),
+		UserId:  user.Id,
+		Created: now,
+		Expires: now.Add(sessionDuration),
+	}
+
+	if _, err := db.Model(&Session{}).Where("expires < ?", now).Delete(); err != nil {
+		return nil, err
+	}
+
+	if err := db.Create(&session); err != nil {
+		return nil, err
+	}
+
+	return sessionCookie(r, token, session.Expires), nil
+}
+
+// sessionCookie returns the cookie storing the token. It is only
+// sent via HTTPS if the request has been made via HTTPS (directly
+// or through a proxy) and cannot be read by scripts.
+func sessionCookie(r *http.Request, token string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if expires.IsZero() {
+		// Deletes the cookie.
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
+
+// findSessionUser returns the user of the session with the hash.
+// If there is no such session (or it has expired), pg.ErrNoRows
+// is returned.
+func findSessionUser(hash string) (User, error) {
+	users := []User{}
+	_, err := db.Query(&users, `SELECT u.* FROM users u
+		JOIN sessions s ON (s.user_id = u.id)
+		WHERE s.hash = ? AND s.expires > ?`, hash, time.Now())
+	if err != nil {
+		return User{}, err
+	} else if len(users) == 0 {
+		return User{}, pg.ErrNoRows
+	}
+
+	return users[0], nil
+}
+
+// hasUsers is false if no account has been created yet.
+func hasUsers() (bool, error) {
+	n, err := db.Model(&User{}).Count()
+	return n > 0, err
+}
+
+type contextKey int
+
+const (
+	// userContextKey stores the logged in user in the context
+	// of a request.
+	userContextKey contextKey = iota
+
+	// tokenContextKey stores the API token a request has been
+	// authenticated with.
+	tokenContextKey
+)
+
+// UserFromRequest returns the user who has made the request
+// (or nil if the user is not logged in).
+func UserFromRequest(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	return user
+}
+
+// withUser returns a copy of r made by user.
+func withUser(r *http.Request, user *User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+}
+
+// SessionAuthenticator makes sure that users are logged
+// in (see Protect).
+type SessionAuthenticator struct {
+	// Find returns the user of the session with the hash.
+	// pg.ErrNoRows means that there is no such session.
+	Find func(hash string) (User, error)
+
+	// HasUsers is false if the first account still needs
+	// to be created.
+	HasUsers func() (bool, error)
+
+	// Public are the prefixes of paths that can be accessed
+	// without logging in.
+	Public []string
+}
+
+// NewSessionAuthenticator returns an authenticator that looks
+// up the sessions in the database.
+func NewSessionAuthenticator(public ...string) SessionAuthenticator {
+	return SessionAuthenticator{
+		Find:     findSessionUser,
+		HasUsers: hasUsers,
+		Public:   public,
+	}
+}
+
+func (a SessionAuthenticator) isPublic(path string) bool {
+	for _, prefix := range a.Public {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// user returns the user whose session cookie has been sent (or nil).
+func (a SessionAuthenticator) user(r *http.Request) (*User, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	user, err := a.Find(hashToken(cookie.Value))
+	if err == pg.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Protect wraps h so that users who are not logged in are redirected
+// to the login page (or the setup page if there are no users, yet).
+// The user is stored in the request (see UserFromRequest).
+func (a SessionAuthenticator) Protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.isPublic(r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := a.user(r)
+		if err != nil {
+			defaultTW.SetError(NewDatabaseError(err)).Execute(w)
+			return
+		} else if user != nil {
+			h.ServeHTTP(w, withUser(r, user))
+			return
+		}
+
+		location := "/login/?next=" + url.QueryEscape(r.URL.RequestURI())
+		if ok, err := a.HasUsers(); err != nil {
+			defaultTW.SetError(NewDatabaseError(err)).Execute(w)
+			return
+		} else if !ok {
+			location = "/setup/"
+		}
+
+		http.Redirect(w, r, location, http.StatusSeeOther)
+	})
+}
+
+// OrToken lets requests through that have been made by a logged in
+// user or with an API token (such as the export of the logs, which
+// is used by the web interface and by scripts). Its path needs to
+// be public.
+func (a SessionAuthenticator) OrToken(tokens TokenAuthenticator, h httprouter.Handle) httprouter.Handle {
+	withToken := tokens.Middleware(h)
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, err := a.user(r)
+		if err != nil {
+			defaultTW.SetError(NewDatabaseError(err)).Execute(w)
+		} else if user != nil {
+			h(w, withUser(r, user), p)
+		} else {
+			withToken(w, r, p)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/pg.v4"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestUserPassword(t *testing.T) {
+	u := User{}
+	if err := u.SetPassword("correct horse"); err != nil {
+		t.Fatalf("SetPassword returned an error: %v", err)
+	}
+
+	if strings.Contains(u.PasswordHash, "correct horse") {
+		t.Errorf("The password has not been hashed: %q", u.PasswordHash)
+	}
+
+	if !u.CheckPassword("correct horse") || u.CheckPassword("correct horse ") {
+		t.Errorf("CheckPassword does not match the password")
+	}
+
+	if (User{}).CheckPassword("") {
+		t.Errorf("Users without a password must not be able to log in")
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	testcase := []struct {
+		password, confirmation, err string
+	}{
+		{"secret", "secret", "The password needs to be at least 8 characters long."},
+		{strings.Repeat("a", 73), strings.Repeat("a", 73), "The password cannot be longer than 72 bytes."},
+		{"12345678", "12345679", "The passwords do not match."},
+		{"12345678", "12345678", ""},
+	}
+
+	for _, row := range testcase {
+		err := validatePassword(row.password, row.confirmation)
+		if (err == nil && row.err != "") || (err != nil && err.Error() != row.err) {
+			t.Errorf("validatePassword(%q, %q) => %v, wanted: %q",
+				row.password, row.confirmation, err, row.err)
+		}
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	r := MustRequest(t, "GET", "/", nil)
+	expires := time.Now().Add(time.Hour)
+	cookie := sessionCookie(r, "token", expires)
+	if cookie.Name != sessionCookieName || cookie.Value != "token" || cookie.Path != "/" ||
+		!cookie.HttpOnly || cookie.Secure || cookie.SameSite != http.SameSiteLaxMode ||
+		!cookie.Expires.Equal(expires) || cookie.MaxAge != 0 {
+		t.Errorf("Unexpected cookie: %#v", cookie)
+	}
+
+	r.TLS = &tls.ConnectionState{}
+	if !sessionCookie(r, "token", expires).Secure {
+		t.Errorf("Cookies need to be secure when using HTTPS")
+	}
+
+	r = MustRequest(t, "GET", "/", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if !sessionCookie(r, "token", expires).Secure {
+		t.Errorf("Cookies need to be secure when using HTTPS behind a proxy")
+	}
+
+	if c := sessionCookie(r, "", time.Time{}); c.MaxAge >= 0 {
+		t.Errorf("Cookies without an expiry date need to be deleted: %#v", c)
+	}
+}
+
+// fakeSessions returns an authenticator knowing a single
+// session ("valid") of the user "alice".
+func fakeSessions(hasUsers bool, public ...string) SessionAuthenticator {
+	return SessionAuthenticator{
+		Find: func(hash string) (User, error) {
+			switch hash {
+			case hashToken("valid"):
+				return User{Id: 1, Name: "alice"}, nil
+			case hashToken("broken"):
+				return User{}, errors.New("connection refused")
+			default:
+				return User{}, pg.ErrNoRows
+			}
+		},
+		HasUsers: func() (bool, error) { return hasUsers, nil },
+		Public:   public,
+	}
+}
+
+func TestSessionAuthenticatorProtect(t *testing.T) {
+	var user *User
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = UserFromRequest(r)
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	testcase := []struct {
+		hasUsers bool
+		path     string
+		session  string
+		code     int
+		location string
+		user     string
+	}{
+		{true, "/static/css/bootstrap.min.css", "", http.StatusTeapot, "", ""},
+		{true, "/login/", "", http.StatusTeapot, "", ""},
+		{true, "/", "valid", http.StatusTeapot, "", "alice"},
+		{true, "/monitors/view/1/?range=7d", "", http.StatusSeeOther,
+			"/login/?next=%2Fmonitors%2Fview%2F1%2F%3Frange%3D7d", ""},
+		{true, "/", "expired", http.StatusSeeOther, "/login/?next=%2F", ""},
+		{false, "/", "", http.StatusSeeOther, "/setup/", ""},
+		{true, "/", "broken", http.StatusInternalServerError, "", ""},
+	}
+
+	defer shutupLog()()
+	for _, row := range testcase {
+		user = nil
+		protected := fakeSessions(row.hasUsers, "/static/", "/login/").Protect(handler)
+		r := MustRequest(t, "GET", row.path, nil)
+		if row.session != "" {
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: row.session})
+		}
+
+		recorder := httptest.NewRecorder()
+		protected.ServeHTTP(recorder, r)
+		if recorder.Code != row.code {
+			t.Errorf("%v (session %q) => %v, wanted: %v", row.path, row.session,
+				recorder.Code, row.code)
+		}
+
+		if l := recorder.Header().Get("Location"); l != row.location {
+			t.Errorf("%v (session %q) redirected to %q, wanted: %q", row.path,
+				row.session, l, row.location)
+		}
+
+		if (user == nil && row.user != "") || (user != nil && user.Name != row.user) {
+			t.Errorf("%v (session %q) was made by %#v, wanted: %q", row.path,
+				row.session, user, row.user)
+		}
+	}
+}
+
+func TestSessionAuthenticatorOrToken(t *testing.T) {
+	tokens := TokenAuthenticator{Find: func(hash string) (APIToken, error) {
+		if hash == hashToken("token") {
+			return APIToken{Scope: ReadOnlyScope}, nil
+		}
+
+		return APIToken{}, pg.ErrNoRows
+	}}
+
+	handle := fakeSessions(true).OrToken(tokens,
+		func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+
+	testcase := []struct {
+		session, token string
+		code           int
+	}{
+		{"valid", "", http.StatusTeapot},
+		{"", "token", http.StatusTeapot},
+		{"expired", "token", http.StatusTeapot},
+		{"expired", "", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	}
+
+	for _, row := range testcase {
+		r := MustRequest(t, "GET", "/monitors/logs/1/export?format=csv", nil)
+		if row.session != "" {
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: row.session})
+		}
+
+		if row.token != "" {
+			r.Header.Set("Authorization", "Bearer "+row.token)
+		}
+
+		recorder := httptest.NewRecorder()
+		handle(recorder, r, nil)
+		if recorder.Code != row.code {
+			t.Errorf("Session %q and token %q => %v, wanted: %v", row.session,
+				row.token, recorder.Code, row.code)
+		}
+	}
+}
+
+func TestFindSessionUser(t *testing.T) {
+	defer InitTestConnection(t)()
+	user := User{Name: "alice", Role: ViewerRole, PasswordHash: "x", Created: time.Now()}
+	if err := db.Create(&user); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie, err := createSession(MustRequest(t, "POST", "/login/", nil), user)
+	if err != nil {
+		t.Fatalf("createSession returned an error: %v", err)
+	}
+
+	found, err := findSessionUser(hashToken(cookie.Value))
+	if err != nil || found.Id != user.Id {
+		t.Errorf("findSessionUser => %#v, %v", found, err)
+	}
+
+	expired := Session{Hash: hashToken("expired"), UserId: user.Id,
+		Created: time.Now().Add(-time.Hour), Expires: time.Now().Add(-time.Minute)}
+	if err := db.Create(&expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := findSessionUser(hashToken("expired")); err != pg.ErrNoRows {
+		t.Errorf("Wanted pg.ErrNoRows for an expired session; got: %v", err)
+	}
+}